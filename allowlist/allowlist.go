@@ -0,0 +1,276 @@
+// Package allowlist rejects deliveries whose source address isn't in the CIDR
+// ranges of their provider, for providers like Bitbucket Cloud and Docker Hub
+// whose deliveries aren't cryptographically authenticated
+package allowlist
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+)
+
+// allowlist errors
+var (
+	ErrInvalidCIDR   = errors.New("invalid CIDR")
+	ErrNoClientIP    = errors.New("client IP not found")
+	ErrForbidden     = errors.New("source address not allowed")
+	ErrInvalidMeta   = errors.New("invalid GitHub meta document")
+	ErrMetaRequest   = errors.New("GitHub meta request failed")
+	ErrUnknownSource = errors.New("provider not detected")
+)
+
+// GitHubMetaURL is the URL of the GitHub meta API listing the webhook source ranges
+const GitHubMetaURL = "https://api.github.com/meta"
+
+// Option is a configuration option for the allowlist
+type Option func(*Allowlist) error
+
+// Options is a namespace var for configuration options
+var Options = AllowlistOptions{}
+
+// AllowlistOptions is a namespace for configuration option methods
+type AllowlistOptions struct{}
+
+// Provider sets the CIDR ranges the deliveries of the provider come from, bare
+// IP addresses are accepted as single address ranges
+func (AllowlistOptions) Provider(provider webhooks.ProviderName, cidrs ...string) Option {
+	return func(a *Allowlist) error {
+		return a.SetProvider(provider, cidrs...)
+	}
+}
+
+// TrustedProxies sets the CIDR ranges of the reverse proxies in front of the
+// server. The client address of requests coming from a trusted proxy is read
+// from X-Forwarded-For, the header is ignored otherwise
+func (AllowlistOptions) TrustedProxies(cidrs ...string) Option {
+	return func(a *Allowlist) error {
+		nets, err := ParseCIDRs(cidrs...)
+		if err != nil {
+			return err
+		}
+		a.proxies = nets
+		return nil
+	}
+}
+
+// Logger registers the logger of the rejected deliveries, nothing is logged by default
+func (AllowlistOptions) Logger(logger webhooks.Logger) Option {
+	return func(a *Allowlist) error {
+		a.logger = logger
+		return nil
+	}
+}
+
+// Allowlist checks the source address of the deliveries against the ranges of
+// their provider, providers without ranges are rejected. Ranges may be replaced
+// while serving, e.g. when the GitHub meta ranges are refreshed
+type Allowlist struct {
+	proxies []*net.IPNet
+	logger  webhooks.Logger
+
+	mu     sync.RWMutex
+	ranges map[webhooks.ProviderName][]*net.IPNet
+}
+
+// New creates and returns an Allowlist
+func New(options ...Option) (*Allowlist, error) {
+	a := &Allowlist{ranges: make(map[webhooks.ProviderName][]*net.IPNet)}
+	for _, opt := range options {
+		if err := opt(a); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// SetProvider replaces the CIDR ranges of the provider, it is safe for concurrent use
+func (a *Allowlist) SetProvider(provider webhooks.ProviderName, cidrs ...string) error {
+	nets, err := ParseCIDRs(cidrs...)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.ranges[provider] = nets
+	a.mu.Unlock()
+	return nil
+}
+
+// Allowed reports whether ip is in the ranges of the provider
+func (a *Allowlist) Allowed(provider webhooks.ProviderName, ip net.IP) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return contains(a.ranges[provider], ip)
+}
+
+// ClientIP returns the address of the client that sent the request. Unless the
+// peer is a trusted proxy it is the peer address, otherwise X-Forwarded-For is
+// walked from the right and the first address that isn't a trusted proxy is returned
+func (a *Allowlist) ClientIP(r *http.Request) (net.IP, error) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, ErrNoClientIP
+	}
+	if !contains(a.proxies, ip) {
+		return ip, nil
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			return nil, ErrNoClientIP
+		}
+		ip = hop
+		if !contains(a.proxies, ip) {
+			return ip, nil
+		}
+	}
+	// every hop is a trusted proxy, the request originates from the proxy network
+	return ip, nil
+}
+
+// Check returns ErrForbidden unless the client of the request is in the ranges of the provider
+func (a *Allowlist) Check(provider webhooks.ProviderName, r *http.Request) error {
+	ip, err := a.ClientIP(r)
+	if err != nil {
+		return err
+	}
+	if !a.Allowed(provider, ip) {
+		return fmt.Errorf("%w: %s", ErrForbidden, ip)
+	}
+	return nil
+}
+
+// Handler returns a handler passing the deliveries of the provider whose client
+// is allowed on to next and answering the others with 403 Forbidden
+func (a *Allowlist) Handler(provider webhooks.ProviderName, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := a.Check(provider, r); err != nil {
+			a.reject(w, r, provider, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Middleware works like Handler for the provider detected with webhooks.Detect,
+// usually in front of a webhooks.Mux. Deliveries of undetected providers, Docker
+// Hub included, are answered with 403 Forbidden
+func (a *Allowlist) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provider, err := webhooks.Detect(r)
+		if err != nil {
+			a.reject(w, r, "", ErrUnknownSource)
+			return
+		}
+		a.Handler(provider, next).ServeHTTP(w, r)
+	})
+}
+
+func (a *Allowlist) reject(w http.ResponseWriter, r *http.Request, provider webhooks.ProviderName, err error) {
+	if a.logger != nil {
+		a.logger.Warn("delivery rejected", "provider", string(provider), "remote", r.RemoteAddr,
+			"delivery", webhooks.DeliveryID(r.Header), "error", err.Error())
+	}
+	http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+}
+
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCIDRs parses the CIDR ranges, bare IP addresses are accepted as single address ranges
+func ParseCIDRs(cidrs ...string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidCIDR, cidr)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidCIDR, cidr)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// ReadGitHubMeta returns the webhook source ranges, the "hooks" entry, of a GitHub meta document
+func ReadGitHubMeta(r io.Reader) ([]string, error) {
+	var meta struct {
+		Hooks []string `json:"hooks"`
+	}
+	if err := json.NewDecoder(r).Decode(&meta); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMeta, err)
+	}
+	if len(meta.Hooks) == 0 {
+		return nil, fmt.Errorf("%w: no hooks ranges", ErrInvalidMeta)
+	}
+	if _, err := ParseCIDRs(meta.Hooks...); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMeta, err)
+	}
+	return meta.Hooks, nil
+}
+
+// LoadGitHubMetaFile returns the webhook source ranges of the GitHub meta document stored in the file
+func LoadGitHubMetaFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return ReadGitHubMeta(f)
+}
+
+// FetchGitHubMeta returns the webhook source ranges of the GitHub meta document
+// served at url, usually GitHubMetaURL, with client or http.DefaultClient when nil
+func FetchGitHubMeta(ctx context.Context, client *http.Client, url string) ([]string, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: status %d", ErrMetaRequest, resp.StatusCode)
+	}
+	return ReadGitHubMeta(resp.Body)
+}
@@ -0,0 +1,218 @@
+package allowlist
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+	"github.com/stretchr/testify/require"
+)
+
+const meta = `{
+  "verifiable_password_authentication": true,
+  "hooks": ["192.30.252.0/22", "185.199.108.0/22", "2a0a:a440::/29"],
+  "web": ["192.30.252.0/22"]
+}`
+
+func TestClientIP(t *testing.T) {
+	assert := require.New(t)
+	a, err := New(Options.TrustedProxies("10.0.0.0/8", "fd00::/8"))
+	assert.NoError(err)
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded []string
+		ip        string
+		err       error
+	}{
+		{
+			name:   "Direct",
+			remote: "192.30.252.10:41234",
+			ip:     "192.30.252.10",
+		},
+		{
+			name:      "UntrustedPeer",
+			remote:    "203.0.113.7:41234",
+			forwarded: []string{"192.30.252.10"},
+			ip:        "203.0.113.7",
+		},
+		{
+			name:      "TrustedProxy",
+			remote:    "10.0.0.2:41234",
+			forwarded: []string{"192.30.252.10"},
+			ip:        "192.30.252.10",
+		},
+		{
+			name:      "SpoofedHop",
+			remote:    "10.0.0.2:41234",
+			forwarded: []string{"192.30.252.10, 203.0.113.7, 10.0.0.3"},
+			ip:        "203.0.113.7",
+		},
+		{
+			name:      "SplitHeaders",
+			remote:    "[fd00::2]:41234",
+			forwarded: []string{"192.30.252.10", "10.0.0.3"},
+			ip:        "192.30.252.10",
+		},
+		{
+			name:      "OnlyProxies",
+			remote:    "10.0.0.2:41234",
+			forwarded: []string{"10.0.0.3"},
+			ip:        "10.0.0.3",
+		},
+		{
+			name:      "InvalidHop",
+			remote:    "10.0.0.2:41234",
+			forwarded: []string{"unknown"},
+			err:       ErrNoClientIP,
+		},
+		{
+			name:   "InvalidRemote",
+			remote: "pipe",
+			err:    ErrNoClientIP,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/webhooks", nil)
+			r.RemoteAddr = tc.remote
+			for _, forwarded := range tc.forwarded {
+				r.Header.Add("X-Forwarded-For", forwarded)
+			}
+			ip, err := a.ClientIP(r)
+			assert.Equal(tc.err, err)
+			if tc.err == nil {
+				assert.Equal(tc.ip, ip.String())
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	assert := require.New(t)
+	a, err := New(
+		Options.Provider(webhooks.Bitbucket, "104.192.136.0/21", "185.166.140.0/22"),
+		Options.Provider(webhooks.Docker, "34.192.0.1"),
+		Options.TrustedProxies("10.0.0.0/8"),
+	)
+	assert.NoError(err)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name     string
+		provider webhooks.ProviderName
+		remote   string
+		header   string
+		code     int
+	}{
+		{name: "Allowed", provider: webhooks.Bitbucket, remote: "104.192.137.4:443", code: http.StatusOK},
+		{name: "Forwarded", provider: webhooks.Bitbucket, remote: "10.1.1.1:443", header: "185.166.141.9", code: http.StatusOK},
+		{name: "Denied", provider: webhooks.Bitbucket, remote: "203.0.113.7:443", code: http.StatusForbidden},
+		{name: "SingleAddress", provider: webhooks.Docker, remote: "34.192.0.1:443", code: http.StatusOK},
+		{name: "SingleAddressDenied", provider: webhooks.Docker, remote: "34.192.0.2:443", code: http.StatusForbidden},
+		{name: "NoRanges", provider: webhooks.GitHub, remote: "192.30.252.10:443", code: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/webhooks", nil)
+			r.RemoteAddr = tc.remote
+			if tc.header != "" {
+				r.Header.Set("X-Forwarded-For", tc.header)
+			}
+			w := httptest.NewRecorder()
+			a.Handler(tc.provider, next).ServeHTTP(w, r)
+			assert.Equal(tc.code, w.Code)
+		})
+	}
+
+	// the provider is detected from the delivery headers
+	assert.NoError(a.SetProvider(webhooks.GitHub, "192.30.252.0/22"))
+	r := httptest.NewRequest(http.MethodPost, "/webhooks", nil)
+	r.RemoteAddr = "192.30.252.10:443"
+	r.Header.Set("X-GitHub-Event", "push")
+	w := httptest.NewRecorder()
+	a.Middleware(next).ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+
+	r.Header.Del("X-GitHub-Event")
+	r.Header.Set("X-Event-Key", "repo:push")
+	r.Header.Set("X-Hook-UUID", "uuid")
+	w = httptest.NewRecorder()
+	a.Middleware(next).ServeHTTP(w, r)
+	assert.Equal(http.StatusForbidden, w.Code)
+
+	r = httptest.NewRequest(http.MethodPost, "/webhooks", nil)
+	r.RemoteAddr = "34.192.0.1:443"
+	w = httptest.NewRecorder()
+	a.Middleware(next).ServeHTTP(w, r)
+	assert.Equal(http.StatusForbidden, w.Code)
+}
+
+func TestParseCIDRs(t *testing.T) {
+	assert := require.New(t)
+
+	nets, err := ParseCIDRs("192.30.252.0/22", "2a0a:a440::/29", "34.192.0.1", "::1")
+	assert.NoError(err)
+	assert.Len(nets, 4)
+	assert.True(nets[2].Contains(net.ParseIP("34.192.0.1")))
+	assert.False(nets[2].Contains(net.ParseIP("34.192.0.2")))
+	assert.True(nets[3].Contains(net.ParseIP("::1")))
+
+	_, err = ParseCIDRs("192.30.252.0/33")
+	assert.True(errors.Is(err, ErrInvalidCIDR))
+	_, err = ParseCIDRs("github.com")
+	assert.True(errors.Is(err, ErrInvalidCIDR))
+	_, err = New(Options.Provider(webhooks.GitHub, "nope"))
+	assert.True(errors.Is(err, ErrInvalidCIDR))
+}
+
+func TestGitHubMeta(t *testing.T) {
+	assert := require.New(t)
+	expected := []string{"192.30.252.0/22", "185.199.108.0/22", "2a0a:a440::/29"}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/meta":
+			_, _ = w.Write([]byte(meta))
+		case "/invalid":
+			_, _ = w.Write([]byte(`{"hooks": ["192.30.252.0/33"]}`))
+		default:
+			http.Error(w, "rate limited", http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	hooks, err := FetchGitHubMeta(context.Background(), server.Client(), server.URL+"/meta")
+	assert.NoError(err)
+	assert.Equal(expected, hooks)
+
+	_, err = FetchGitHubMeta(context.Background(), nil, server.URL+"/limited")
+	assert.True(errors.Is(err, ErrMetaRequest))
+	_, err = FetchGitHubMeta(context.Background(), nil, server.URL+"/invalid")
+	assert.True(errors.Is(err, ErrInvalidMeta))
+
+	path := filepath.Join(t.TempDir(), "meta.json")
+	assert.NoError(os.WriteFile(path, []byte(meta), 0o600))
+	hooks, err = LoadGitHubMetaFile(path)
+	assert.NoError(err)
+	assert.Equal(expected, hooks)
+
+	_, err = ReadGitHubMeta(strings.NewReader(`{"web": ["192.30.252.0/22"]}`))
+	assert.True(errors.Is(err, ErrInvalidMeta))
+	_, err = ReadGitHubMeta(strings.NewReader(`<html>`))
+	assert.True(errors.Is(err, ErrInvalidMeta))
+}
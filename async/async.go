@@ -0,0 +1,302 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+)
+
+// dispatcher errors
+var (
+	ErrQueueFull          = errors.New("queue full")
+	ErrDispatcherClosed   = errors.New("dispatcher closed")
+	ErrInvalidWorkers     = errors.New("workers must be greater than 0")
+	ErrInvalidQueueSize   = errors.New("queue size must not be negative")
+	ErrInvalidMaxAttempts = errors.New("max attempts must be greater than 0")
+	ErrInvalidBackoff     = errors.New("invalid backoff")
+)
+
+// ParseFunc verifies and parses a delivery, usually the ParseDelivery method of a provider Webhook
+type ParseFunc func(r *http.Request) (*webhooks.Delivery, error)
+
+// HandlerFunc handles a delivery in the background, returning an error retries it
+type HandlerFunc func(ctx context.Context, delivery *webhooks.Delivery) error
+
+// Job is a delivery waiting to be handled
+type Job struct {
+	Delivery *webhooks.Delivery
+	// Attempts is the number of times the handler was called
+	Attempts int
+	// Err is the error returned by the last attempt
+	Err error
+}
+
+// DeadLetterSink receives the jobs that failed every attempt or could not be
+// attempted before shutdown
+type DeadLetterSink interface {
+	DeadLetter(job Job)
+}
+
+// DeadLetterFunc is an adapter allowing ordinary functions to be used as DeadLetterSink
+type DeadLetterFunc func(job Job)
+
+// DeadLetter calls f(job)
+func (f DeadLetterFunc) DeadLetter(job Job) {
+	f(job)
+}
+
+// Option is a configuration option for the dispatcher
+type Option func(*Dispatcher) error
+
+// Options is a namespace var for configuration options
+var Options = DispatcherOptions{}
+
+// DispatcherOptions is a namespace for configuration option methods
+type DispatcherOptions struct{}
+
+// Workers sets the number of deliveries handled concurrently, 4 by default
+func (DispatcherOptions) Workers(workers int) Option {
+	return func(d *Dispatcher) error {
+		if workers <= 0 {
+			return ErrInvalidWorkers
+		}
+		d.workers = workers
+		return nil
+	}
+}
+
+// QueueSize sets the number of deliveries waiting for a worker before new ones
+// are answered with 503 Service Unavailable, 100 by default
+func (DispatcherOptions) QueueSize(size int) Option {
+	return func(d *Dispatcher) error {
+		if size < 0 {
+			return ErrInvalidQueueSize
+		}
+		d.queueSize = size
+		return nil
+	}
+}
+
+// MaxAttempts sets the number of times the handler is called for a delivery
+// before it is dead-lettered, 5 by default
+func (DispatcherOptions) MaxAttempts(attempts int) Option {
+	return func(d *Dispatcher) error {
+		if attempts <= 0 {
+			return ErrInvalidMaxAttempts
+		}
+		d.maxAttempts = attempts
+		return nil
+	}
+}
+
+// Backoff sets the delay before the first retry, doubled on every further retry
+// up to max, 1s and 1m by default
+func (DispatcherOptions) Backoff(initial, max time.Duration) Option {
+	return func(d *Dispatcher) error {
+		if initial <= 0 || max < initial {
+			return ErrInvalidBackoff
+		}
+		d.initialBackoff = initial
+		d.maxBackoff = max
+		return nil
+	}
+}
+
+// DeadLetter registers the sink receiving the failed jobs, they are dropped by default
+func (DispatcherOptions) DeadLetter(sink DeadLetterSink) Option {
+	return func(d *Dispatcher) error {
+		d.deadLetter = sink
+		return nil
+	}
+}
+
+// StatusCode registers the function mapping parse errors onto HTTP status codes,
+// usually the StatusCode function of the provider package. By default parse errors
+// are answered with 400 Bad Request unless they are a webhooks.StatusError
+func (DispatcherOptions) StatusCode(fn func(err error) int) Option {
+	return func(d *Dispatcher) error {
+		d.statusCode = fn
+		return nil
+	}
+}
+
+// Dispatcher verifies and parses the deliveries synchronously, acknowledges them
+// with 202 Accepted and hands them to a bounded worker pool. It implements http.Handler
+type Dispatcher struct {
+	parse          ParseFunc
+	handler        HandlerFunc
+	workers        int
+	queueSize      int
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	deadLetter     DeadLetterSink
+	statusCode     func(err error) int
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan *Job
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// New creates a Dispatcher and starts its workers
+func New(parse ParseFunc, handler HandlerFunc, options ...Option) (*Dispatcher, error) {
+	d := &Dispatcher{
+		parse:          parse,
+		handler:        handler,
+		workers:        4,
+		queueSize:      100,
+		maxAttempts:    5,
+		initialBackoff: time.Second,
+		maxBackoff:     time.Minute,
+		statusCode:     defaultStatusCode,
+	}
+	for _, opt := range options {
+		if err := opt(d); err != nil {
+			return nil, err
+		}
+	}
+
+	d.queue = make(chan *Job, d.queueSize)
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	d.wg.Add(d.workers)
+	for i := 0; i < d.workers; i++ {
+		go d.work()
+	}
+	return d, nil
+}
+
+func defaultStatusCode(err error) int {
+	var statusErr *webhooks.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code
+	}
+	return http.StatusBadRequest
+}
+
+// ServeHTTP parses the delivery and queues it, queued deliveries are answered with
+// 202 Accepted and deliveries arriving while the queue is full or the dispatcher
+// is shut down with 503 Service Unavailable
+func (d *Dispatcher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	delivery, err := d.parse(r)
+	if err != nil {
+		code := d.statusCode(err)
+		if code == http.StatusNoContent {
+			w.WriteHeader(code)
+			return
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	if err := d.Enqueue(delivery); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Enqueue queues an already parsed delivery without blocking, ErrQueueFull is
+// returned when no slot is free
+func (d *Dispatcher) Enqueue(delivery *webhooks.Delivery) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return ErrDispatcherClosed
+	}
+
+	select {
+	case d.queue <- &Job{Delivery: delivery}:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Shutdown stops accepting deliveries and waits for the queued and in-flight ones
+// to be handled. When ctx is done first the workers are cancelled, the remaining
+// jobs are dead-lettered and the context error is returned
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+	}
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		d.cancel()
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+	for job := range d.queue {
+		d.process(job)
+	}
+}
+
+func (d *Dispatcher) process(job *Job) {
+	for {
+		if err := d.ctx.Err(); err != nil {
+			if job.Err == nil {
+				job.Err = err
+			}
+			d.dead(job)
+			return
+		}
+
+		job.Attempts++
+		job.Err = d.handler(d.ctx, job.Delivery)
+		if job.Err == nil {
+			return
+		}
+		if job.Attempts >= d.maxAttempts {
+			d.dead(job)
+			return
+		}
+
+		timer := time.NewTimer(d.backoff(job.Attempts))
+		select {
+		case <-timer.C:
+		case <-d.ctx.Done():
+			timer.Stop()
+		}
+	}
+}
+
+// backoff returns the delay before the retry following the given attempt
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.initialBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= d.maxBackoff {
+			return d.maxBackoff
+		}
+	}
+	return delay
+}
+
+func (d *Dispatcher) dead(job *Job) {
+	if d.deadLetter != nil {
+		d.deadLetter.DeadLetter(*job)
+	}
+}
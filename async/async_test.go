@@ -0,0 +1,145 @@
+package async
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	path = "/webhooks"
+)
+
+var errParse = errors.New("error parsing payload")
+
+func parse(r *http.Request) (*webhooks.Delivery, error) {
+	body, _ := ioutil.ReadAll(r.Body)
+	if len(body) == 0 {
+		return nil, errParse
+	}
+	return webhooks.NewDelivery(webhooks.GitHub, r.Header, body), nil
+}
+
+func post(handler http.Handler, body string) int {
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+	req.Header.Set("X-Github-Event", "push")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestDispatcher(t *testing.T) {
+	assert := require.New(t)
+	tests := []struct {
+		name     string
+		failures int
+		attempts int
+		dead     bool
+	}{
+		{
+			name:     "Handled",
+			attempts: 1,
+		},
+		{
+			name:     "Retried",
+			failures: 2,
+			attempts: 3,
+		},
+		{
+			name:     "DeadLettered",
+			failures: 5,
+			attempts: 3,
+			dead:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var mu sync.Mutex
+			var attempts int
+			var dead []Job
+			d, err := New(parse, func(ctx context.Context, delivery *webhooks.Delivery) error {
+				mu.Lock()
+				defer mu.Unlock()
+				attempts++
+				if attempts <= tc.failures {
+					return errors.New("handler failed")
+				}
+				return nil
+			},
+				Options.MaxAttempts(3),
+				Options.Backoff(time.Millisecond, 4*time.Millisecond),
+				Options.DeadLetter(DeadLetterFunc(func(job Job) {
+					mu.Lock()
+					defer mu.Unlock()
+					dead = append(dead, job)
+				})),
+			)
+			assert.NoError(err)
+
+			assert.Equal(http.StatusAccepted, post(d, "{}"))
+			assert.Equal(http.StatusBadRequest, post(d, ""))
+			assert.NoError(d.Shutdown(context.Background()))
+
+			assert.Equal(tc.attempts, attempts)
+			if tc.dead {
+				assert.Len(dead, 1)
+				assert.Equal(3, dead[0].Attempts)
+				assert.Error(dead[0].Err)
+			} else {
+				assert.Empty(dead)
+			}
+			assert.Equal(http.StatusServiceUnavailable, post(d, "{}"))
+		})
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	assert := require.New(t)
+	release := make(chan struct{})
+	d, err := New(parse, func(ctx context.Context, delivery *webhooks.Delivery) error {
+		<-release
+		return nil
+	}, Options.Workers(1), Options.QueueSize(1))
+	assert.NoError(err)
+
+	// the first delivery is picked up by the worker, the second fills the queue
+	assert.Equal(http.StatusAccepted, post(d, "{}"))
+	assert.Eventually(func() bool { return len(d.queue) == 0 }, time.Second, time.Millisecond)
+	assert.Equal(http.StatusAccepted, post(d, "{}"))
+	assert.Equal(http.StatusServiceUnavailable, post(d, "{}"))
+
+	close(release)
+	assert.NoError(d.Shutdown(context.Background()))
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	assert := require.New(t)
+	var dead []Job
+	d, err := New(parse, func(ctx context.Context, delivery *webhooks.Delivery) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, Options.Workers(1), Options.DeadLetter(DeadLetterFunc(func(job Job) {
+		dead = append(dead, job)
+	})))
+	assert.NoError(err)
+
+	assert.Equal(http.StatusAccepted, post(d, "{}"))
+	assert.Equal(http.StatusAccepted, post(d, "{}"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(context.DeadlineExceeded, d.Shutdown(ctx))
+	assert.Len(dead, 2)
+}
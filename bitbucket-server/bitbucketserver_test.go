@@ -2,6 +2,7 @@ package bitbucketserver
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"log"
 	"net/http"
@@ -11,6 +12,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
 )
 
 var hook *Webhook
@@ -313,3 +316,159 @@ func TestWebhooks(t *testing.T) {
 		})
 	}
 }
+
+func TestParseDelivery(t *testing.T) {
+	assert := require.New(t)
+	body, err := os.ReadFile("../testdata/bitbucket-server/repo-refs-changed.json")
+	assert.NoError(err)
+
+	req := httptest.NewRequest(http.MethodPost, ServerPath, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Atlassian HttpClient 1.1.0 / Bitbucket-5.5.0")
+	req.Header.Set("X-Event-Key", "repo:refs_changed")
+	req.Header.Set("X-Request-Id", "d0a6ba76-a7da-4a32-a0cb-fbf5e0bd6d84")
+	req.Header.Set("X-Hub-Signature", "sha256=8a60f7487d167f55886df87d4077192035d76f76a8e0b3a48fd8ae8cad25f391")
+	delivery, err := hook.ParseDelivery(req, RepositoryReferenceChangedEvent)
+	assert.NoError(err)
+	assert.Equal(webhooks.BitbucketServer, delivery.Provider)
+	assert.Equal("d0a6ba76-a7da-4a32-a0cb-fbf5e0bd6d84", delivery.ID)
+	assert.Equal("repo:refs_changed", delivery.Event)
+	assert.Equal("Atlassian HttpClient 1.1.0 / Bitbucket-5.5.0", delivery.UserAgent)
+	assert.Equal(body, delivery.Body)
+	assert.False(delivery.ReceivedAt.IsZero())
+	assert.IsType(RepositoryReferenceChangedPayload{}, delivery.Payload)
+
+	// the delivery is returned alongside the errors once the body has been read
+	req = httptest.NewRequest(http.MethodPost, ServerPath, bytes.NewReader(body))
+	req.Header.Set("X-Event-Key", "repo:refs_changed")
+	req.Header.Set("X-Hub-Signature", "sha256=111")
+	delivery, err = hook.ParseDelivery(req, RepositoryReferenceChangedEvent)
+	assert.Equal(ErrHMACVerificationFailed, err)
+	assert.Equal(body, delivery.Body)
+	assert.Nil(delivery.Payload)
+}
+
+func TestParseBytes(t *testing.T) {
+	assert := require.New(t)
+	body, err := os.ReadFile("../testdata/bitbucket-server/repo-refs-changed.json")
+	assert.NoError(err)
+
+	tests := []struct {
+		name    string
+		headers http.Header
+		body    []byte
+		err     error
+	}{
+		{
+			name: "Verified",
+			headers: http.Header{
+				"X-Event-Key":     []string{"repo:refs_changed"},
+				"X-Hub-Signature": []string{"sha256=8a60f7487d167f55886df87d4077192035d76f76a8e0b3a48fd8ae8cad25f391"},
+			},
+			body: body,
+		},
+		{
+			name: "BadSignature",
+			headers: http.Header{
+				"X-Event-Key":     []string{"repo:refs_changed"},
+				"X-Hub-Signature": []string{"sha256=111"},
+			},
+			body: body,
+			err:  ErrHMACVerificationFailed,
+		},
+		{
+			name: "MissingSignature",
+			headers: http.Header{
+				"X-Event-Key": []string{"repo:refs_changed"},
+			},
+			body: body,
+			err:  ErrMissingHubSignatureHeader,
+		},
+		{
+			name: "UnknownEvent",
+			headers: http.Header{
+				"X-Event-Key":     []string{"repo:modified"},
+				"X-Hub-Signature": []string{"sha256=8a60f7487d167f55886df87d4077192035d76f76a8e0b3a48fd8ae8cad25f391"},
+			},
+			body: body,
+			err:  ErrEventNotFound,
+		},
+		{
+			name: "EmptyBody",
+			headers: http.Header{
+				"X-Event-Key":     []string{"repo:refs_changed"},
+				"X-Hub-Signature": []string{"sha256=8a60f7487d167f55886df87d4077192035d76f76a8e0b3a48fd8ae8cad25f391"},
+			},
+			err: ErrParsingPayload,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			results, err := hook.ParseBytes(tc.headers, tc.body, RepositoryReferenceChangedEvent)
+			if tc.err != nil {
+				assert.Equal(tc.err, err)
+				return
+			}
+			assert.NoError(err)
+			assert.IsType(RepositoryReferenceChangedPayload{}, results)
+		})
+	}
+}
+
+func TestRouter(t *testing.T) {
+	assert := require.New(t)
+	payload, err := os.ReadFile("../testdata/bitbucket-server/repo-refs-changed.json")
+	assert.NoError(err)
+
+	var slug string
+	router := NewRouter(hook)
+	router.OnRepositoryReferenceChanged(func(ctx context.Context, pl RepositoryReferenceChangedPayload) error {
+		slug = pl.Repository.Slug
+		return nil
+	})
+
+	tests := []struct {
+		name      string
+		event     string
+		signature string
+		code      int
+	}{
+		{
+			name:      "Dispatched",
+			event:     "repo:refs_changed",
+			signature: "sha256=8a60f7487d167f55886df87d4077192035d76f76a8e0b3a48fd8ae8cad25f391",
+			code:      http.StatusOK,
+		},
+		{
+			name:      "Unregistered",
+			event:     "repo:modified",
+			signature: "sha256=8a60f7487d167f55886df87d4077192035d76f76a8e0b3a48fd8ae8cad25f391",
+			code:      http.StatusNoContent,
+		},
+		{
+			name:      "VerificationFailed",
+			event:     "repo:refs_changed",
+			signature: "sha256=111",
+			code:      http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range tests {
+		slug = ""
+		req := httptest.NewRequest(http.MethodPost, ServerPath, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Event-Key", tc.event)
+		req.Header.Set("X-Hub-Signature", tc.signature)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(tc.code, w.Code, tc.name)
+		if tc.code == http.StatusOK {
+			assert.Equal("webhook-test", slug)
+		} else {
+			assert.Empty(slug, tc.name)
+		}
+	}
+}
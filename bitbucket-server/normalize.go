@@ -0,0 +1,122 @@
+package bitbucketserver
+
+import (
+	webhooks "github.com/heitormejias/golang-webhooks"
+)
+
+// Normalize converts a payload returned by Parse into the provider agnostic
+// normalized events, webhooks.ErrNotNormalizable is returned for payloads
+// without a normalized form.
+//
+// A single repo:refs_changed may carry several ref changes, one normalized
+// event is returned per change, tag changes are returned as webhooks.NormalizedTag
+func Normalize(payload interface{}) ([]webhooks.NormalizedEvent, error) {
+	switch pl := payload.(type) {
+	case RepositoryReferenceChangedPayload:
+		return normalizeReferenceChanged(pl), nil
+	case PullRequestOpenedPayload:
+		return []webhooks.NormalizedEvent{normalizePullRequest(webhooks.ActionOpened, pl.PullRequest, pl.Actor)}, nil
+	case PullRequestFromReferenceUpdatedPayload:
+		return []webhooks.NormalizedEvent{normalizePullRequest(webhooks.ActionUpdated, pl.PullRequest, pl.Actor)}, nil
+	case PullRequestModifiedPayload:
+		return []webhooks.NormalizedEvent{normalizePullRequest(webhooks.ActionUpdated, pl.PullRequest, pl.Actor)}, nil
+	case PullRequestMergedPayload:
+		return []webhooks.NormalizedEvent{normalizePullRequest(webhooks.ActionMerged, pl.PullRequest, pl.Actor)}, nil
+	case PullRequestDeclinedPayload:
+		return []webhooks.NormalizedEvent{normalizePullRequest(webhooks.ActionClosed, pl.PullRequest, pl.Actor)}, nil
+	case PullRequestDeletedPayload:
+		return []webhooks.NormalizedEvent{normalizePullRequest(webhooks.ActionDeleted, pl.PullRequest, pl.Actor)}, nil
+	default:
+		return nil, webhooks.ErrNotNormalizable
+	}
+}
+
+// Normalize converts a payload returned by Parse into normalized events, it implements webhooks.Provider
+func (hook *Webhook) Normalize(payload interface{}) ([]webhooks.NormalizedEvent, error) {
+	return Normalize(payload)
+}
+
+// linkHref returns the href of the first link with the given relation, or
+// with the given name for the "clone" relation
+func linkHref(links map[string]interface{}, rel, name string) string {
+	list, _ := links[rel].([]interface{})
+	for _, l := range list {
+		link, _ := l.(map[string]interface{})
+		if name != "" && link["name"] != name {
+			continue
+		}
+		href, _ := link["href"].(string)
+		return href
+	}
+	return ""
+}
+
+func normalizeRepository(r Repository) webhooks.NormalizedRepository {
+	return webhooks.NormalizedRepository{
+		Name:     r.Name,
+		FullName: r.Project.Key + "/" + r.Slug,
+		HTMLURL:  linkHref(r.Links, "self", ""),
+		CloneURL: linkHref(r.Links, "clone", "http"),
+		Private:  !r.Public,
+	}
+}
+
+func normalizeUser(u User) webhooks.NormalizedUser {
+	return webhooks.NormalizedUser{Login: u.Name, Name: u.DisplayName, Email: u.EmailAddress}
+}
+
+func normalizeReferenceChanged(pl RepositoryReferenceChangedPayload) []webhooks.NormalizedEvent {
+	var events []webhooks.NormalizedEvent
+	for _, change := range pl.Changes {
+		if change.Reference.Type == "TAG" {
+			tag := webhooks.NormalizedTag{
+				Provider:   webhooks.BitbucketServer,
+				Repository: normalizeRepository(pl.Repository),
+				Action:     webhooks.ActionCreated,
+				Name:       change.Reference.DisplayID,
+				SHA:        change.ToHash,
+				Sender:     normalizeUser(pl.Actor),
+			}
+			switch change.Type {
+			case "DELETE":
+				tag.Action = webhooks.ActionDeleted
+				tag.SHA = change.FromHash
+			case "UPDATE":
+				tag.Action = webhooks.ActionUpdated
+			}
+			events = append(events, tag)
+			continue
+		}
+
+		events = append(events, webhooks.NormalizedPush{
+			Provider:   webhooks.BitbucketServer,
+			Repository: normalizeRepository(pl.Repository),
+			Ref:        change.ReferenceID,
+			Before:     change.FromHash,
+			After:      change.ToHash,
+			Created:    change.Type == "ADD",
+			Deleted:    change.Type == "DELETE",
+			Sender:     normalizeUser(pl.Actor),
+		})
+	}
+	return events
+}
+
+func normalizePullRequest(action string, pr PullRequest, actor User) webhooks.NormalizedPullRequest {
+	return webhooks.NormalizedPullRequest{
+		Provider:     webhooks.BitbucketServer,
+		Repository:   normalizeRepository(pr.ToRef.Repository),
+		Action:       action,
+		Number:       int64(pr.ID),
+		Title:        pr.Title,
+		Body:         pr.Description,
+		HTMLURL:      linkHref(pr.Links, "self", ""),
+		State:        pr.State,
+		Merged:       pr.State == "MERGED",
+		SourceBranch: pr.FromRef.DisplayID,
+		TargetBranch: pr.ToRef.DisplayID,
+		HeadSHA:      pr.FromRef.LatestCommit,
+		Author:       normalizeUser(pr.Author.User),
+		Sender:       normalizeUser(actor),
+	}
+}
@@ -0,0 +1,227 @@
+package bitbucketserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+)
+
+// HandlerFunc handles the payload returned by Parse for a registered event
+type HandlerFunc func(ctx context.Context, payload interface{}) error
+
+// Router dispatches the Bitbucket Server deliveries to the callbacks registered per event, the
+// events to parse are derived from the registered callbacks. It implements http.Handler
+type Router struct {
+	hook     *Webhook
+	handlers map[Event]HandlerFunc
+}
+
+// NewRouter creates and returns a Router parsing the deliveries with the given Webhook
+func NewRouter(hook *Webhook) *Router {
+	return &Router{
+		hook:     hook,
+		handlers: make(map[Event]HandlerFunc),
+	}
+}
+
+// On registers the callback for the given event, registering an event twice
+// replaces the previous callback. Callbacks must be registered before serving
+func (router *Router) On(event Event, fn HandlerFunc) {
+	router.handlers[event] = fn
+}
+
+// ServeHTTP parses the delivery and calls the callback registered for its event.
+//
+// Events without callback are answered with 204 No Content, invalid methods with
+// 405 Method Not Allowed, failed verifications with 401 Unauthorized and malformed
+// deliveries with 400 Bad Request. Callback errors are answered with 500 Internal
+// Server Error unless they are a webhooks.StatusError
+func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	events := make([]Event, 0, len(router.handlers))
+	for event := range router.handlers {
+		events = append(events, event)
+	}
+
+	payload, err := router.hook.Parse(r, events...)
+	if err != nil {
+		code := StatusCode(err)
+		if code == http.StatusNoContent {
+			w.WriteHeader(code)
+			return
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	handler, ok := router.handlers[Event(r.Header.Get("X-Event-Key"))]
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err := handler(r.Context(), payload); err != nil {
+		code := webhooks.StatusCode(err)
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// StatusCode maps the errors returned by Parse onto HTTP status codes
+func StatusCode(err error) int {
+	switch {
+	case errors.Is(err, ErrEventNotFound), errors.Is(err, ErrEventNotSpecifiedToParse):
+		return http.StatusNoContent
+	case errors.Is(err, ErrInvalidHTTPMethod):
+		return http.StatusMethodNotAllowed
+	case errors.Is(err, webhooks.ErrPayloadTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrMissingHubSignatureHeader), errors.Is(err, ErrHMACVerificationFailed):
+		return http.StatusUnauthorized
+	case errors.Is(err, webhooks.ErrSecretLookup):
+		return http.StatusInternalServerError
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// OnRepositoryReferenceChanged registers the callback for the RepositoryReferenceChangedEvent
+func (router *Router) OnRepositoryReferenceChanged(fn func(ctx context.Context, pl RepositoryReferenceChangedPayload) error) {
+	router.On(RepositoryReferenceChangedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(RepositoryReferenceChangedPayload))
+	})
+}
+
+// OnRepositoryModified registers the callback for the RepositoryModifiedEvent
+func (router *Router) OnRepositoryModified(fn func(ctx context.Context, pl RepositoryModifiedPayload) error) {
+	router.On(RepositoryModifiedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(RepositoryModifiedPayload))
+	})
+}
+
+// OnRepositoryForked registers the callback for the RepositoryForkedEvent
+func (router *Router) OnRepositoryForked(fn func(ctx context.Context, pl RepositoryForkedPayload) error) {
+	router.On(RepositoryForkedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(RepositoryForkedPayload))
+	})
+}
+
+// OnRepositoryCommentAdded registers the callback for the RepositoryCommentAddedEvent
+func (router *Router) OnRepositoryCommentAdded(fn func(ctx context.Context, pl RepositoryCommentAddedPayload) error) {
+	router.On(RepositoryCommentAddedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(RepositoryCommentAddedPayload))
+	})
+}
+
+// OnRepositoryCommentEdited registers the callback for the RepositoryCommentEditedEvent
+func (router *Router) OnRepositoryCommentEdited(fn func(ctx context.Context, pl RepositoryCommentEditedPayload) error) {
+	router.On(RepositoryCommentEditedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(RepositoryCommentEditedPayload))
+	})
+}
+
+// OnRepositoryCommentDeleted registers the callback for the RepositoryCommentDeletedEvent
+func (router *Router) OnRepositoryCommentDeleted(fn func(ctx context.Context, pl RepositoryCommentDeletedPayload) error) {
+	router.On(RepositoryCommentDeletedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(RepositoryCommentDeletedPayload))
+	})
+}
+
+// OnPullRequestOpened registers the callback for the PullRequestOpenedEvent
+func (router *Router) OnPullRequestOpened(fn func(ctx context.Context, pl PullRequestOpenedPayload) error) {
+	router.On(PullRequestOpenedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PullRequestOpenedPayload))
+	})
+}
+
+// OnPullRequestFromReferenceUpdated registers the callback for the PullRequestFromReferenceUpdatedEvent
+func (router *Router) OnPullRequestFromReferenceUpdated(fn func(ctx context.Context, pl PullRequestFromReferenceUpdatedPayload) error) {
+	router.On(PullRequestFromReferenceUpdatedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PullRequestFromReferenceUpdatedPayload))
+	})
+}
+
+// OnPullRequestModified registers the callback for the PullRequestModifiedEvent
+func (router *Router) OnPullRequestModified(fn func(ctx context.Context, pl PullRequestModifiedPayload) error) {
+	router.On(PullRequestModifiedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PullRequestModifiedPayload))
+	})
+}
+
+// OnPullRequestMerged registers the callback for the PullRequestMergedEvent
+func (router *Router) OnPullRequestMerged(fn func(ctx context.Context, pl PullRequestMergedPayload) error) {
+	router.On(PullRequestMergedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PullRequestMergedPayload))
+	})
+}
+
+// OnPullRequestDeclined registers the callback for the PullRequestDeclinedEvent
+func (router *Router) OnPullRequestDeclined(fn func(ctx context.Context, pl PullRequestDeclinedPayload) error) {
+	router.On(PullRequestDeclinedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PullRequestDeclinedPayload))
+	})
+}
+
+// OnPullRequestDeleted registers the callback for the PullRequestDeletedEvent
+func (router *Router) OnPullRequestDeleted(fn func(ctx context.Context, pl PullRequestDeletedPayload) error) {
+	router.On(PullRequestDeletedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PullRequestDeletedPayload))
+	})
+}
+
+// OnPullRequestReviewerUpdated registers the callback for the PullRequestReviewerUpdatedEvent
+func (router *Router) OnPullRequestReviewerUpdated(fn func(ctx context.Context, pl PullRequestReviewerUpdatedPayload) error) {
+	router.On(PullRequestReviewerUpdatedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PullRequestReviewerUpdatedPayload))
+	})
+}
+
+// OnPullRequestReviewerApproved registers the callback for the PullRequestReviewerApprovedEvent
+func (router *Router) OnPullRequestReviewerApproved(fn func(ctx context.Context, pl PullRequestReviewerApprovedPayload) error) {
+	router.On(PullRequestReviewerApprovedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PullRequestReviewerApprovedPayload))
+	})
+}
+
+// OnPullRequestReviewerUnapproved registers the callback for the PullRequestReviewerUnapprovedEvent
+func (router *Router) OnPullRequestReviewerUnapproved(fn func(ctx context.Context, pl PullRequestReviewerUnapprovedPayload) error) {
+	router.On(PullRequestReviewerUnapprovedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PullRequestReviewerUnapprovedPayload))
+	})
+}
+
+// OnPullRequestReviewerNeedsWork registers the callback for the PullRequestReviewerNeedsWorkEvent
+func (router *Router) OnPullRequestReviewerNeedsWork(fn func(ctx context.Context, pl PullRequestReviewerNeedsWorkPayload) error) {
+	router.On(PullRequestReviewerNeedsWorkEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PullRequestReviewerNeedsWorkPayload))
+	})
+}
+
+// OnPullRequestCommentAdded registers the callback for the PullRequestCommentAddedEvent
+func (router *Router) OnPullRequestCommentAdded(fn func(ctx context.Context, pl PullRequestCommentAddedPayload) error) {
+	router.On(PullRequestCommentAddedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PullRequestCommentAddedPayload))
+	})
+}
+
+// OnPullRequestCommentEdited registers the callback for the PullRequestCommentEditedEvent
+func (router *Router) OnPullRequestCommentEdited(fn func(ctx context.Context, pl PullRequestCommentEditedPayload) error) {
+	router.On(PullRequestCommentEditedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PullRequestCommentEditedPayload))
+	})
+}
+
+// OnPullRequestCommentDeleted registers the callback for the PullRequestCommentDeletedEvent
+func (router *Router) OnPullRequestCommentDeleted(fn func(ctx context.Context, pl PullRequestCommentDeletedPayload) error) {
+	router.On(PullRequestCommentDeletedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PullRequestCommentDeletedPayload))
+	})
+}
+
+// OnDiagnosticsPing registers the callback for the DiagnosticsPingEvent
+func (router *Router) OnDiagnosticsPing(fn func(ctx context.Context, pl DiagnosticsPingPayload) error) {
+	router.On(DiagnosticsPingEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(DiagnosticsPingPayload))
+	})
+}
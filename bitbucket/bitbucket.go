@@ -7,6 +7,9 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"time"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
 )
 
 // Server Path
@@ -25,9 +28,32 @@ var (
 	ErrUUIDVerificationFailed   = errors.New("UUID verification failed")
 )
 
+// outcomes label the parse errors reported to the ParseObserver
+var outcomes = map[error]string{
+	ErrEventNotSpecifiedToParse: "event_not_specified_to_parse",
+	ErrInvalidHTTPMethod:        "invalid_http_method",
+	ErrMissingHookUUIDHeader:    "missing_hook_uuid_header",
+	ErrMissingEventKeyHeader:    "missing_event_key_header",
+	ErrEventNotFound:            webhooks.OutcomeEventNotFound,
+	ErrParsingPayload:           "parsing_payload",
+	ErrUUIDVerificationFailed:   "uuid_verification_failed",
+}
+
+// verificationErrors are the parse errors of deliveries failing verification
+var verificationErrors = []error{
+	ErrMissingHookUUIDHeader,
+	ErrUUIDVerificationFailed,
+}
+
 // Webhook instance contains all methods needed to process events
 type Webhook struct {
-	uuid string
+	uuids        webhooks.Secrets
+	observer     webhooks.ParseObserver
+	logger       webhooks.Logger
+	logBodies    bool
+	maxBodyBytes int64
+	catchAll     bool
+	drift        []webhooks.DriftObserver
 }
 
 // Event defines a Bitbucket hook event type
@@ -64,17 +90,83 @@ var Options = WebhookOptions{}
 // WebhookOptions is a namespace for configuration option methods
 type WebhookOptions struct{}
 
-// UUID registers the BitBucket secret
+// UUID registers the BitBucket secret, it may be combined with other UUIDs to rotate them
 func (WebhookOptions) UUID(uuid string) Option {
 	return func(hook *Webhook) error {
-		hook.uuid = uuid
+		hook.uuids = hook.uuids.Add(webhooks.Secret{Value: uuid})
+		return nil
+	}
+}
+
+// UUIDs registers several hook UUIDs, deliveries carrying any unexpired UUID are
+// accepted and the matching label is reported by ParseDelivery
+func (WebhookOptions) UUIDs(uuids ...webhooks.Secret) Option {
+	return func(hook *Webhook) error {
+		hook.uuids = hook.uuids.Add(uuids...)
+		return nil
+	}
+}
+
+// Observer registers the observer notified of the outcome of every delivery
+// handed to a Parse method, e.g. the metrics collector of the metrics package
+func (WebhookOptions) Observer(observer webhooks.ParseObserver) Option {
+	return func(hook *Webhook) error {
+		hook.observer = observer
+		return nil
+	}
+}
+
+// Logger registers the logger of verification failures, unknown events and
+// decode errors, nothing is logged by default
+func (WebhookOptions) Logger(logger webhooks.Logger) Option {
+	return func(hook *Webhook) error {
+		hook.logger = logger
+		return nil
+	}
+}
+
+// LogBodies adds the delivery bodies to the log records, they may carry secrets
+// and personal data so they are never logged otherwise
+func (WebhookOptions) LogBodies() Option {
+	return func(hook *Webhook) error {
+		hook.logBodies = true
+		return nil
+	}
+}
+
+// MaxBodyBytes sets the size limit of the delivery bodies, larger deliveries are
+// rejected with webhooks.ErrPayloadTooLarge. The limit is webhooks.DefaultMaxBodyBytes
+// by default and 0 or less disables it
+func (WebhookOptions) MaxBodyBytes(max int64) Option {
+	return func(hook *Webhook) error {
+		hook.maxBodyBytes = max
+		return nil
+	}
+}
+
+// CatchAll returns the deliveries of events that weren't specified to Parse or
+// that this package doesn't know as a webhooks.RawEvent instead of an error,
+// they are verified like any other delivery
+func (WebhookOptions) CatchAll() Option {
+	return func(hook *Webhook) error {
+		hook.catchAll = true
+		return nil
+	}
+}
+
+// Strict reports the payload fields that don't map onto the payload structs, and
+// the struct fields absent from the payloads, to the observers, e.g. the metrics
+// collector of the metrics package. The deliveries aren't rejected for it
+func (WebhookOptions) Strict(observers ...webhooks.DriftObserver) Option {
+	return func(hook *Webhook) error {
+		hook.drift = append(hook.drift, observers...)
 		return nil
 	}
 }
 
 // New creates and returns a WebHook instance denoted by the Provider type
 func New(options ...Option) (*Webhook, error) {
-	hook := new(Webhook)
+	hook := &Webhook{maxBodyBytes: webhooks.DefaultMaxBodyBytes}
 	for _, opt := range options {
 		if err := opt(hook); err != nil {
 			return nil, errors.New("Error applying Option")
@@ -83,12 +175,84 @@ func New(options ...Option) (*Webhook, error) {
 	return hook, nil
 }
 
+// events parsed by ParseAny
+var allEvents = []Event{
+	RepoPushEvent,
+	RepoForkEvent,
+	RepoUpdatedEvent,
+	RepoCommitCommentCreatedEvent,
+	RepoCommitStatusCreatedEvent,
+	RepoCommitStatusUpdatedEvent,
+	IssueCreatedEvent,
+	IssueUpdatedEvent,
+	IssueCommentCreatedEvent,
+	PullRequestCreatedEvent,
+	PullRequestUpdatedEvent,
+	PullRequestApprovedEvent,
+	PullRequestUnapprovedEvent,
+	PullRequestMergedEvent,
+	PullRequestDeclinedEvent,
+	PullRequestCommentCreatedEvent,
+	PullRequestCommentUpdatedEvent,
+	PullRequestCommentDeletedEvent,
+}
+
+// knownEvent reports whether the event is parsed into a payload of this package
+func knownEvent(event Event) bool {
+	for _, evt := range allEvents {
+		if evt == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Name returns the provider name, it implements webhooks.Provider
+func (hook Webhook) Name() webhooks.ProviderName {
+	return webhooks.Bitbucket
+}
+
+// ParseAny verifies and parses any known event and returns the payload object or an error
+func (hook Webhook) ParseAny(r *http.Request) (interface{}, error) {
+	return hook.Parse(r, allEvents...)
+}
+
+// ParseDelivery verifies and parses the events specified like Parse and returns the
+// payload together with the delivery metadata and raw body. Once the body has been
+// read the delivery is returned alongside parse errors too
+func (hook Webhook) ParseDelivery(r *http.Request, events ...Event) (delivery *webhooks.Delivery, err error) {
+	var body []byte
+	defer func(start time.Time) {
+		_ = r.Body.Close()
+		hook.report(start, r.Header, body, err)
+	}(time.Now())
+
+	if r.Method != http.MethodPost {
+		return nil, ErrInvalidHTTPMethod
+	}
+
+	body, err = webhooks.ReadBody(r.Body, hook.maxBodyBytes)
+	if err == webhooks.ErrPayloadTooLarge {
+		return nil, err
+	}
+	if err != nil {
+		return nil, ErrParsingPayload
+	}
+	delivery = webhooks.NewDelivery(webhooks.Bitbucket, r.Header, body)
+	var secret webhooks.Secret
+	delivery.Payload, secret, err = hook.parse(r.Header, body, events...)
+	delivery.Secret = secret.Label
+	return delivery, err
+}
+
 // Parse verifies and parses the events specified and returns the payload object or an error
-func (hook Webhook) Parse(r *http.Request, events ...Event) (interface{}, error) {
-	defer func() {
+func (hook Webhook) Parse(r *http.Request, events ...Event) (pl interface{}, err error) {
+	var payload []byte
+	defer func(start time.Time) {
 		_, _ = io.Copy(ioutil.Discard, r.Body)
 		_ = r.Body.Close()
-	}()
+		hook.report(start, r.Header, payload, err)
+	}(time.Now())
 
 	if len(events) == 0 {
 		return nil, ErrEventNotSpecifiedToParse
@@ -97,18 +261,56 @@ func (hook Webhook) Parse(r *http.Request, events ...Event) (interface{}, error)
 		return nil, ErrInvalidHTTPMethod
 	}
 
-	uuid := r.Header.Get("X-Hook-UUID")
-	if hook.uuid != "" && uuid == "" {
-		return nil, ErrMissingHookUUIDHeader
+	payload, err = webhooks.ReadBody(r.Body, hook.maxBodyBytes)
+	if err == webhooks.ErrPayloadTooLarge {
+		return nil, err
+	}
+	if err != nil {
+		return nil, ErrParsingPayload
+	}
+	pl, _, err = hook.parse(r.Header, payload, events...)
+	return pl, err
+}
+
+// ParseBytes verifies and parses the events specified from the delivery headers
+// and body, for deliveries received without an *http.Request
+func (hook Webhook) ParseBytes(headers http.Header, payload []byte, events ...Event) (interface{}, error) {
+	start := time.Now()
+	if hook.maxBodyBytes > 0 && int64(len(payload)) > hook.maxBodyBytes {
+		hook.report(start, headers, payload, webhooks.ErrPayloadTooLarge)
+		return nil, webhooks.ErrPayloadTooLarge
+	}
+	pl, _, err := hook.parse(headers, payload, events...)
+	hook.report(start, headers, payload, err)
+	return pl, err
+}
+
+// parse verifies and parses the events specified and returns the payload object
+// together with the secret that verified it
+func (hook Webhook) parse(headers http.Header, payload []byte, events ...Event) (interface{}, webhooks.Secret, error) {
+	if len(events) == 0 {
+		return nil, webhooks.Secret{}, ErrEventNotSpecifiedToParse
+	}
+
+	uuid := headers.Get("X-Hook-UUID")
+	if len(hook.uuids) > 0 && uuid == "" {
+		return nil, webhooks.Secret{}, ErrMissingHookUUIDHeader
 	}
 
-	event := r.Header.Get("X-Event-Key")
+	event := headers.Get("X-Event-Key")
 	if event == "" {
-		return nil, ErrMissingEventKeyHeader
+		return nil, webhooks.Secret{}, ErrMissingEventKeyHeader
 	}
 
-	if len(hook.uuid) > 0 && uuid != hook.uuid {
-		return nil, ErrUUIDVerificationFailed
+	var secret webhooks.Secret
+	if len(hook.uuids) > 0 {
+		var ok bool
+		secret, ok = hook.uuids.Match(func(secret string) bool {
+			return uuid == secret
+		})
+		if !ok {
+			return nil, webhooks.Secret{}, ErrUUIDVerificationFailed
+		}
 	}
 
 	bitbucketEvent := Event(event)
@@ -120,16 +322,30 @@ func (hook Webhook) Parse(r *http.Request, events ...Event) (interface{}, error)
 			break
 		}
 	}
-	// event not defined to be parsed
-	if !found {
-		return nil, ErrEventNotFound
+	// event not defined to be parsed, unless returned raw in catch-all mode
+	raw := hook.catchAll && (!found || !knownEvent(bitbucketEvent))
+	if !found && !raw {
+		return nil, webhooks.Secret{}, ErrEventNotFound
 	}
 
-	payload, err := ioutil.ReadAll(r.Body)
-	if err != nil || len(payload) == 0 {
-		return nil, ErrParsingPayload
+	if len(payload) == 0 {
+		return nil, webhooks.Secret{}, ErrParsingPayload
+	}
+
+	if raw {
+		pl, err := webhooks.NewRawEvent(string(bitbucketEvent), headers, payload)
+		return pl, secret, err
+	}
+	pl, err := parsePayload(bitbucketEvent, payload)
+	if err == nil {
+		webhooks.ReportDrift(hook.drift, webhooks.Bitbucket, string(bitbucketEvent), webhooks.DeliveryID(headers), payload, pl)
 	}
+	return pl, secret, err
+}
 
+// parsePayload decodes the payload of the event
+func parsePayload(bitbucketEvent Event, payload []byte) (interface{}, error) {
+	var err error
 	switch bitbucketEvent {
 	case RepoPushEvent:
 		var pl RepoPushPayload
@@ -207,3 +423,36 @@ func (hook Webhook) Parse(r *http.Request, events ...Event) (interface{}, error)
 		return nil, fmt.Errorf("unknown event %s", bitbucketEvent)
 	}
 }
+
+// report notifies the registered observer and logger of the outcome of a delivery,
+// events missing from allEvents are reported as unknown to bound the label values
+func (hook Webhook) report(start time.Time, headers http.Header, payload []byte, err error) {
+	if hook.observer == nil && hook.logger == nil {
+		return
+	}
+	event := webhooks.UnknownEvent
+	for _, evt := range allEvents {
+		if string(evt) == headers.Get("X-Event-Key") {
+			event = string(evt)
+			break
+		}
+	}
+	o := webhooks.ParseObservation{
+		Provider:           webhooks.Bitbucket,
+		Event:              event,
+		Outcome:            webhooks.Outcome(err, outcomes),
+		VerificationFailed: webhooks.VerificationFailed(err, verificationErrors),
+		Size:               len(payload),
+		Duration:           time.Since(start),
+	}
+	if hook.observer != nil {
+		hook.observer.ObserveParse(o)
+	}
+	if hook.logger != nil {
+		var body []byte
+		if hook.logBodies {
+			body = payload
+		}
+		webhooks.LogParse(hook.logger, o, webhooks.DeliveryID(headers), err, body)
+	}
+}
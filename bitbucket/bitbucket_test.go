@@ -2,6 +2,7 @@ package bitbucket
 
 import (
 	"bytes"
+	"context"
 	"log"
 	"net/http"
 	"net/http/httptest"
@@ -13,6 +14,8 @@ import (
 	"reflect"
 
 	"github.com/stretchr/testify/require"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
 )
 
 // NOTES:
@@ -355,3 +358,167 @@ func TestWebhooks(t *testing.T) {
 		})
 	}
 }
+
+func TestParseDelivery(t *testing.T) {
+	assert := require.New(t)
+	body, err := os.ReadFile("../testdata/bitbucket/repo-push.json")
+	assert.NoError(err)
+
+	req := httptest.NewRequest(http.MethodPost, ServerPath, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Bitbucket-Webhooks/2.0")
+	req.Header.Set("X-Event-Key", "repo:push")
+	req.Header.Set("X-Hook-UUID", "MY_UUID")
+	req.Header.Set("X-Request-UUID", "afe3b4c1-4aab-4f6c-ae6d-2b4e5b1e0a5e")
+	delivery, err := hook.ParseDelivery(req, RepoPushEvent)
+	assert.NoError(err)
+	assert.Equal(webhooks.Bitbucket, delivery.Provider)
+	assert.Equal("afe3b4c1-4aab-4f6c-ae6d-2b4e5b1e0a5e", delivery.ID)
+	assert.Equal("MY_UUID", delivery.HookID)
+	assert.Equal("repo:push", delivery.Event)
+	assert.Equal("Bitbucket-Webhooks/2.0", delivery.UserAgent)
+	assert.Equal(body, delivery.Body)
+	assert.False(delivery.ReceivedAt.IsZero())
+	assert.IsType(RepoPushPayload{}, delivery.Payload)
+
+	// the delivery is returned alongside the errors once the body has been read
+	req = httptest.NewRequest(http.MethodPost, ServerPath, bytes.NewReader(body))
+	req.Header.Set("X-Event-Key", "repo:push")
+	req.Header.Set("X-Hook-UUID", "OTHER_UUID")
+	delivery, err = hook.ParseDelivery(req, RepoPushEvent)
+	assert.Equal(ErrUUIDVerificationFailed, err)
+	assert.Equal(body, delivery.Body)
+	assert.Nil(delivery.Payload)
+}
+
+func TestParseBytes(t *testing.T) {
+	assert := require.New(t)
+	body, err := os.ReadFile("../testdata/bitbucket/repo-push.json")
+	assert.NoError(err)
+
+	tests := []struct {
+		name    string
+		headers http.Header
+		body    []byte
+		err     error
+	}{
+		{
+			name: "Verified",
+			headers: http.Header{
+				"X-Event-Key": []string{"repo:push"},
+				"X-Hook-Uuid": []string{"MY_UUID"},
+			},
+			body: body,
+		},
+		{
+			name: "BadUUID",
+			headers: http.Header{
+				"X-Event-Key": []string{"repo:push"},
+				"X-Hook-Uuid": []string{"OTHER_UUID"},
+			},
+			body: body,
+			err:  ErrUUIDVerificationFailed,
+		},
+		{
+			name: "MissingUUID",
+			headers: http.Header{
+				"X-Event-Key": []string{"repo:push"},
+			},
+			body: body,
+			err:  ErrMissingHookUUIDHeader,
+		},
+		{
+			name: "UnknownEvent",
+			headers: http.Header{
+				"X-Event-Key": []string{"repo:fork"},
+				"X-Hook-Uuid": []string{"MY_UUID"},
+			},
+			body: body,
+			err:  ErrEventNotFound,
+		},
+		{
+			name: "EmptyBody",
+			headers: http.Header{
+				"X-Event-Key": []string{"repo:push"},
+				"X-Hook-Uuid": []string{"MY_UUID"},
+			},
+			err: ErrParsingPayload,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			results, err := hook.ParseBytes(tc.headers, tc.body, RepoPushEvent)
+			if tc.err != nil {
+				assert.Equal(tc.err, err)
+				return
+			}
+			assert.NoError(err)
+			assert.IsType(RepoPushPayload{}, results)
+		})
+	}
+}
+
+func TestRouter(t *testing.T) {
+	assert := require.New(t)
+	payload, err := os.ReadFile("../testdata/bitbucket/repo-push.json")
+	assert.NoError(err)
+
+	var repository string
+	router := NewRouter(hook)
+	router.OnRepoPush(func(ctx context.Context, pl RepoPushPayload) error {
+		repository = pl.Repository.FullName
+		return nil
+	})
+
+	tests := []struct {
+		name  string
+		event string
+		uuid  string
+		code  int
+	}{
+		{
+			name:  "Dispatched",
+			event: "repo:push",
+			uuid:  "MY_UUID",
+			code:  http.StatusOK,
+		},
+		{
+			name:  "Unregistered",
+			event: "repo:fork",
+			uuid:  "MY_UUID",
+			code:  http.StatusNoContent,
+		},
+		{
+			name:  "VerificationFailed",
+			event: "repo:push",
+			uuid:  "OTHER_UUID",
+			code:  http.StatusUnauthorized,
+		},
+		{
+			name:  "MissingUUID",
+			event: "repo:push",
+			code:  http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range tests {
+		repository = ""
+		req := httptest.NewRequest(http.MethodPost, ServerPath, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Event-Key", tc.event)
+		if tc.uuid != "" {
+			req.Header.Set("X-Hook-UUID", tc.uuid)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(tc.code, w.Code, tc.name)
+		if tc.code == http.StatusOK {
+			assert.Equal("team_name/repo_name", repository)
+		} else {
+			assert.Empty(repository, tc.name)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package bitbucket
+
+import (
+	webhooks "github.com/heitormejias/golang-webhooks"
+)
+
+// Normalize converts a payload returned by Parse into the provider agnostic
+// normalized events, webhooks.ErrNotNormalizable is returned for payloads
+// without a normalized form.
+//
+// A single repo:push may carry several ref changes, one normalized event is
+// returned per change, tag changes are returned as webhooks.NormalizedTag
+func Normalize(payload interface{}) ([]webhooks.NormalizedEvent, error) {
+	switch pl := payload.(type) {
+	case RepoPushPayload:
+		return normalizePush(pl), nil
+	case IssueCreatedPayload:
+		return []webhooks.NormalizedEvent{normalizeIssue(webhooks.ActionOpened, pl.Issue, pl.Repository, pl.Actor)}, nil
+	case IssueUpdatedPayload:
+		return []webhooks.NormalizedEvent{normalizeIssue(webhooks.ActionUpdated, pl.Issue, pl.Repository, pl.Actor)}, nil
+	case PullRequestCreatedPayload:
+		return []webhooks.NormalizedEvent{normalizePullRequest(webhooks.ActionOpened, pl.PullRequest, pl.Repository, pl.Actor)}, nil
+	case PullRequestUpdatedPayload:
+		return []webhooks.NormalizedEvent{normalizePullRequest(webhooks.ActionUpdated, pl.PullRequest, pl.Repository, pl.Actor)}, nil
+	case PullRequestMergedPayload:
+		return []webhooks.NormalizedEvent{normalizePullRequest(webhooks.ActionMerged, pl.PullRequest, pl.Repository, pl.Actor)}, nil
+	case PullRequestDeclinedPayload:
+		return []webhooks.NormalizedEvent{normalizePullRequest(webhooks.ActionClosed, pl.PullRequest, pl.Repository, pl.Actor)}, nil
+	default:
+		return nil, webhooks.ErrNotNormalizable
+	}
+}
+
+// Normalize converts a payload returned by Parse into normalized events, it implements webhooks.Provider
+func (hook Webhook) Normalize(payload interface{}) ([]webhooks.NormalizedEvent, error) {
+	return Normalize(payload)
+}
+
+func normalizeRepository(r Repository) webhooks.NormalizedRepository {
+	return webhooks.NormalizedRepository{
+		Name:     r.Name,
+		FullName: r.FullName,
+		HTMLURL:  r.Links.HTML.Href,
+		Private:  r.IsPrivate,
+	}
+}
+
+func normalizeUser(o Owner) webhooks.NormalizedUser {
+	return webhooks.NormalizedUser{Login: o.NickName, Name: o.DisplayName}
+}
+
+func normalizePush(pl RepoPushPayload) []webhooks.NormalizedEvent {
+	var events []webhooks.NormalizedEvent
+	for _, change := range pl.Push.Changes {
+		// the new state is empty when the ref is deleted
+		refType, name := change.New.Type, change.New.Name
+		if refType == "" {
+			refType, name = change.Old.Type, change.Old.Name
+		}
+
+		if refType == "tag" {
+			tag := webhooks.NormalizedTag{
+				Provider:   webhooks.Bitbucket,
+				Repository: normalizeRepository(pl.Repository),
+				Action:     webhooks.ActionCreated,
+				Name:       name,
+				SHA:        change.New.Target.Hash,
+				Sender:     normalizeUser(pl.Actor),
+			}
+			if change.Closed {
+				tag.Action = webhooks.ActionDeleted
+				tag.SHA = change.Old.Target.Hash
+			}
+			events = append(events, tag)
+			continue
+		}
+
+		push := webhooks.NormalizedPush{
+			Provider:   webhooks.Bitbucket,
+			Repository: normalizeRepository(pl.Repository),
+			Ref:        "refs/heads/" + name,
+			Before:     change.Old.Target.Hash,
+			After:      change.New.Target.Hash,
+			Created:    change.Created,
+			Deleted:    change.Closed,
+			Forced:     change.Forced,
+			CompareURL: change.Links.HTML.Href,
+			Sender:     normalizeUser(pl.Actor),
+		}
+		for _, c := range change.Commits {
+			push.Commits = append(push.Commits, webhooks.NormalizedCommit{
+				ID:      c.Hash,
+				Message: c.Message,
+				URL:     c.Links.HTML.Href,
+				Author:  normalizeUser(c.Author),
+			})
+		}
+		events = append(events, push)
+	}
+	return events
+}
+
+func normalizeIssue(action string, issue Issue, repository Repository, actor Owner) webhooks.NormalizedIssue {
+	return webhooks.NormalizedIssue{
+		Provider:   webhooks.Bitbucket,
+		Repository: normalizeRepository(repository),
+		Action:     action,
+		Number:     issue.ID,
+		Title:      issue.Title,
+		Body:       issue.Content.Raw,
+		HTMLURL:    issue.Links.HTML.Href,
+		State:      issue.State,
+		Sender:     normalizeUser(actor),
+	}
+}
+
+func normalizePullRequest(action string, pr PullRequest, repository Repository, actor Owner) webhooks.NormalizedPullRequest {
+	return webhooks.NormalizedPullRequest{
+		Provider:     webhooks.Bitbucket,
+		Repository:   normalizeRepository(repository),
+		Action:       action,
+		Number:       pr.ID,
+		Title:        pr.Title,
+		Body:         pr.Description,
+		HTMLURL:      pr.Links.HTML.Href,
+		State:        pr.State,
+		Merged:       pr.State == "MERGED",
+		SourceBranch: pr.Source.Branch.Name,
+		TargetBranch: pr.Destination.Branch.Name,
+		HeadSHA:      pr.Source.Commit.Hash,
+		Author:       normalizeUser(pr.Author),
+		Sender:       normalizeUser(actor),
+	}
+}
@@ -0,0 +1,211 @@
+package bitbucket
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+)
+
+// HandlerFunc handles the payload returned by Parse for a registered event
+type HandlerFunc func(ctx context.Context, payload interface{}) error
+
+// Router dispatches the Bitbucket deliveries to the callbacks registered per event, the
+// events to parse are derived from the registered callbacks. It implements http.Handler
+type Router struct {
+	hook     *Webhook
+	handlers map[Event]HandlerFunc
+}
+
+// NewRouter creates and returns a Router parsing the deliveries with the given Webhook
+func NewRouter(hook *Webhook) *Router {
+	return &Router{
+		hook:     hook,
+		handlers: make(map[Event]HandlerFunc),
+	}
+}
+
+// On registers the callback for the given event, registering an event twice
+// replaces the previous callback. Callbacks must be registered before serving
+func (router *Router) On(event Event, fn HandlerFunc) {
+	router.handlers[event] = fn
+}
+
+// ServeHTTP parses the delivery and calls the callback registered for its event.
+//
+// Events without callback are answered with 204 No Content, invalid methods with
+// 405 Method Not Allowed, failed verifications with 401 Unauthorized and malformed
+// deliveries with 400 Bad Request. Callback errors are answered with 500 Internal
+// Server Error unless they are a webhooks.StatusError
+func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	events := make([]Event, 0, len(router.handlers))
+	for event := range router.handlers {
+		events = append(events, event)
+	}
+
+	payload, err := router.hook.Parse(r, events...)
+	if err != nil {
+		code := StatusCode(err)
+		if code == http.StatusNoContent {
+			w.WriteHeader(code)
+			return
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	handler, ok := router.handlers[Event(r.Header.Get("X-Event-Key"))]
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err := handler(r.Context(), payload); err != nil {
+		code := webhooks.StatusCode(err)
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// StatusCode maps the errors returned by Parse onto HTTP status codes
+func StatusCode(err error) int {
+	switch {
+	case errors.Is(err, ErrEventNotFound), errors.Is(err, ErrEventNotSpecifiedToParse):
+		return http.StatusNoContent
+	case errors.Is(err, ErrInvalidHTTPMethod):
+		return http.StatusMethodNotAllowed
+	case errors.Is(err, webhooks.ErrPayloadTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrMissingHookUUIDHeader), errors.Is(err, ErrUUIDVerificationFailed):
+		return http.StatusUnauthorized
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// OnRepoPush registers the callback for the RepoPushEvent
+func (router *Router) OnRepoPush(fn func(ctx context.Context, pl RepoPushPayload) error) {
+	router.On(RepoPushEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(RepoPushPayload))
+	})
+}
+
+// OnRepoFork registers the callback for the RepoForkEvent
+func (router *Router) OnRepoFork(fn func(ctx context.Context, pl RepoForkPayload) error) {
+	router.On(RepoForkEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(RepoForkPayload))
+	})
+}
+
+// OnRepoUpdated registers the callback for the RepoUpdatedEvent
+func (router *Router) OnRepoUpdated(fn func(ctx context.Context, pl RepoUpdatedPayload) error) {
+	router.On(RepoUpdatedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(RepoUpdatedPayload))
+	})
+}
+
+// OnRepoCommitCommentCreated registers the callback for the RepoCommitCommentCreatedEvent
+func (router *Router) OnRepoCommitCommentCreated(fn func(ctx context.Context, pl RepoCommitCommentCreatedPayload) error) {
+	router.On(RepoCommitCommentCreatedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(RepoCommitCommentCreatedPayload))
+	})
+}
+
+// OnRepoCommitStatusCreated registers the callback for the RepoCommitStatusCreatedEvent
+func (router *Router) OnRepoCommitStatusCreated(fn func(ctx context.Context, pl RepoCommitStatusCreatedPayload) error) {
+	router.On(RepoCommitStatusCreatedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(RepoCommitStatusCreatedPayload))
+	})
+}
+
+// OnRepoCommitStatusUpdated registers the callback for the RepoCommitStatusUpdatedEvent
+func (router *Router) OnRepoCommitStatusUpdated(fn func(ctx context.Context, pl RepoCommitStatusUpdatedPayload) error) {
+	router.On(RepoCommitStatusUpdatedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(RepoCommitStatusUpdatedPayload))
+	})
+}
+
+// OnIssueCreated registers the callback for the IssueCreatedEvent
+func (router *Router) OnIssueCreated(fn func(ctx context.Context, pl IssueCreatedPayload) error) {
+	router.On(IssueCreatedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(IssueCreatedPayload))
+	})
+}
+
+// OnIssueUpdated registers the callback for the IssueUpdatedEvent
+func (router *Router) OnIssueUpdated(fn func(ctx context.Context, pl IssueUpdatedPayload) error) {
+	router.On(IssueUpdatedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(IssueUpdatedPayload))
+	})
+}
+
+// OnIssueCommentCreated registers the callback for the IssueCommentCreatedEvent
+func (router *Router) OnIssueCommentCreated(fn func(ctx context.Context, pl IssueCommentCreatedPayload) error) {
+	router.On(IssueCommentCreatedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(IssueCommentCreatedPayload))
+	})
+}
+
+// OnPullRequestCreated registers the callback for the PullRequestCreatedEvent
+func (router *Router) OnPullRequestCreated(fn func(ctx context.Context, pl PullRequestCreatedPayload) error) {
+	router.On(PullRequestCreatedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PullRequestCreatedPayload))
+	})
+}
+
+// OnPullRequestUpdated registers the callback for the PullRequestUpdatedEvent
+func (router *Router) OnPullRequestUpdated(fn func(ctx context.Context, pl PullRequestUpdatedPayload) error) {
+	router.On(PullRequestUpdatedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PullRequestUpdatedPayload))
+	})
+}
+
+// OnPullRequestApproved registers the callback for the PullRequestApprovedEvent
+func (router *Router) OnPullRequestApproved(fn func(ctx context.Context, pl PullRequestApprovedPayload) error) {
+	router.On(PullRequestApprovedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PullRequestApprovedPayload))
+	})
+}
+
+// OnPullRequestUnapproved registers the callback for the PullRequestUnapprovedEvent
+func (router *Router) OnPullRequestUnapproved(fn func(ctx context.Context, pl PullRequestUnapprovedPayload) error) {
+	router.On(PullRequestUnapprovedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PullRequestUnapprovedPayload))
+	})
+}
+
+// OnPullRequestMerged registers the callback for the PullRequestMergedEvent
+func (router *Router) OnPullRequestMerged(fn func(ctx context.Context, pl PullRequestMergedPayload) error) {
+	router.On(PullRequestMergedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PullRequestMergedPayload))
+	})
+}
+
+// OnPullRequestDeclined registers the callback for the PullRequestDeclinedEvent
+func (router *Router) OnPullRequestDeclined(fn func(ctx context.Context, pl PullRequestDeclinedPayload) error) {
+	router.On(PullRequestDeclinedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PullRequestDeclinedPayload))
+	})
+}
+
+// OnPullRequestCommentCreated registers the callback for the PullRequestCommentCreatedEvent
+func (router *Router) OnPullRequestCommentCreated(fn func(ctx context.Context, pl PullRequestCommentCreatedPayload) error) {
+	router.On(PullRequestCommentCreatedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PullRequestCommentCreatedPayload))
+	})
+}
+
+// OnPullRequestCommentUpdated registers the callback for the PullRequestCommentUpdatedEvent
+func (router *Router) OnPullRequestCommentUpdated(fn func(ctx context.Context, pl PullRequestCommentUpdatedPayload) error) {
+	router.On(PullRequestCommentUpdatedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PullRequestCommentUpdatedPayload))
+	})
+}
+
+// OnPullRequestCommentDeleted registers the callback for the PullRequestCommentDeletedEvent
+func (router *Router) OnPullRequestCommentDeleted(fn func(ctx context.Context, pl PullRequestCommentDeletedPayload) error) {
+	router.On(PullRequestCommentDeletedEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PullRequestCommentDeletedPayload))
+	})
+}
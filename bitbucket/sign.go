@@ -0,0 +1,30 @@
+package bitbucket
+
+import (
+	"bytes"
+	"net/http"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+)
+
+// NewRequest returns a POST request to url delivering the payload as the given
+// event with the headers Bitbucket sends, carrying the hook UUID when it is not
+// empty. The payload is encoded as by webhooks.MarshalPayload
+func NewRequest(url string, event Event, payload interface{}, uuid string) (*http.Request, error) {
+	body, err := webhooks.MarshalPayload(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Bitbucket-Webhooks/2.0")
+	req.Header.Set("X-Event-Key", string(event))
+	req.Header.Set("X-Request-UUID", webhooks.NewDeliveryID())
+	if uuid != "" {
+		req.Header.Set("X-Hook-UUID", uuid)
+	}
+	return req, nil
+}
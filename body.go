@@ -0,0 +1,55 @@
+package webhooks
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// DefaultMaxBodyBytes is the body size limit of the provider Webhooks, the size
+// of the largest payload GitHub delivers
+const DefaultMaxBodyBytes = 25 << 20
+
+// ErrPayloadTooLarge is returned for bodies larger than the configured limit
+var ErrPayloadTooLarge = errors.New("payload too large")
+
+// LimitReader returns a reader of r failing with ErrPayloadTooLarge once more
+// than max bytes were read, max <= 0 disables the limit
+func LimitReader(r io.Reader, max int64) io.Reader {
+	if max <= 0 {
+		return r
+	}
+	return &limitReader{r: r, remaining: max}
+}
+
+type limitReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, ErrPayloadTooLarge
+	}
+	// read one byte past the limit to tell a body of exactly max bytes from a larger one
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n + int(l.remaining), ErrPayloadTooLarge
+	}
+	return n, err
+}
+
+// ReadBody reads r up to max bytes, ErrPayloadTooLarge is returned for larger
+// bodies and max <= 0 disables the limit
+func ReadBody(r io.Reader, max int64) ([]byte, error) {
+	var b bytes.Buffer
+	_, err := b.ReadFrom(LimitReader(r, max))
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
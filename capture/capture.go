@@ -0,0 +1,359 @@
+// Package capture records real deliveries as testdata fixtures, redacted and
+// named like the fixtures of the webhookstest package, so the fixtures can be
+// refreshed from production traffic
+package capture
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+	"github.com/heitormejias/golang-webhooks/webhookstest"
+)
+
+// ErrInvalidJSON is returned for bodies that aren't JSON, or no longer are once redacted
+var ErrInvalidJSON = errors.New("body is not valid JSON")
+
+// Redacted replaces the redacted secrets
+const Redacted = "REDACTED"
+
+// Replacements of the private repository names
+const (
+	PrivateFullName = "example/private-repository"
+	PrivateName     = "private-repository"
+)
+
+// Rule redacts the matches of Pattern in the raw body with Replacement, $1 style
+// submatch references are expanded. The body must still be valid JSON afterwards
+type Rule struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// DefaultRules redact email addresses, GitHub, GitLab and Slack tokens and the
+// values of fields named like credentials
+var DefaultRules = []Rule{
+	// git@host:owner/repo and https://user@host/ URLs are kept
+	{
+		Pattern:     regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)+([^:/A-Za-z0-9.\-]|$)`),
+		Replacement: "user@example.com$1",
+	},
+	{
+		Pattern:     regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,}|glpat-[A-Za-z0-9_\-]{20,}|xox[abprs]-[A-Za-z0-9\-]{10,})`),
+		Replacement: Redacted,
+	},
+	{
+		Pattern:     regexp.MustCompile(`("(?i:token|secret|password|api_key|private_key|access_token|refresh_token|client_secret)"\s*:\s*)"(?:[^"\\]|\\.)*"`),
+		Replacement: `$1"` + Redacted + `"`,
+	},
+}
+
+// headers are the event and delivery headers kept by provider besides
+// Content-Type and User-Agent, signatures, tokens and any other header are dropped
+var headers = map[webhooks.ProviderName][]string{
+	webhooks.GitHub: {
+		"X-GitHub-Event",
+		"X-GitHub-Delivery",
+		"X-GitHub-Hook-ID",
+		"X-GitHub-Hook-Installation-Target-ID",
+		"X-GitHub-Hook-Installation-Target-Type",
+	},
+	webhooks.GitLab:          {"X-Gitlab-Event", "X-Gitlab-Event-UUID", "X-Gitlab-Webhook-UUID"},
+	webhooks.Gitea:           {"X-Gitea-Event", "X-Gitea-Event-Type", "X-Gitea-Delivery"},
+	webhooks.Gogs:            {"X-Gogs-Event", "X-Gogs-Delivery"},
+	webhooks.Bitbucket:       {"X-Event-Key", "X-Request-UUID", "X-Attempt-Number"},
+	webhooks.BitbucketServer: {"X-Event-Key", "X-Request-Id"},
+}
+
+// Option is a configuration option for the recorder
+type Option func(*Recorder) error
+
+// Options is a namespace var for configuration options
+var Options = RecorderOptions{}
+
+// RecorderOptions is a namespace for configuration option methods
+type RecorderOptions struct{}
+
+// Rules registers redaction rules applied after DefaultRules
+func (RecorderOptions) Rules(rules ...Rule) Option {
+	return func(rec *Recorder) error {
+		rec.rules = append(rec.rules, rules...)
+		return nil
+	}
+}
+
+// PrivateRepositories registers the full names of repositories redacted like the
+// repositories the payloads flag as private, e.g. owner/repo
+func (RecorderOptions) PrivateRepositories(names ...string) Option {
+	return func(rec *Recorder) error {
+		rec.private = append(rec.private, names...)
+		return nil
+	}
+}
+
+// Logger registers the logger of the deliveries that couldn't be recorded by
+// Middleware and Recording, nothing is logged by default
+func (RecorderOptions) Logger(logger webhooks.Logger) Option {
+	return func(rec *Recorder) error {
+		rec.logger = logger
+		return nil
+	}
+}
+
+// Recorder writes the deliveries to dir, the last delivery of an event replacing
+// the previous one: the body, redacted and indented, to the fixture named by
+// webhookstest.DeliveryFixturePath, e.g. github/pull-request.json, and the
+// headers without credentials to the file of the same name with the .headers
+// extension.
+//
+// Besides the rules, the full names of the repositories the payloads flag as
+// private are replaced by PrivateFullName and their names by PrivateName
+type Recorder struct {
+	dir     string
+	rules   []Rule
+	private []string
+	logger  webhooks.Logger
+}
+
+// New creates and returns a Recorder writing to dir, usually the testdata directory
+// of a checkout of this module
+func New(dir string, options ...Option) (*Recorder, error) {
+	rec := &Recorder{
+		dir:   dir,
+		rules: append([]Rule(nil), DefaultRules...),
+	}
+	for _, opt := range options {
+		if err := opt(rec); err != nil {
+			return nil, err
+		}
+	}
+	return rec, nil
+}
+
+// Record writes the fixture of the delivery and returns its path
+func (rec *Recorder) Record(delivery *webhooks.Delivery) (string, error) {
+	name, err := webhookstest.DeliveryFixturePath(delivery.Provider, delivery.Event, delivery.Body)
+	if err != nil {
+		return "", err
+	}
+	body, err := rec.Redact(delivery.Body)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(rec.dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	var header bytes.Buffer
+	if err := Headers(delivery.Provider, delivery.Header).Write(&header); err != nil {
+		return "", err
+	}
+	if err := writeFile(strings.TrimSuffix(path, ".json")+".headers", header.Bytes()); err != nil {
+		return "", err
+	}
+	if err := writeFile(path, body); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// writeFile replaces the file at once so fixtures are never left half written
+func writeFile(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Redact returns the body redacted and indented with two spaces, the field
+// order is kept
+func (rec *Recorder) Redact(body []byte) ([]byte, error) {
+	var tree interface{}
+	if err := json.Unmarshal(body, &tree); err != nil {
+		return nil, ErrInvalidJSON
+	}
+
+	redacted := body
+	for _, rule := range rec.rules {
+		redacted = rule.Pattern.ReplaceAll(redacted, []byte(rule.Replacement))
+	}
+	fullNames, names := privateRepositories(tree)
+	fullNames = append(fullNames, rec.private...)
+	for _, fullName := range fullNames {
+		redacted = bytes.ReplaceAll(redacted, []byte(fullName), []byte(PrivateFullName))
+		if i := strings.LastIndexByte(fullName, '/'); i >= 0 {
+			names = append(names, fullName[i+1:])
+		}
+	}
+	for _, name := range names {
+		quoted, _ := json.Marshal(name)
+		redacted = bytes.ReplaceAll(redacted, quoted, []byte(`"`+PrivateName+`"`))
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, redacted, "", "  "); err != nil {
+		return nil, ErrInvalidJSON
+	}
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
+
+// privateRepositories returns the full names and names of the objects of the
+// payload flagged as private: "private": true for GitHub, Gitea and Gogs,
+// "is_private": true for Bitbucket, "visibility_level": 0 for GitLab and
+// "public": false for Bitbucket Server
+func privateRepositories(value interface{}) (fullNames, names []string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if isPrivate(v) {
+			for _, key := range []string{"full_name", "path_with_namespace"} {
+				if s, ok := v[key].(string); ok && s != "" {
+					fullNames = append(fullNames, s)
+				}
+			}
+			for _, key := range []string{"name", "slug", "path"} {
+				if s, ok := v[key].(string); ok && s != "" {
+					names = append(names, s)
+				}
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			f, n := privateRepositories(v[key])
+			fullNames, names = append(fullNames, f...), append(names, n...)
+		}
+	case []interface{}:
+		for _, e := range v {
+			f, n := privateRepositories(e)
+			fullNames, names = append(fullNames, f...), append(names, n...)
+		}
+	}
+	return fullNames, names
+}
+
+func isPrivate(object map[string]interface{}) bool {
+	if private, ok := object["private"].(bool); ok && private {
+		return true
+	}
+	if private, ok := object["is_private"].(bool); ok && private {
+		return true
+	}
+	if level, ok := object["visibility_level"].(float64); ok && level == 0 {
+		return true
+	}
+	// Bitbucket Server repositories have a slug, their projects are public too
+	_, repository := object["slug"]
+	public, ok := object["public"].(bool)
+	return repository && ok && !public
+}
+
+// Headers returns the Content-Type, User-Agent and event and delivery headers of
+// the provider, the other headers may carry credentials or internal host names
+func Headers(provider webhooks.ProviderName, header http.Header) http.Header {
+	sanitized := make(http.Header)
+	for _, key := range append([]string{"Content-Type", "User-Agent"}, headers[provider]...) {
+		if values := header.Values(key); len(values) > 0 {
+			sanitized[http.CanonicalHeaderKey(key)] = append([]string(nil), values...)
+		}
+	}
+	return sanitized
+}
+
+// Recording wraps a ParseDelivery style function so every verified delivery it
+// returns is recorded, recording errors are logged and don't fail the delivery
+func (rec *Recorder) Recording(parse func(r *http.Request) (*webhooks.Delivery, error)) func(r *http.Request) (*webhooks.Delivery, error) {
+	return func(r *http.Request) (*webhooks.Delivery, error) {
+		delivery, err := parse(r)
+		if err != nil {
+			return delivery, err
+		}
+		rec.record(delivery)
+		return delivery, nil
+	}
+}
+
+// Middleware records the deliveries next answers with a 2xx status code, so
+// deliveries failing verification aren't recorded. The provider is detected from
+// the headers, Docker deliveries aren't recorded
+func (rec *Recorder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provider, err := webhooks.Detect(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := ioutil.ReadAll(webhooks.LimitReader(r.Body, webhooks.DefaultMaxBodyBytes))
+		// the handler reads what is left as it would have
+		r.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(body), r.Body), Closer: r.Body}
+		sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		if err != nil || sw.code < 200 || sw.code > 299 {
+			return
+		}
+		rec.record(webhooks.NewDelivery(provider, r.Header, body))
+	})
+}
+
+func (rec *Recorder) record(delivery *webhooks.Delivery) {
+	if _, err := rec.Record(delivery); err != nil && rec.logger != nil {
+		rec.logger.Warn("delivery not captured",
+			"provider", string(delivery.Provider),
+			"event", delivery.Event,
+			"delivery", delivery.ID,
+			"error", err.Error(),
+		)
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// statusWriter keeps the status code written to the ResponseWriter
+type statusWriter struct {
+	http.ResponseWriter
+	code  int
+	wrote bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wrote {
+		w.code = code
+		w.wrote = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(b)
+}
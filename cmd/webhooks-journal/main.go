@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+	"github.com/heitormejias/golang-webhooks/journal"
+)
+
+const usage = `usage: webhooks-journal [flags] list
+       webhooks-journal [flags] -target URL replay
+
+Lists or replays the deliveries recorded in a journal, replayed deliveries are
+posted to the target with their original headers and body so signatures still verify.
+Targets deduplicating deliveries ignore the ones replayed with their original
+delivery ID, -new-ids gives them new ones.
+
+flags:
+`
+
+func main() {
+	dir := flag.String("dir", "journal", "journal directory")
+	since := flag.String("since", "", "only entries received at or after this RFC 3339 time")
+	until := flag.String("until", "", "only entries received before this RFC 3339 time")
+	providers := flag.String("provider", "", "comma separated providers to select")
+	events := flag.String("event", "", "comma separated events to select")
+	target := flag.String("target", "", "URL the deliveries are replayed to")
+	timeout := flag.Duration("timeout", 30*time.Second, "timeout of every replayed delivery")
+	newIDs := flag.Bool("new-ids", false, "replay the deliveries with new delivery IDs")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	filter, err := newFilter(*since, *until, *providers, *events)
+	if err != nil {
+		fail(err)
+	}
+
+	switch flag.Arg(0) {
+	case "list":
+		err = journal.Replay(*dir, filter, func(entry journal.Entry) error {
+			_, err := fmt.Printf("%s\t%s\t%s\t%s\t%d\n", entry.ReceivedAt.Format(time.RFC3339), entry.Provider, entry.Event, entry.ID, len(entry.Body))
+			return err
+		})
+	case "replay":
+		if *target == "" {
+			flag.Usage()
+			os.Exit(2)
+		}
+		err = replay(*dir, filter, *target, *newIDs, &http.Client{Timeout: *timeout})
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fail(err)
+	}
+}
+
+func newFilter(since, until, providers, events string) (journal.Filter, error) {
+	var filter journal.Filter
+	var err error
+	if since != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			return filter, err
+		}
+	}
+	if until != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			return filter, err
+		}
+	}
+	for _, p := range split(providers) {
+		filter.Providers = append(filter.Providers, webhooks.ProviderName(p))
+	}
+	filter.Events = split(events)
+	return filter, nil
+}
+
+func split(list string) []string {
+	var values []string
+	for _, v := range strings.Split(list, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func replay(dir string, filter journal.Filter, target string, newIDs bool, client *http.Client) error {
+	var replayed, failed int
+	err := journal.Replay(dir, filter, func(entry journal.Entry) error {
+		if newIDs {
+			entry = entry.Redelivered()
+		}
+		req, err := entry.Request(target)
+		if err != nil {
+			return err
+		}
+		replayed++
+		resp, err := client.Do(req)
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "%s %s: %v\n", entry.Provider, entry.ID, err)
+			return nil
+		}
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			failed++
+			fmt.Fprintf(os.Stderr, "%s %s: %s\n", entry.Provider, entry.ID, resp.Status)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("replayed %d deliveries, %d failed\n", replayed, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d deliveries failed", failed)
+	}
+	return nil
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "webhooks-journal:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+	"github.com/heitormejias/golang-webhooks/journal"
+)
+
+func TestNewFilter(t *testing.T) {
+	assert := require.New(t)
+
+	filter, err := newFilter("2021-06-01T00:00:00Z", "2021-06-02T00:00:00+02:00", "github, gitlab,", " push,,Push Hook ")
+	assert.NoError(err)
+	assert.Equal(time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC), filter.Since.UTC())
+	assert.Equal(time.Date(2021, 6, 1, 22, 0, 0, 0, time.UTC), filter.Until.UTC())
+	assert.Equal([]webhooks.ProviderName{webhooks.GitHub, webhooks.GitLab}, filter.Providers)
+	assert.Equal([]string{"push", "Push Hook"}, filter.Events)
+
+	filter, err = newFilter("", "", "", "")
+	assert.NoError(err)
+	assert.Equal(journal.Filter{}, filter)
+
+	_, err = newFilter("2021-06-01", "", "", "")
+	assert.Error(err)
+	_, err = newFilter("", "yesterday", "", "")
+	assert.Error(err)
+}
+
+func TestReplay(t *testing.T) {
+	assert := require.New(t)
+
+	dir := t.TempDir()
+	j, err := journal.Open(dir)
+	assert.NoError(err)
+	for _, id := range []string{"a", "b", "c"} {
+		header := http.Header{"X-Github-Event": []string{"push"}, "X-Github-Delivery": []string{id}}
+		assert.NoError(j.Append(webhooks.NewDelivery(webhooks.GitHub, header, []byte(`{"ref":"refs/heads/main"}`))))
+	}
+	assert.NoError(j.Close())
+
+	var mu sync.Mutex
+	var received []string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Github-Delivery")
+		mu.Lock()
+		received = append(received, id)
+		mu.Unlock()
+		if id == "b" {
+			http.Error(w, "boom", http.StatusInternalServerError)
+		}
+	}))
+	defer target.Close()
+
+	// every delivery is replayed, the failed ones make the command fail
+	err = replay(dir, journal.Filter{}, target.URL, false, target.Client())
+	assert.EqualError(err, "1 deliveries failed")
+	assert.Equal([]string{"a", "b", "c"}, received)
+
+	received = nil
+	assert.NoError(replay(dir, journal.Filter{Events: []string{"push"}, Until: time.Now().Add(-time.Hour)}, target.URL, false, target.Client()))
+	assert.Empty(received)
+
+	// -new-ids rewrites the delivery header
+	received = nil
+	assert.NoError(replay(dir, journal.Filter{}, target.URL, true, target.Client()))
+	assert.Len(received, 3)
+	for _, id := range received {
+		assert.NotEmpty(id)
+		assert.NotContains([]string{"a", "b", "c"}, id)
+	}
+
+	// unreachable targets fail every delivery
+	target.Close()
+	err = replay(dir, journal.Filter{}, target.URL, false, target.Client())
+	assert.EqualError(err, "3 deliveries failed")
+}
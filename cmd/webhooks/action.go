@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+	"github.com/heitormejias/golang-webhooks/notify"
+	"github.com/heitormejias/golang-webhooks/relay"
+	"github.com/heitormejias/golang-webhooks/sender"
+)
+
+// action is run for every delivery selected by the filters of an endpoint,
+// events are the selected normalized events, empty for deliveries without
+// normalized form
+type action interface {
+	run(ctx context.Context, delivery *webhooks.Delivery, events []webhooks.NormalizedEvent) error
+}
+
+func newAction(cfg actionConfig, provider webhooks.ProviderName, logger webhooks.Logger) (action, error) {
+	var act action
+	var err error
+	switch {
+	case cfg.Relay != nil:
+		act, err = newRelayAction(*cfg.Relay)
+	case cfg.Command != nil:
+		act, err = newCommandAction(*cfg.Command, logger)
+	case cfg.Notify != nil:
+		act, err = newNotifyAction(*cfg.Notify, provider)
+	default:
+		return nil, errInvalidAction
+	}
+	if err != nil || len(cfg.Events) == 0 {
+		return act, err
+	}
+	return eventsAction{events: cfg.Events, action: act}, nil
+}
+
+// eventsAction runs the action for the deliveries of the events only
+type eventsAction struct {
+	events []string
+	action action
+}
+
+func (a eventsAction) run(ctx context.Context, delivery *webhooks.Delivery, events []webhooks.NormalizedEvent) error {
+	for _, event := range a.events {
+		if event == delivery.Event {
+			return a.action.run(ctx, delivery, events)
+		}
+	}
+	return nil
+}
+
+// relayAction forwards the deliveries to a downstream receiver
+type relayAction struct {
+	relay *relay.Relay
+}
+
+func newRelayAction(cfg relayConfig) (*relayAction, error) {
+	client, err := newClient(cfg.Timeout, cfg.MaxAttempts)
+	if err != nil {
+		return nil, err
+	}
+	r, err := relay.New(nil, []relay.Target{{Name: cfg.URL, URL: cfg.URL, Secret: cfg.Secret, Client: client}})
+	if err != nil {
+		return nil, err
+	}
+	return &relayAction{relay: r}, nil
+}
+
+func (a *relayAction) run(ctx context.Context, delivery *webhooks.Delivery, events []webhooks.NormalizedEvent) error {
+	return a.relay.Forward(ctx, delivery)
+}
+
+// notifyAction posts chat messages rendered from the deliveries
+type notifyAction struct {
+	notifier *notify.Notifier
+}
+
+func newNotifyAction(cfg notifyConfig, provider webhooks.ProviderName) (*notifyAction, error) {
+	n, err := newNotifier(cfg, provider)
+	if err != nil {
+		return nil, err
+	}
+	return &notifyAction{notifier: n}, nil
+}
+
+func newNotifier(cfg notifyConfig, provider webhooks.ProviderName) (*notify.Notifier, error) {
+	client, err := newClient(cfg.Timeout, cfg.MaxAttempts)
+	if err != nil {
+		return nil, err
+	}
+	options := []notify.Option{notify.Options.Client(client)}
+	for event, text := range cfg.Templates {
+		options = append(options, notify.Options.Template(provider, event, text))
+	}
+	for kind, text := range cfg.KindTemplates {
+		options = append(options, notify.Options.KindTemplate(webhooks.EventKind(kind), text))
+	}
+	target := notify.Target{Name: cfg.Format, URL: cfg.URL, Format: notify.Format(cfg.Format)}
+	return notify.New([]notify.Target{target}, options...)
+}
+
+// run posts the messages of the normalized events selected by the filters only
+func (a *notifyAction) run(ctx context.Context, delivery *webhooks.Delivery, events []webhooks.NormalizedEvent) error {
+	return a.notifier.NotifyEvents(ctx, delivery, events)
+}
+
+// newClient returns the client of the actions posting to other services
+func newClient(timeout time.Duration, maxAttempts int) (*sender.Client, error) {
+	var options []sender.Option
+	if timeout > 0 {
+		options = append(options, sender.Options.Timeout(timeout))
+	}
+	if maxAttempts > 0 {
+		options = append(options, sender.Options.MaxAttempts(maxAttempts))
+	}
+	return sender.New(options...)
+}
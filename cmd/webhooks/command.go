@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+)
+
+// maxOutput is the number of bytes of command output kept for the logs
+const maxOutput = 64 << 10
+
+// commandTemplates are the parsed templates of a command action
+type commandTemplates struct {
+	args []*template.Template
+	// env are sorted by name
+	env []envTemplate
+}
+
+type envTemplate struct {
+	name  string
+	value *template.Template
+}
+
+func newCommandTemplates(cfg commandConfig) (commandTemplates, error) {
+	var t commandTemplates
+	for i, arg := range cfg.Args {
+		tmpl, err := template.New(fmt.Sprintf("arg %d", i)).Option("missingkey=error").Parse(arg)
+		if err != nil {
+			return t, err
+		}
+		t.args = append(t.args, tmpl)
+	}
+	names := make([]string, 0, len(cfg.Env))
+	for name := range cfg.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		tmpl, err := template.New("env " + name).Option("missingkey=error").Parse(cfg.Env[name])
+		if err != nil {
+			return t, err
+		}
+		t.env = append(t.env, envTemplate{name: name, value: tmpl})
+	}
+	return t, nil
+}
+
+// inheritedEnv are the variables of the server environment commands get unless
+// they inherit all of them
+var inheritedEnv = []string{"PATH", "HOME"}
+
+// commandAction executes a command for every delivery with the delivery body on
+// stdin. Besides the configured variables the environment holds WEBHOOK_PROVIDER,
+// WEBHOOK_EVENT and WEBHOOK_DELIVERY, and PATH and HOME or the whole server
+// environment with inheritEnv
+type commandAction struct {
+	command    string
+	templates  commandTemplates
+	dir        string
+	inheritEnv bool
+	timeout    time.Duration
+	slots      chan struct{}
+	logger     webhooks.Logger
+}
+
+func newCommandAction(cfg commandConfig, logger webhooks.Logger) (*commandAction, error) {
+	templates, err := newCommandTemplates(cfg)
+	if err != nil {
+		return nil, err
+	}
+	a := &commandAction{
+		command:    cfg.Run,
+		templates:  templates,
+		dir:        cfg.Dir,
+		inheritEnv: cfg.InheritEnv,
+		timeout:    5 * time.Minute,
+		slots:      make(chan struct{}, 1),
+		logger:     logger,
+	}
+	if cfg.Timeout > 0 {
+		a.timeout = cfg.Timeout
+	}
+	if cfg.Concurrency > 0 {
+		a.slots = make(chan struct{}, cfg.Concurrency)
+	}
+	return a, nil
+}
+
+func (a *commandAction) run(ctx context.Context, delivery *webhooks.Delivery, events []webhooks.NormalizedEvent) error {
+	args, env, err := a.render(delivery)
+	if err != nil {
+		return fmt.Errorf("%s: %w", a.command, err)
+	}
+
+	select {
+	case a.slots <- struct{}{}:
+		defer func() { <-a.slots }()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	cmd := exec.Command(a.command, args...)
+	setProcessGroup(cmd)
+	cmd.Dir = a.dir
+	cmd.Env = env
+	cmd.Stdin = bytes.NewReader(delivery.Body)
+	var output limitedBuffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	start := time.Now()
+	err = cmd.Start()
+	if err == nil {
+		// the processes started by the command keep the output pipe open, killing
+		// the command alone would leave Wait blocked until they exit
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-ctx.Done():
+				killProcessGroup(cmd)
+			case <-done:
+			}
+		}()
+		err = cmd.Wait()
+		close(done)
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s", a.timeout)
+	}
+	fields := []interface{}{
+		"command", a.command,
+		"provider", string(delivery.Provider),
+		"event", delivery.Event,
+		"delivery", delivery.ID,
+		"duration", time.Since(start),
+	}
+	if err != nil {
+		a.logger.Warn("command failed", append(fields, "error", err.Error(), "output", output.String())...)
+		return fmt.Errorf("%s: %w", a.command, err)
+	}
+	a.logger.Info("command succeeded", fields...)
+	// the output may echo the payload or credentials
+	a.logger.Debug("command output", append(fields, "output", output.String())...)
+	return nil
+}
+
+// render executes the argument and environment templates on the payload
+func (a *commandAction) render(delivery *webhooks.Delivery) ([]string, []string, error) {
+	var b strings.Builder
+	args := make([]string, 0, len(a.templates.args))
+	for _, tmpl := range a.templates.args {
+		b.Reset()
+		if err := tmpl.Execute(&b, delivery.Payload); err != nil {
+			return nil, nil, err
+		}
+		args = append(args, b.String())
+	}
+
+	var env []string
+	if a.inheritEnv {
+		env = os.Environ()
+	} else {
+		for _, name := range inheritedEnv {
+			if value, ok := os.LookupEnv(name); ok {
+				env = append(env, name+"="+value)
+			}
+		}
+	}
+	env = append(env,
+		"WEBHOOK_PROVIDER="+string(delivery.Provider),
+		"WEBHOOK_EVENT="+delivery.Event,
+		"WEBHOOK_DELIVERY="+delivery.ID,
+	)
+	for _, e := range a.templates.env {
+		b.Reset()
+		if err := e.value.Execute(&b, delivery.Payload); err != nil {
+			return nil, nil, err
+		}
+		env = append(env, e.name+"="+b.String())
+	}
+	return args, env, nil
+}
+
+// limitedBuffer keeps the first maxOutput bytes written to it
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := maxOutput - b.buf.Len(); len(p) > room {
+		b.buf.Write(p[:room])
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	if b.truncated {
+		return b.buf.String() + "... (truncated)"
+	}
+	return b.buf.String()
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+	"gopkg.in/yaml.v3"
+)
+
+// config is the content of the configuration file
+type config struct {
+	// Listen is the address the server listens on, it isn't changed by reloads
+	Listen string `yaml:"listen"`
+	// ShutdownTimeout bounds the time given to in-flight deliveries on shutdown and reload
+	ShutdownTimeout time.Duration    `yaml:"shutdown_timeout"`
+	Endpoints       []endpointConfig `yaml:"endpoints"`
+}
+
+// endpointConfig describes a webhook endpoint
+type endpointConfig struct {
+	Path     string         `yaml:"path"`
+	Provider string         `yaml:"provider"`
+	Secrets  []secretConfig `yaml:"secrets"`
+	// Events are the accepted events, deliveries of other events are answered with 204 No Content
+	Events       []string `yaml:"events"`
+	MaxBodyBytes int64    `yaml:"max_body_bytes"`
+	// Filters select the deliveries handed to the actions, every delivery is when empty
+	Filters []filterConfig `yaml:"filters"`
+	Actions []actionConfig `yaml:"actions"`
+	// Workers and QueueSize size the pool running the actions
+	Workers   int `yaml:"workers"`
+	QueueSize int `yaml:"queue_size"`
+}
+
+// secretConfig is a webhook secret, the UUID for Bitbucket. A plain string is
+// accepted for secrets without label nor expiry
+type secretConfig struct {
+	Value     string    `yaml:"value"`
+	Label     string    `yaml:"label"`
+	ExpiresAt time.Time `yaml:"expires_at"`
+}
+
+// UnmarshalYAML decodes the secret from a string or a mapping
+func (s *secretConfig) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&s.Value)
+	}
+	type plain secretConfig
+	return node.Decode((*plain)(s))
+}
+
+// filterConfig is the configuration of a webhooks.Filter
+type filterConfig struct {
+	Kinds          []string `yaml:"kinds"`
+	Refs           []string `yaml:"refs"`
+	Paths          []string `yaml:"paths"`
+	Senders        []string `yaml:"senders"`
+	ExcludeSenders []string `yaml:"exclude_senders"`
+	Actions        []string `yaml:"actions"`
+}
+
+func (f filterConfig) filter() webhooks.Filter {
+	filter := webhooks.Filter{
+		Refs:           f.Refs,
+		Paths:          f.Paths,
+		Senders:        f.Senders,
+		ExcludeSenders: f.ExcludeSenders,
+		Actions:        f.Actions,
+	}
+	for _, kind := range f.Kinds {
+		filter.Kinds = append(filter.Kinds, webhooks.EventKind(kind))
+	}
+	return filter
+}
+
+// actionConfig describes an action run for the selected deliveries, exactly one
+// action type must be set
+type actionConfig struct {
+	// Events restricts the action to the deliveries of these events
+	Events  []string       `yaml:"events"`
+	Relay   *relayConfig   `yaml:"relay"`
+	Command *commandConfig `yaml:"command"`
+	Notify  *notifyConfig  `yaml:"notify"`
+}
+
+// relayConfig forwards the deliveries to a downstream receiver
+type relayConfig struct {
+	URL string `yaml:"url"`
+	// Secret re-signs the deliveries, they are forwarded unsigned without it
+	Secret      string        `yaml:"secret"`
+	Timeout     time.Duration `yaml:"timeout"`
+	MaxAttempts int           `yaml:"max_attempts"`
+}
+
+// commandConfig executes a command with the delivery body on stdin, the arguments
+// and environment values are text/template templates executed on the payload
+type commandConfig struct {
+	// Run is the path of the executable, it isn't templated nor run by a shell
+	Run  string            `yaml:"run"`
+	Args []string          `yaml:"args"`
+	Env  map[string]string `yaml:"env"`
+	Dir  string            `yaml:"dir"`
+	// InheritEnv hands the whole server environment to the command, which only
+	// gets PATH and HOME besides Env otherwise
+	InheritEnv bool `yaml:"inherit_env"`
+	// Timeout kills the command, 5m by default
+	Timeout time.Duration `yaml:"timeout"`
+	// Concurrency is the number of deliveries the command runs for at once, 1 by default
+	Concurrency int `yaml:"concurrency"`
+}
+
+// notifyConfig posts chat messages to an incoming webhook
+type notifyConfig struct {
+	URL string `yaml:"url"`
+	// Format is slack, matrix or teams
+	Format string `yaml:"format"`
+	// Templates replace the default messages of the events of the endpoint
+	// provider, they are executed on the payload
+	Templates map[string]string `yaml:"templates"`
+	// KindTemplates replace the default messages of the normalized event kinds,
+	// they are executed on the normalized events
+	KindTemplates map[string]string `yaml:"kind_templates"`
+	Timeout       time.Duration     `yaml:"timeout"`
+	MaxAttempts   int               `yaml:"max_attempts"`
+}
+
+// config errors
+var (
+	errNoEndpoints       = errors.New("no endpoints")
+	errInvalidPath       = errors.New("path must start with /")
+	errDuplicatePath     = errors.New("duplicate path")
+	errUnknownProvider   = errors.New("unknown provider")
+	errNoEvents          = errors.New("no events")
+	errInvalidAction     = errors.New("action must set exactly one type")
+	errInvalidRelay      = errors.New("relay action must have a URL")
+	errInvalidCommand    = errors.New("command action must have a command to run")
+	errInvalidNotify     = errors.New("notify action must have a URL")
+	errUndefinedVariable = errors.New("undefined environment variable")
+)
+
+var providers = map[webhooks.ProviderName]bool{
+	webhooks.GitHub:          true,
+	webhooks.GitLab:          true,
+	webhooks.Gitea:           true,
+	webhooks.Gogs:            true,
+	webhooks.Bitbucket:       true,
+	webhooks.BitbucketServer: true,
+	webhooks.Docker:          true,
+}
+
+// loadConfig reads and validates the configuration file. ${NAME} references to
+// environment variables are expanded in the secrets, URLs and commands once the
+// file is decoded, so secrets can be kept out of it whatever their content
+func loadConfig(path string) (*config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &config{
+		Listen:          ":3000",
+		ShutdownTimeout: 30 * time.Second,
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := cfg.expandEnv(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+var variable = regexp.MustCompile(`\$\{(\w+)\}`)
+
+// expandEnv expands the references to environment variables of the fields
+// holding secrets, URLs and commands
+func (cfg *config) expandEnv() error {
+	for i := range cfg.Endpoints {
+		e := &cfg.Endpoints[i]
+		var fields, templates []*string
+		for j := range e.Secrets {
+			fields = append(fields, &e.Secrets[j].Value)
+		}
+		for _, a := range e.Actions {
+			if a.Relay != nil {
+				fields = append(fields, &a.Relay.URL, &a.Relay.Secret)
+			}
+			if a.Command != nil {
+				fields = append(fields, &a.Command.Run, &a.Command.Dir)
+				for j := range a.Command.Args {
+					templates = append(templates, &a.Command.Args[j])
+				}
+				for name, value := range a.Command.Env {
+					if err := expandEnv(&value, true); err != nil {
+						return err
+					}
+					a.Command.Env[name] = value
+				}
+			}
+			if a.Notify != nil {
+				fields = append(fields, &a.Notify.URL)
+			}
+		}
+		for _, field := range fields {
+			if err := expandEnv(field, false); err != nil {
+				return err
+			}
+		}
+		for _, field := range templates {
+			if err := expandEnv(field, true); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// expandEnv replaces the references to environment variables of s by their
+// values. The values are quoted in templates, so they're never executed
+func expandEnv(s *string, template bool) error {
+	var err error
+	*s = variable.ReplaceAllStringFunc(*s, func(ref string) string {
+		name := variable.FindStringSubmatch(ref)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("%w: %s", errUndefinedVariable, name)
+		}
+		if template && strings.Contains(value, "{{") {
+			return "{{ " + strconv.Quote(value) + " }}"
+		}
+		return value
+	})
+	return err
+}
+
+func (cfg *config) validate() error {
+	if len(cfg.Endpoints) == 0 {
+		return errNoEndpoints
+	}
+	paths := make(map[string]bool, len(cfg.Endpoints))
+	for _, e := range cfg.Endpoints {
+		if !strings.HasPrefix(e.Path, "/") {
+			return fmt.Errorf("%w: %q", errInvalidPath, e.Path)
+		}
+		if paths[e.Path] {
+			return fmt.Errorf("%w: %s", errDuplicatePath, e.Path)
+		}
+		paths[e.Path] = true
+		if err := e.validate(); err != nil {
+			return fmt.Errorf("endpoint %s: %w", e.Path, err)
+		}
+	}
+	return nil
+}
+
+func (e endpointConfig) validate() error {
+	provider := webhooks.ProviderName(e.Provider)
+	if !providers[provider] {
+		return fmt.Errorf("%w: %q", errUnknownProvider, e.Provider)
+	}
+	if len(e.Events) == 0 && provider != webhooks.Docker {
+		return errNoEvents
+	}
+	for _, f := range e.Filters {
+		if err := f.filter().Validate(); err != nil {
+			return err
+		}
+	}
+	for _, a := range e.Actions {
+		if err := a.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a actionConfig) validate() error {
+	var types int
+	if a.Relay != nil {
+		types++
+		if a.Relay.URL == "" {
+			return errInvalidRelay
+		}
+	}
+	if a.Command != nil {
+		types++
+		if a.Command.Run == "" {
+			return errInvalidCommand
+		}
+		if _, err := newCommandTemplates(*a.Command); err != nil {
+			return err
+		}
+	}
+	if a.Notify != nil {
+		types++
+		if a.Notify.URL == "" {
+			return errInvalidNotify
+		}
+		if _, err := newNotifier(*a.Notify, ""); err != nil {
+			return err
+		}
+	}
+	if types != 1 {
+		return errInvalidAction
+	}
+	return nil
+}
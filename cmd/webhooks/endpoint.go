@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+	"github.com/heitormejias/golang-webhooks/async"
+	"github.com/heitormejias/golang-webhooks/bitbucket"
+	bitbucketserver "github.com/heitormejias/golang-webhooks/bitbucket-server"
+	"github.com/heitormejias/golang-webhooks/docker"
+	"github.com/heitormejias/golang-webhooks/gitea"
+	"github.com/heitormejias/golang-webhooks/github"
+	"github.com/heitormejias/golang-webhooks/gitlab"
+	"github.com/heitormejias/golang-webhooks/gogs"
+)
+
+// endpoint verifies the deliveries of a provider, acknowledges them and runs the
+// actions for the ones selected by the filters in the background
+type endpoint struct {
+	path       string
+	normalize  func(payload interface{}) ([]webhooks.NormalizedEvent, error)
+	filters    []webhooks.Filter
+	actions    []action
+	logger     webhooks.Logger
+	dispatcher *async.Dispatcher
+}
+
+// provider is the part of a provider package used by an endpoint
+type provider struct {
+	parse      async.ParseFunc
+	normalize  func(payload interface{}) ([]webhooks.NormalizedEvent, error)
+	statusCode func(err error) int
+}
+
+func newEndpoint(cfg endpointConfig, logger webhooks.Logger) (*endpoint, error) {
+	p, err := newProvider(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &endpoint{
+		path:      cfg.Path,
+		normalize: p.normalize,
+		logger:    logger,
+	}
+	for _, f := range cfg.Filters {
+		e.filters = append(e.filters, f.filter())
+	}
+	for _, a := range cfg.Actions {
+		act, err := newAction(a, webhooks.ProviderName(cfg.Provider), logger)
+		if err != nil {
+			return nil, err
+		}
+		e.actions = append(e.actions, act)
+	}
+
+	options := []async.Option{
+		async.Options.StatusCode(p.statusCode),
+		// actions retry on their own, failed deliveries are logged
+		async.Options.MaxAttempts(1),
+		async.Options.DeadLetter(async.DeadLetterFunc(e.failed)),
+	}
+	if cfg.Workers > 0 {
+		options = append(options, async.Options.Workers(cfg.Workers))
+	}
+	if cfg.QueueSize > 0 {
+		options = append(options, async.Options.QueueSize(cfg.QueueSize))
+	}
+	e.dispatcher, err = async.New(p.parse, e.handle, options...)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func secrets(cfg endpointConfig) webhooks.Secrets {
+	var secrets webhooks.Secrets
+	for _, s := range cfg.Secrets {
+		secrets = secrets.Add(webhooks.Secret{Value: s.Value, Label: s.Label, ExpiresAt: s.ExpiresAt})
+	}
+	return secrets
+}
+
+func newProvider(cfg endpointConfig, logger webhooks.Logger) (provider, error) {
+	switch webhooks.ProviderName(cfg.Provider) {
+	case webhooks.GitHub:
+		hook, err := github.New(github.Options.Secrets(secrets(cfg)...), github.Options.Logger(logger), github.Options.MaxBodyBytes(maxBodyBytes(cfg)))
+		if err != nil {
+			return provider{}, err
+		}
+		events := make([]github.Event, 0, len(cfg.Events))
+		for _, event := range cfg.Events {
+			events = append(events, github.Event(event))
+		}
+		return provider{
+			parse:      func(r *http.Request) (*webhooks.Delivery, error) { return hook.ParseDelivery(r, events...) },
+			normalize:  github.Normalize,
+			statusCode: github.StatusCode,
+		}, nil
+	case webhooks.GitLab:
+		hook, err := gitlab.New(gitlab.Options.Secrets(secrets(cfg)...), gitlab.Options.Logger(logger), gitlab.Options.MaxBodyBytes(maxBodyBytes(cfg)))
+		if err != nil {
+			return provider{}, err
+		}
+		events := make([]gitlab.Event, 0, len(cfg.Events))
+		for _, event := range cfg.Events {
+			events = append(events, gitlab.Event(event))
+		}
+		return provider{
+			parse:      func(r *http.Request) (*webhooks.Delivery, error) { return hook.ParseDelivery(r, events...) },
+			normalize:  gitlab.Normalize,
+			statusCode: gitlab.StatusCode,
+		}, nil
+	case webhooks.Gitea:
+		hook, err := gitea.New(gitea.Options.Secrets(secrets(cfg)...), gitea.Options.Logger(logger), gitea.Options.MaxBodyBytes(maxBodyBytes(cfg)))
+		if err != nil {
+			return provider{}, err
+		}
+		events := make([]gitea.Event, 0, len(cfg.Events))
+		for _, event := range cfg.Events {
+			events = append(events, gitea.Event(event))
+		}
+		return provider{
+			parse:      func(r *http.Request) (*webhooks.Delivery, error) { return hook.ParseDelivery(r, events...) },
+			normalize:  gitea.Normalize,
+			statusCode: gitea.StatusCode,
+		}, nil
+	case webhooks.Gogs:
+		hook, err := gogs.New(gogs.Options.Secrets(secrets(cfg)...), gogs.Options.Logger(logger), gogs.Options.MaxBodyBytes(maxBodyBytes(cfg)))
+		if err != nil {
+			return provider{}, err
+		}
+		events := make([]gogs.Event, 0, len(cfg.Events))
+		for _, event := range cfg.Events {
+			events = append(events, gogs.Event(event))
+		}
+		return provider{
+			parse:      func(r *http.Request) (*webhooks.Delivery, error) { return hook.ParseDelivery(r, events...) },
+			normalize:  gogs.Normalize,
+			statusCode: gogs.StatusCode,
+		}, nil
+	case webhooks.Bitbucket:
+		hook, err := bitbucket.New(bitbucket.Options.UUIDs(secrets(cfg)...), bitbucket.Options.Logger(logger), bitbucket.Options.MaxBodyBytes(maxBodyBytes(cfg)))
+		if err != nil {
+			return provider{}, err
+		}
+		events := make([]bitbucket.Event, 0, len(cfg.Events))
+		for _, event := range cfg.Events {
+			events = append(events, bitbucket.Event(event))
+		}
+		return provider{
+			parse:      func(r *http.Request) (*webhooks.Delivery, error) { return hook.ParseDelivery(r, events...) },
+			normalize:  bitbucket.Normalize,
+			statusCode: bitbucket.StatusCode,
+		}, nil
+	case webhooks.BitbucketServer:
+		hook, err := bitbucketserver.New(bitbucketserver.Options.Secrets(secrets(cfg)...), bitbucketserver.Options.Logger(logger), bitbucketserver.Options.MaxBodyBytes(maxBodyBytes(cfg)))
+		if err != nil {
+			return provider{}, err
+		}
+		events := make([]bitbucketserver.Event, 0, len(cfg.Events))
+		for _, event := range cfg.Events {
+			events = append(events, bitbucketserver.Event(event))
+		}
+		return provider{
+			parse:      func(r *http.Request) (*webhooks.Delivery, error) { return hook.ParseDelivery(r, events...) },
+			normalize:  bitbucketserver.Normalize,
+			statusCode: bitbucketserver.StatusCode,
+		}, nil
+	case webhooks.Docker:
+		hook, err := docker.New(docker.Options.Logger(logger), docker.Options.MaxBodyBytes(maxBodyBytes(cfg)))
+		if err != nil {
+			return provider{}, err
+		}
+		return provider{
+			parse:      func(r *http.Request) (*webhooks.Delivery, error) { return hook.ParseDelivery(r, docker.BuildEvent) },
+			normalize:  docker.Normalize,
+			statusCode: docker.StatusCode,
+		}, nil
+	default:
+		return provider{}, fmt.Errorf("%w: %q", errUnknownProvider, cfg.Provider)
+	}
+}
+
+func maxBodyBytes(cfg endpointConfig) int64 {
+	if cfg.MaxBodyBytes == 0 {
+		return webhooks.DefaultMaxBodyBytes
+	}
+	return cfg.MaxBodyBytes
+}
+
+// ServeHTTP verifies and queues the delivery
+func (e *endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.dispatcher.ServeHTTP(w, r)
+}
+
+// handle runs the actions for the delivery unless the filters reject it, every
+// action is run even when a previous one failed
+func (e *endpoint) handle(ctx context.Context, delivery *webhooks.Delivery) error {
+	events, selected := e.selected(delivery)
+	if !selected {
+		e.logger.Debug("delivery filtered out", "endpoint", e.path, "provider", string(delivery.Provider),
+			"event", delivery.Event, "delivery", delivery.ID)
+		return nil
+	}
+
+	var msgs []string
+	for _, act := range e.actions {
+		if err := act.run(ctx, delivery, events); err != nil {
+			msgs = append(msgs, err.Error())
+		}
+	}
+	if len(msgs) > 0 {
+		return errors.New(strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+// selected returns the normalized events of the delivery selected by the filters
+// and whether the delivery is. Deliveries without normalized form are only
+// selected when there are no filters
+func (e *endpoint) selected(delivery *webhooks.Delivery) ([]webhooks.NormalizedEvent, bool) {
+	events, err := e.normalize(delivery.Payload)
+	if err != nil {
+		return nil, len(e.filters) == 0
+	}
+	if len(e.filters) == 0 {
+		return events, true
+	}
+
+	var selected []webhooks.NormalizedEvent
+	for _, event := range events {
+		for _, f := range e.filters {
+			if f.Match(event) {
+				selected = append(selected, event)
+				break
+			}
+		}
+	}
+	return selected, len(selected) > 0
+}
+
+func (e *endpoint) failed(job async.Job) {
+	e.logger.Error("actions failed", "endpoint", e.path, "provider", string(job.Delivery.Provider),
+		"event", job.Delivery.Event, "delivery", job.Delivery.ID, "error", job.Err.Error())
+}
+
+// shutdown waits for the queued deliveries to be handled
+func (e *endpoint) shutdown(ctx context.Context) error {
+	return e.dispatcher.Shutdown(ctx)
+}
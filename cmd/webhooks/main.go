@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+)
+
+const usage = `usage: webhooks [flags]
+
+Serves the webhook endpoints described by a YAML configuration file. Deliveries
+are verified, acknowledged and handed to the actions of their endpoint in the
+background. SIGHUP reloads the configuration, SIGINT and SIGTERM shut the server
+down once the in-flight deliveries are handled.
+
+flags:
+`
+
+func main() {
+	path := flag.String("config", "webhooks.yaml", "configuration file")
+	debug := flag.Bool("debug", false, "log every delivery, not only the failures")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	logger := levelLogger{Logger: webhooks.StdLogger(log.New(os.Stderr, "", log.LstdFlags)), debug: *debug}
+	cfg, err := loadConfig(*path)
+	if err != nil {
+		fail(err)
+	}
+	s, err := newServer(cfg, logger)
+	if err != nil {
+		fail(err)
+	}
+
+	httpServer := &http.Server{Addr: cfg.Listen, Handler: s}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- httpServer.ListenAndServe()
+	}()
+	logger.Info("listening", "address", cfg.Listen, "endpoints", len(cfg.Endpoints))
+
+	// reloads run in the background so they don't delay shutdowns
+	reloaded := make(chan *config, 1)
+	reloading := false
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	for {
+		select {
+		case err := <-errs:
+			fail(err)
+		case cfg = <-reloaded:
+			reloading = false
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				if reloading {
+					logger.Warn("reload already in progress")
+					continue
+				}
+				reloading = true
+				go func(current *config) {
+					reloaded <- reload(s, current, *path, logger)
+				}(cfg)
+				continue
+			}
+
+			logger.Info("shutting down", "signal", sig.String())
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+			err := httpServer.Shutdown(ctx)
+			s.shutdown(ctx)
+			if reloading {
+				// the endpoints replaced by the reload are draining
+				select {
+				case <-reloaded:
+				case <-ctx.Done():
+				}
+			}
+			cancel()
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fail(err)
+			}
+			return
+		}
+	}
+}
+
+// reload swaps the endpoints for the ones of the configuration file and returns
+// the configuration in effect, the current one when the file is invalid
+func reload(s *server, current *config, path string, logger webhooks.Logger) *config {
+	cfg, err := loadConfig(path)
+	if err != nil {
+		logger.Error("reload failed", "error", err.Error())
+		return current
+	}
+	if cfg.Listen != current.Listen {
+		logger.Warn("listen address not reloaded", "address", current.Listen)
+		cfg.Listen = current.Listen
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), current.ShutdownTimeout)
+	defer cancel()
+	if err := s.reload(ctx, cfg); err != nil {
+		logger.Error("reload failed", "error", err.Error())
+		return current
+	}
+	logger.Info("configuration reloaded", "endpoints", len(cfg.Endpoints))
+	return cfg
+}
+
+// levelLogger drops the debug records unless debug is set
+type levelLogger struct {
+	webhooks.Logger
+	debug bool
+}
+
+func (l levelLogger) Debug(msg string, args ...interface{}) {
+	if l.debug {
+		l.Logger.Debug(msg, args...)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "webhooks:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+	"github.com/heitormejias/golang-webhooks/github"
+	"github.com/heitormejias/golang-webhooks/notify"
+	"github.com/stretchr/testify/require"
+)
+
+const push = `{"ref": "refs/heads/%s", "sender": {"login": "octocat"}, "commits": [{"id": "1", "added": ["services/api/main.go"]}]}`
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "webhooks.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	assert := require.New(t)
+	t.Setenv("WEBHOOKS_TEST_SECRET", "s3cr$t")
+	t.Setenv("WEBHOOKS_TEST_YAML", "a #b: c\n&d *e !f")
+	t.Setenv("WEBHOOKS_TEST_TEMPLATE", "{{ .Ref }}")
+
+	cfg, err := loadConfig(writeConfig(t, `
+# ${WEBHOOKS_TEST_UNDEFINED} in comments isn't expanded
+endpoints:
+  - path: /github
+    provider: github
+    secrets:
+      - ${WEBHOOKS_TEST_SECRET}
+      - "${WEBHOOKS_TEST_YAML}"
+      - value: previous
+        label: previous
+        expires_at: 2030-01-02T15:04:05Z
+    events: [push, pull_request]
+    filters:
+      - refs: [refs/heads/main]
+        paths: ["services/api/**"]
+        exclude_senders: ['*\[bot\]']
+    actions:
+      - relay:
+          url: http://ci.internal/hooks
+          timeout: 5s
+      - command:
+          run: /opt/deploy.sh
+          args: ["${WEBHOOKS_TEST_TEMPLATE} {{ .Ref }}"]
+          env:
+            SECRET: ${WEBHOOKS_TEST_SECRET}
+  - path: /docker
+    provider: docker
+`))
+	assert.NoError(err)
+	assert.Equal(":3000", cfg.Listen)
+	assert.Equal(30*time.Second, cfg.ShutdownTimeout)
+	assert.Len(cfg.Endpoints, 2)
+	e := cfg.Endpoints[0]
+	assert.Equal([]secretConfig{
+		{Value: "s3cr$t"},
+		{Value: "a #b: c\n&d *e !f"},
+		{Value: "previous", Label: "previous", ExpiresAt: time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)},
+	}, e.Secrets)
+	assert.Equal([]string{"push", "pull_request"}, e.Events)
+	assert.Equal([]string{`*\[bot\]`}, e.Filters[0].ExcludeSenders)
+	assert.Equal(5*time.Second, e.Actions[0].Relay.Timeout)
+	// values are quoted in templates
+	assert.Equal([]string{`{{ "{{ .Ref }}" }} {{ .Ref }}`}, e.Actions[1].Command.Args)
+	assert.Equal(map[string]string{"SECRET": "s3cr$t"}, e.Actions[1].Command.Env)
+
+	tests := []struct {
+		name   string
+		config string
+		err    error
+	}{
+		{
+			name:   "NoEndpoints",
+			config: `listen: ":8080"`,
+			err:    errNoEndpoints,
+		},
+		{
+			name:   "UnknownProvider",
+			config: "endpoints:\n  - {path: /hooks, provider: sourcehut, events: [push]}",
+			err:    errUnknownProvider,
+		},
+		{
+			name:   "NoEvents",
+			config: "endpoints:\n  - {path: /hooks, provider: github}",
+			err:    errNoEvents,
+		},
+		{
+			name:   "InvalidPath",
+			config: "endpoints:\n  - {path: hooks, provider: github, events: [push]}",
+			err:    errInvalidPath,
+		},
+		{
+			name:   "DuplicatePath",
+			config: "endpoints:\n  - {path: /hooks, provider: github, events: [push]}\n  - {path: /hooks, provider: gitlab, events: [Push Hook]}",
+			err:    errDuplicatePath,
+		},
+		{
+			name:   "InvalidAction",
+			config: "endpoints:\n  - {path: /hooks, provider: github, events: [push], actions: [{}]}",
+			err:    errInvalidAction,
+		},
+		{
+			name:   "InvalidRelay",
+			config: "endpoints:\n  - {path: /hooks, provider: github, events: [push], actions: [{relay: {}}]}",
+			err:    errInvalidRelay,
+		},
+		{
+			name:   "InvalidCommand",
+			config: "endpoints:\n  - {path: /hooks, provider: github, events: [push], actions: [{command: {args: [deploy]}}]}",
+			err:    errInvalidCommand,
+		},
+		{
+			name:   "InvalidNotify",
+			config: "endpoints:\n  - {path: /hooks, provider: github, events: [push], actions: [{notify: {format: slack}}]}",
+			err:    errInvalidNotify,
+		},
+		{
+			name:   "UnknownFormat",
+			config: "endpoints:\n  - {path: /hooks, provider: github, events: [push], actions: [{notify: {url: 'http://chat', format: irc}}]}",
+			err:    notify.ErrUnknownFormat,
+		},
+		{
+			name:   "UndefinedVariable",
+			config: "endpoints:\n  - {path: /hooks, provider: github, events: [push], secrets: [\"${WEBHOOKS_TEST_UNDEFINED}\"]}",
+			err:    errUndefinedVariable,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadConfig(writeConfig(t, tc.config))
+			assert.True(errors.Is(err, tc.err), "expected %v, got %v", tc.err, err)
+		})
+	}
+
+	_, err = loadConfig(writeConfig(t, "endpoints:\n  - {path: /hooks, provider: github, events: [push], filters: [{refs: ['refs/heads/[']}]}"))
+	assert.Error(err)
+	_, err = loadConfig(writeConfig(t, "endpoints:\n  - {path: /hooks, provider: github, event: [push]}"))
+	assert.Error(err)
+	_, err = loadConfig(writeConfig(t, "endpoints:\n  - {path: /hooks, provider: github, events: [push], actions: [{command: {run: deploy.sh, args: ['{{ .Ref '] }}]}"))
+	assert.Error(err)
+}
+
+func TestServer(t *testing.T) {
+	assert := require.New(t)
+
+	var mu sync.Mutex
+	var relayed []string
+	downstream, err := github.New(github.Options.Secret("downstream"))
+	assert.NoError(err)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivery, err := downstream.ParseDelivery(r, github.PushEvent)
+		if err != nil {
+			http.Error(w, err.Error(), github.StatusCode(err))
+			return
+		}
+		mu.Lock()
+		relayed = append(relayed, delivery.Payload.(github.PushPayload).Ref)
+		mu.Unlock()
+	}))
+	defer receiver.Close()
+	var notified []string
+	chat := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message struct{ Text string }
+		_ = json.NewDecoder(r.Body).Decode(&message)
+		mu.Lock()
+		notified = append(notified, message.Text)
+		mu.Unlock()
+	}))
+	defer chat.Close()
+
+	config := `
+endpoints:
+  - path: /github
+    provider: github
+    secrets: [upstream]
+    events: [push]
+    filters:
+      - refs: [refs/heads/main]
+        paths: ["services/api/**"]
+    actions:
+      - relay:
+          url: ` + receiver.URL + `
+          secret: downstream
+      - notify:
+          url: ` + chat.URL + `
+          format: slack
+          templates:
+            push: "{{ .Ref }} pushed by {{ .Sender.Login }}"
+`
+	cfg, err := loadConfig(writeConfig(t, config))
+	assert.NoError(err)
+	var logs strings.Builder
+	s, err := newServer(cfg, webhooks.StdLogger(log.New(&logs, "", 0)))
+	assert.NoError(err)
+
+	send := func(path, branch, secret string) int {
+		req, err := github.NewRequest("http://localhost"+path, github.PushEvent, []byte(strings.Replace(push, "%s", branch, 1)), secret)
+		assert.NoError(err)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(http.StatusAccepted, send("/github", "main", "upstream"))
+	assert.Equal(http.StatusAccepted, send("/github", "develop", "upstream"))
+	assert.Equal(http.StatusUnauthorized, send("/github", "main", "forged"))
+	assert.Equal(http.StatusNotFound, send("/gitlab", "main", "upstream"))
+
+	// reloading drains the deliveries queued on the previous endpoints
+	cfg, err = loadConfig(writeConfig(t, strings.Replace(config, "/github", "/hooks/github", 1)))
+	assert.NoError(err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(s.reload(ctx, cfg))
+	mu.Lock()
+	assert.Equal([]string{"refs/heads/main"}, relayed)
+	mu.Unlock()
+
+	assert.Equal(http.StatusNotFound, send("/github", "main", "upstream"))
+	assert.Equal(http.StatusAccepted, send("/hooks/github", "main", "upstream"))
+	s.shutdown(ctx)
+	mu.Lock()
+	assert.Equal([]string{"refs/heads/main", "refs/heads/main"}, relayed)
+	assert.Equal([]string{"refs/heads/main pushed by octocat", "refs/heads/main pushed by octocat"}, notified)
+	mu.Unlock()
+	// reloads finishing after shutdown don't bring endpoints back
+	assert.Equal(errServerClosed, s.reload(ctx, cfg))
+	assert.Contains(logs.String(), "delivery filtered out")
+}
+
+func TestCommandAction(t *testing.T) {
+	assert := require.New(t)
+
+	script := filepath.Join(t.TempDir(), "deploy.sh")
+	assert.NoError(os.WriteFile(script, []byte("#!/bin/sh\necho \"$1 $REPOSITORY $WEBHOOK_EVENT\"\ncat\nexec sleep \"$SLEEP\"\n"), 0o700))
+
+	body := []byte(`{"ref": "refs/tags/v1.2.0", "repository": {"full_name": "octocat/hello"}}`)
+	var payload github.PushPayload
+	assert.NoError(json.Unmarshal(body, &payload))
+	delivery := &webhooks.Delivery{Provider: webhooks.GitHub, ID: "1", Event: "push", Body: body, Payload: payload}
+
+	var logs strings.Builder
+	cfg := commandConfig{
+		Run:  script,
+		Args: []string{"{{ .Ref }}"},
+		Env:  map[string]string{"REPOSITORY": "{{ .Repository.FullName }}", "SLEEP": "0"},
+	}
+	a, err := newCommandAction(cfg, webhooks.StdLogger(log.New(&logs, "", 0)))
+	assert.NoError(err)
+	assert.NoError(a.run(context.Background(), delivery, nil))
+	assert.Contains(logs.String(), "INFO command succeeded")
+	assert.Contains(logs.String(), "DEBUG command output")
+	assert.Contains(logs.String(), "refs/tags/v1.2.0 octocat/hello push")
+	assert.Contains(logs.String(), `full_name`)
+	for _, line := range strings.Split(logs.String(), "\n") {
+		if strings.HasPrefix(line, "INFO") {
+			assert.NotContains(line, "output=")
+		}
+	}
+
+	// commands only get PATH and HOME from the server environment unless they
+	// inherit all of it
+	env, err := exec.LookPath("env")
+	assert.NoError(err)
+	t.Setenv("WEBHOOKS_TEST_SECRET", "hunter2")
+	logs.Reset()
+	a, err = newCommandAction(commandConfig{Run: env, Env: map[string]string{"REPOSITORY": "{{ .Repository.FullName }}"}}, webhooks.StdLogger(log.New(&logs, "", 0)))
+	assert.NoError(err)
+	assert.NoError(a.run(context.Background(), delivery, nil))
+	assert.Contains(logs.String(), "PATH="+os.Getenv("PATH"))
+	assert.Contains(logs.String(), "REPOSITORY=octocat/hello")
+	assert.Contains(logs.String(), "WEBHOOK_DELIVERY=1")
+	assert.NotContains(logs.String(), "hunter2")
+	logs.Reset()
+	a, err = newCommandAction(commandConfig{Run: env, InheritEnv: true}, webhooks.StdLogger(log.New(&logs, "", 0)))
+	assert.NoError(err)
+	assert.NoError(a.run(context.Background(), delivery, nil))
+	assert.Contains(logs.String(), "WEBHOOKS_TEST_SECRET=hunter2")
+
+	// templates referencing missing fields fail before the command runs
+	missing, err := newCommandAction(commandConfig{Run: script, Args: []string{"{{ .Tag }}"}}, webhooks.StdLogger(log.New(&logs, "", 0)))
+	assert.NoError(err)
+	assert.Error(missing.run(context.Background(), delivery, nil))
+
+	cfg.Env["SLEEP"] = "5"
+	cfg.Timeout = 100 * time.Millisecond
+	a, err = newCommandAction(cfg, webhooks.StdLogger(log.New(&logs, "", 0)))
+	assert.NoError(err)
+	start := time.Now()
+	err = a.run(context.Background(), delivery, nil)
+	assert.EqualError(err, script+": timed out after 100ms")
+	assert.Less(int64(time.Since(start)), int64(time.Second))
+
+	// the processes started by the command are killed too
+	orphan := filepath.Join(t.TempDir(), "orphan.sh")
+	assert.NoError(os.WriteFile(orphan, []byte("#!/bin/sh\nsleep 5\necho done\n"), 0o700))
+	a, err = newCommandAction(commandConfig{Run: orphan, Timeout: 100 * time.Millisecond}, webhooks.StdLogger(log.New(&logs, "", 0)))
+	assert.NoError(err)
+	start = time.Now()
+	err = a.run(context.Background(), delivery, nil)
+	assert.EqualError(err, orphan+": timed out after 100ms")
+	assert.Less(int64(time.Since(start)), int64(time.Second))
+
+	// deliveries wait for a free slot
+	cfg.Timeout = 0
+	cfg.Env["SLEEP"] = "0.2"
+	a, err = newCommandAction(cfg, webhooks.StdLogger(log.New(&logs, "", 0)))
+	assert.NoError(err)
+	var wg sync.WaitGroup
+	start = time.Now()
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = a.run(context.Background(), delivery, nil)
+		}()
+	}
+	wg.Wait()
+	assert.GreaterOrEqual(int64(time.Since(start)), int64(400*time.Millisecond))
+
+	restricted, err := newAction(actionConfig{Events: []string{"release"}, Command: &cfg}, webhooks.GitHub, webhooks.StdLogger(log.New(&logs, "", 0)))
+	assert.NoError(err)
+	start = time.Now()
+	assert.NoError(restricted.run(context.Background(), delivery, nil))
+	assert.Less(int64(time.Since(start)), int64(200*time.Millisecond))
+}
+
+func TestNotifyAction(t *testing.T) {
+	assert := require.New(t)
+
+	var notified []string
+	chat := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message struct{ Text string }
+		_ = json.NewDecoder(r.Body).Decode(&message)
+		notified = append(notified, message.Text)
+	}))
+	defer chat.Close()
+
+	a, err := newNotifyAction(notifyConfig{URL: chat.URL, Format: "matrix", KindTemplates: map[string]string{"push": "{{ .Branch }}"}}, webhooks.GitHub)
+	assert.NoError(err)
+	body := []byte(`{"ref": "refs/heads/main", "repository": {"full_name": "octocat/hello"}}`)
+	var payload github.PushPayload
+	assert.NoError(json.Unmarshal(body, &payload))
+	delivery := &webhooks.Delivery{Provider: webhooks.GitHub, ID: "1", Event: "push", Body: body, Payload: payload}
+	events, err := github.Normalize(payload)
+	assert.NoError(err)
+
+	// only the normalized events selected by the filters are notified
+	assert.NoError(a.run(context.Background(), delivery, nil))
+	assert.Empty(notified)
+	assert.NoError(a.run(context.Background(), delivery, events))
+	assert.Equal([]string{"main"}, notified)
+}
@@ -0,0 +1,11 @@
+package main
+
+import "os/exec"
+
+// setProcessGroup does nothing, the processes started by the command outlive it
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills the started command
+func killProcessGroup(cmd *exec.Cmd) {
+	_ = cmd.Process.Kill()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+)
+
+var errServerClosed = errors.New("server shut down")
+
+// server serves the endpoints of the current configuration, reloads swap them
+// without dropping the deliveries queued on the previous ones
+type server struct {
+	logger webhooks.Logger
+
+	mu        sync.RWMutex
+	mux       *http.ServeMux
+	endpoints []*endpoint
+	closed    bool
+}
+
+func newServer(cfg *config, logger webhooks.Logger) (*server, error) {
+	s := &server{logger: logger}
+	mux, endpoints, err := s.build(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s.mux, s.endpoints = mux, endpoints
+	return s, nil
+}
+
+func (s *server) build(cfg *config) (*http.ServeMux, []*endpoint, error) {
+	mux := http.NewServeMux()
+	endpoints := make([]*endpoint, 0, len(cfg.Endpoints))
+	for _, ec := range cfg.Endpoints {
+		e, err := newEndpoint(ec, s.logger)
+		if err != nil {
+			shutdown(context.Background(), endpoints)
+			return nil, nil, err
+		}
+		endpoints = append(endpoints, e)
+		mux.Handle(ec.Path, e)
+	}
+	return mux, endpoints, nil
+}
+
+// ServeHTTP hands the request to the endpoint registered for its path
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	mux := s.mux
+	s.mu.RUnlock()
+	mux.ServeHTTP(w, r)
+}
+
+// reload swaps the endpoints for the ones of cfg, the previous endpoints are
+// given until ctx is done to handle their queued deliveries. Reloads finishing
+// after shutdown keep the previous endpoints
+func (s *server) reload(ctx context.Context, cfg *config) error {
+	mux, endpoints, err := s.build(cfg)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		shutdown(ctx, endpoints)
+		return errServerClosed
+	}
+	previous := s.endpoints
+	s.mux, s.endpoints = mux, endpoints
+	s.mu.Unlock()
+
+	shutdown(ctx, previous)
+	return nil
+}
+
+// shutdown waits until ctx is done for the queued deliveries to be handled
+func (s *server) shutdown(ctx context.Context) {
+	s.mu.Lock()
+	endpoints := s.endpoints
+	s.closed = true
+	s.mu.Unlock()
+	shutdown(ctx, endpoints)
+}
+
+func shutdown(ctx context.Context, endpoints []*endpoint) {
+	var wg sync.WaitGroup
+	wg.Add(len(endpoints))
+	for _, e := range endpoints {
+		go func(e *endpoint) {
+			defer wg.Done()
+			_ = e.shutdown(ctx)
+		}(e)
+	}
+	wg.Wait()
+}
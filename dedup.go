@@ -0,0 +1,388 @@
+package webhooks
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dedup errors
+var (
+	ErrDuplicateDelivery = errors.New("duplicate delivery")
+	ErrDeliveryInFlight  = errors.New("delivery is being handled")
+	ErrInvalidDeliveryID = errors.New("invalid delivery ID")
+)
+
+// DedupStore records the delivery IDs seen, it must be safe for concurrent use
+type DedupStore interface {
+	// Seen records the delivery ID and reports whether it was already recorded
+	Seen(id string) (bool, error)
+	// Forget removes the delivery ID so its next delivery is handled again
+	Forget(id string) error
+}
+
+// DedupMode selects what happens to repeated deliveries
+type DedupMode int
+
+// Dedup modes
+const (
+	// DedupReject acknowledges repeated deliveries with 200 OK without handling them
+	DedupReject DedupMode = iota
+	// DedupFlag hands repeated deliveries to the handler, IsDuplicate reports them
+	DedupFlag
+)
+
+type contextKey int
+
+const duplicateKey contextKey = iota
+
+// IsDuplicate reports whether the request context belongs to a repeated delivery
+func IsDuplicate(ctx context.Context) bool {
+	duplicate, _ := ctx.Value(duplicateKey).(bool)
+	return duplicate
+}
+
+// DeliveryID returns the delivery ID carried by the headers of any detected provider
+func DeliveryID(header http.Header) string {
+	name, err := detect(header)
+	if err != nil {
+		return ""
+	}
+	return header.Get(providerHeaders[name].id)
+}
+
+// Deduplicate returns a handler recording the delivery ID of every request in the
+// store before handing it to next, deliveries without ID are always handed over.
+//
+// The ID is forgotten again unless next answers with a 2xx status code, so
+// deliveries failing verification or handling are handled when redelivered and
+// forged requests don't block the genuine delivery of their ID. Only the IDs of
+// deliveries handled successfully count as duplicates: repeated deliveries arriving
+// while the first one is being handled are answered with 409 Conflict and a
+// Retry-After header so the forge tries again. Store errors are answered with
+// 500 Internal Server Error
+func Deduplicate(store DedupStore, mode DedupMode, next http.Handler) http.Handler {
+	var mu sync.Mutex
+	inFlight := make(map[string]bool)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := DeliveryID(r.Header)
+		if id == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		mu.Lock()
+		if inFlight[id] {
+			mu.Unlock()
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, ErrDeliveryInFlight.Error(), http.StatusConflict)
+			return
+		}
+		inFlight[id] = true
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			delete(inFlight, id)
+			mu.Unlock()
+		}()
+
+		seen, err := store.Seen(id)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if !seen {
+			sw := &dedupWriter{ResponseWriter: w, code: http.StatusOK}
+			handled := false
+			defer func() {
+				if !handled || sw.code < 200 || sw.code > 299 {
+					_ = store.Forget(id)
+				}
+			}()
+			next.ServeHTTP(sw, r)
+			handled = true
+			return
+		}
+		if mode == DedupReject {
+			http.Error(w, ErrDuplicateDelivery.Error(), http.StatusOK)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), duplicateKey, true)))
+	})
+}
+
+// dedupWriter keeps the status code written to the ResponseWriter
+type dedupWriter struct {
+	http.ResponseWriter
+	code  int
+	wrote bool
+}
+
+func (w *dedupWriter) WriteHeader(code int) {
+	if !w.wrote {
+		w.code = code
+		w.wrote = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *dedupWriter) Write(b []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(b)
+}
+
+type dedupEntry struct {
+	id      string
+	expires time.Time
+}
+
+// MemoryDedupStore is an in-memory DedupStore keeping the most recently seen IDs
+// until they expire
+type MemoryDedupStore struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+// NewMemoryDedupStore creates and returns a MemoryDedupStore remembering up to
+// capacity IDs for ttl each, a capacity of 0 or less is unbounded
+func NewMemoryDedupStore(capacity int, ttl time.Duration) *MemoryDedupStore {
+	return &MemoryDedupStore{
+		capacity: capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// Seen records the delivery ID and reports whether it was already recorded
+func (store *MemoryDedupStore) Seen(id string) (bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.seen(id, time.Now().Add(store.ttl)), nil
+}
+
+// Forget removes the delivery ID so its next delivery is handled again
+func (store *MemoryDedupStore) Forget(id string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.forget(id)
+	return nil
+}
+
+// Len returns the number of IDs remembered, expired ones included until evicted
+func (store *MemoryDedupStore) Len() int {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.order.Len()
+}
+
+func (store *MemoryDedupStore) seen(id string, expires time.Time) bool {
+	now := time.Now()
+	if elem, ok := store.entries[id]; ok {
+		entry := elem.Value.(*dedupEntry)
+		if now.Before(entry.expires) {
+			store.order.MoveToFront(elem)
+			return true
+		}
+		store.forget(id)
+	}
+
+	store.entries[id] = store.order.PushFront(&dedupEntry{id: id, expires: expires})
+	for store.capacity > 0 && store.order.Len() > store.capacity {
+		store.forget(store.order.Back().Value.(*dedupEntry).id)
+	}
+	// the least recently seen IDs expire first, evicting them keeps unbounded
+	// stores bounded by the deliveries of one TTL
+	for oldest := store.order.Back(); oldest != nil && !now.Before(oldest.Value.(*dedupEntry).expires); oldest = store.order.Back() {
+		store.forget(oldest.Value.(*dedupEntry).id)
+	}
+	return false
+}
+
+func (store *MemoryDedupStore) forget(id string) {
+	if elem, ok := store.entries[id]; ok {
+		store.order.Remove(elem)
+		delete(store.entries, id)
+	}
+}
+
+// minCompactLines is the number of lines the file of a FileDedupStore may hold
+// before it's compacted, whatever the number of IDs remembered
+const minCompactLines = 1024
+
+// FileDedupStore is a DedupStore persisting the IDs to an append-only file so they
+// survive restarts. The file is compacted to the unexpired IDs when it's opened and
+// whenever it holds twice as many lines as IDs remembered
+type FileDedupStore struct {
+	mu     sync.Mutex
+	path   string
+	memory *MemoryDedupStore
+	file   *os.File
+	// lines is the number of lines of the file
+	lines int
+}
+
+// NewFileDedupStore opens or creates the file at path and returns a FileDedupStore
+// remembering the IDs for ttl each
+func NewFileDedupStore(path string, ttl time.Duration) (*FileDedupStore, error) {
+	memory := NewMemoryDedupStore(0, ttl)
+	if err := loadDedupFile(path, memory); err != nil {
+		return nil, err
+	}
+	store := &FileDedupStore{path: path, memory: memory}
+	if err := store.compact(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// compact rewrites the file with the unexpired IDs only and reopens it
+func (store *FileDedupStore) compact() error {
+	tmp := store.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	lines := 0
+	w := bufio.NewWriter(file)
+	for elem := store.memory.order.Back(); elem != nil; elem = elem.Prev() {
+		entry := elem.Value.(*dedupEntry)
+		if now.Before(entry.expires) {
+			_, _ = fmt.Fprintf(w, "%d %s\n", entry.expires.UnixNano(), entry.id)
+			lines++
+		}
+	}
+	if err := w.Flush(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if store.file != nil {
+		if err := store.file.Close(); err != nil {
+			return err
+		}
+		store.file = nil
+	}
+	if err := os.Rename(tmp, store.path); err != nil {
+		return err
+	}
+
+	file, err = os.OpenFile(store.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	store.file = file
+	store.lines = lines
+	return nil
+}
+
+func loadDedupFile(path string, memory *MemoryDedupStore) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	now := time.Now()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		nanos, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		// forgotten IDs are written with an expiry in the past
+		if expires := time.Unix(0, nanos); now.Before(expires) {
+			memory.seen(fields[1], expires)
+		} else {
+			memory.forget(fields[1])
+		}
+	}
+	return scanner.Err()
+}
+
+// Seen records the delivery ID and reports whether it was already recorded
+func (store *FileDedupStore) Seen(id string) (bool, error) {
+	if strings.ContainsAny(id, "\r\n") {
+		return false, ErrInvalidDeliveryID
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	expires := time.Now().Add(store.memory.ttl)
+	store.memory.mu.Lock()
+	seen := store.memory.seen(id, expires)
+	store.memory.mu.Unlock()
+	if seen {
+		return true, nil
+	}
+	if err := store.append(expires, id); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// Forget removes the delivery ID so its next delivery is handled again
+func (store *FileDedupStore) Forget(id string) error {
+	if strings.ContainsAny(id, "\r\n") {
+		return ErrInvalidDeliveryID
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.memory.mu.Lock()
+	store.memory.forget(id)
+	store.memory.mu.Unlock()
+	return store.append(time.Unix(0, 0), id)
+}
+
+func (store *FileDedupStore) append(expires time.Time, id string) error {
+	if store.file == nil {
+		return os.ErrClosed
+	}
+	if _, err := fmt.Fprintf(store.file, "%d %s\n", expires.UnixNano(), id); err != nil {
+		return err
+	}
+	store.lines++
+	if store.lines > minCompactLines && store.lines > 2*store.memory.Len() {
+		return store.compact()
+	}
+	return nil
+}
+
+// Close closes the underlying file
+func (store *FileDedupStore) Close() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.file == nil {
+		return os.ErrClosed
+	}
+	err := store.file.Close()
+	store.file = nil
+	return err
+}
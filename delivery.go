@@ -0,0 +1,90 @@
+package webhooks
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Delivery is a parsed payload together with the metadata of the delivery that carried it
+type Delivery struct {
+	Provider   ProviderName `json:"provider"`
+	ID         string       `json:"id"`
+	HookID     string       `json:"hook_id"`
+	Event      string       `json:"event"`
+	UserAgent  string       `json:"user_agent"`
+	Header     http.Header  `json:"header"`
+	Body       []byte       `json:"body"`
+	ReceivedAt time.Time    `json:"received_at"`
+	Secret     string       `json:"secret,omitempty"` // label of the secret that verified the delivery
+	Payload    interface{}  `json:"-"`
+}
+
+// deliveryHeaders are the headers carrying the delivery metadata of a provider
+type deliveryHeaders struct {
+	id     string
+	hookID string
+	event  string
+}
+
+var providerHeaders = map[ProviderName]deliveryHeaders{
+	GitHub:          {id: "X-GitHub-Delivery", hookID: "X-GitHub-Hook-ID", event: "X-GitHub-Event"},
+	GitLab:          {id: "X-Gitlab-Event-UUID", hookID: "X-Gitlab-Webhook-UUID", event: "X-Gitlab-Event"},
+	Gitea:           {id: "X-Gitea-Delivery", event: "X-Gitea-Event"},
+	Gogs:            {id: "X-Gogs-Delivery", event: "X-Gogs-Event"},
+	Bitbucket:       {id: "X-Request-UUID", hookID: "X-Hook-UUID", event: "X-Event-Key"},
+	BitbucketServer: {id: "X-Request-Id", event: "X-Event-Key"},
+}
+
+// NewDelivery returns the Delivery of the given provider with the metadata read
+// from the headers, the payload is left for the caller to fill in
+func NewDelivery(provider ProviderName, header http.Header, body []byte) *Delivery {
+	h := providerHeaders[provider]
+	delivery := &Delivery{
+		Provider:   provider,
+		UserAgent:  header.Get("User-Agent"),
+		Header:     header,
+		Body:       body,
+		ReceivedAt: time.Now(),
+	}
+	if h.id != "" {
+		delivery.ID = header.Get(h.id)
+	}
+	if h.hookID != "" {
+		delivery.HookID = header.Get(h.hookID)
+	}
+	if h.event != "" {
+		delivery.Event = header.Get(h.event)
+	}
+	return delivery
+}
+
+// DeliveryIDHeader returns the header carrying the delivery ID of the provider,
+// an empty string for providers without delivery ID
+func DeliveryIDHeader(provider ProviderName) string {
+	return providerHeaders[provider].id
+}
+
+// NewDeliveryID returns a random version 4 UUID, the form forges use for delivery IDs
+func NewDeliveryID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// MarshalPayload returns the body delivering the payload, []byte and json.RawMessage
+// payloads are returned as they are and any other payload is encoded to JSON
+func MarshalPayload(payload interface{}) ([]byte, error) {
+	switch pl := payload.(type) {
+	case []byte:
+		return pl, nil
+	case json.RawMessage:
+		return pl, nil
+	default:
+		return json.Marshal(payload)
+	}
+}
@@ -11,6 +11,9 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"time"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
 )
 
 // Server Path
@@ -24,6 +27,12 @@ var (
 	ErrParsingPayload    = errors.New("error parsing payload")
 )
 
+// outcomes label the parse errors reported to the ParseObserver
+var outcomes = map[error]string{
+	ErrInvalidHTTPMethod: "invalid_http_method",
+	ErrParsingPayload:    "parsing_payload",
+}
+
 // Event defines a Docker hook event type
 type Event string
 
@@ -61,37 +70,188 @@ type BuildPayload struct {
 	} `json:"repository"`
 }
 
+// Option is a configuration option for the webhook
+type Option func(*Webhook) error
+
+// Options is a namespace var for configuration options
+var Options = WebhookOptions{}
+
+// WebhookOptions is a namespace for configuration option methods
+type WebhookOptions struct{}
+
+// Observer registers the observer notified of the outcome of every delivery
+// handed to a Parse method, e.g. the metrics collector of the metrics package
+func (WebhookOptions) Observer(observer webhooks.ParseObserver) Option {
+	return func(hook *Webhook) error {
+		hook.observer = observer
+		return nil
+	}
+}
+
+// Logger registers the logger of verification failures, unknown events and
+// decode errors, nothing is logged by default
+func (WebhookOptions) Logger(logger webhooks.Logger) Option {
+	return func(hook *Webhook) error {
+		hook.logger = logger
+		return nil
+	}
+}
+
+// LogBodies adds the delivery bodies to the log records, they may carry secrets
+// and personal data so they are never logged otherwise
+func (WebhookOptions) LogBodies() Option {
+	return func(hook *Webhook) error {
+		hook.logBodies = true
+		return nil
+	}
+}
+
+// MaxBodyBytes sets the size limit of the delivery bodies, larger deliveries are
+// rejected with webhooks.ErrPayloadTooLarge. The limit is webhooks.DefaultMaxBodyBytes
+// by default and 0 or less disables it
+func (WebhookOptions) MaxBodyBytes(max int64) Option {
+	return func(hook *Webhook) error {
+		hook.maxBodyBytes = max
+		return nil
+	}
+}
+
 // Webhook instance contains all methods needed to process events
 type Webhook struct {
+	observer     webhooks.ParseObserver
+	logger       webhooks.Logger
+	logBodies    bool
+	maxBodyBytes int64
 }
 
 // New creates and returns a WebHook instance
-func New() (*Webhook, error) {
-	hook := new(Webhook)
+func New(options ...Option) (*Webhook, error) {
+	hook := &Webhook{maxBodyBytes: webhooks.DefaultMaxBodyBytes}
+	for _, opt := range options {
+		if err := opt(hook); err != nil {
+			return nil, errors.New("Error applying Option")
+		}
+	}
 	return hook, nil
 }
 
+// Name returns the provider name, it implements webhooks.Provider
+func (hook Webhook) Name() webhooks.ProviderName {
+	return webhooks.Docker
+}
+
+// ParseAny verifies and parses any known event and returns the payload object or an error
+func (hook Webhook) ParseAny(r *http.Request) (interface{}, error) {
+	return hook.Parse(r, BuildEvent)
+}
+
+// ParseDelivery verifies and parses the events specified like Parse and returns the
+// payload together with the delivery metadata and raw body. Once the body has been
+// read the delivery is returned alongside parse errors too
+func (hook Webhook) ParseDelivery(r *http.Request, events ...Event) (delivery *webhooks.Delivery, err error) {
+	var body []byte
+	defer func(start time.Time) {
+		_ = r.Body.Close()
+		hook.report(start, r.Header, body, err)
+	}(time.Now())
+
+	if r.Method != http.MethodPost {
+		return nil, ErrInvalidHTTPMethod
+	}
+
+	body, err = webhooks.ReadBody(r.Body, hook.maxBodyBytes)
+	if err == webhooks.ErrPayloadTooLarge {
+		return nil, err
+	}
+	if err != nil {
+		return nil, ErrParsingPayload
+	}
+	delivery = webhooks.NewDelivery(webhooks.Docker, r.Header, body)
+	delivery.Payload, err = parse(body)
+	return delivery, err
+}
+
+// Normalize always returns webhooks.ErrNotNormalizable, Docker Hub builds
+// have no normalized form
+func Normalize(payload interface{}) ([]webhooks.NormalizedEvent, error) {
+	return nil, webhooks.ErrNotNormalizable
+}
+
+// Normalize converts a payload returned by Parse into normalized events, it implements webhooks.Provider
+func (hook Webhook) Normalize(payload interface{}) ([]webhooks.NormalizedEvent, error) {
+	return Normalize(payload)
+}
+
 // Parse verifies and parses the events specified and returns the payload object or an error
-func (hook Webhook) Parse(r *http.Request, events ...Event) (interface{}, error) {
-	defer func() {
+func (hook Webhook) Parse(r *http.Request, events ...Event) (pl interface{}, err error) {
+	var payload []byte
+	defer func(start time.Time) {
 		_, _ = io.Copy(ioutil.Discard, r.Body)
 		_ = r.Body.Close()
-	}()
+		hook.report(start, r.Header, payload, err)
+	}(time.Now())
 
 	if r.Method != http.MethodPost {
 		return nil, ErrInvalidHTTPMethod
 	}
 
-	payload, err := ioutil.ReadAll(r.Body)
-	if err != nil || len(payload) == 0 {
+	payload, err = webhooks.ReadBody(r.Body, hook.maxBodyBytes)
+	if err == webhooks.ErrPayloadTooLarge {
+		return nil, err
+	}
+	if err != nil {
+		return nil, ErrParsingPayload
+	}
+	return parse(payload)
+}
+
+// ParseBytes parses the build payload from the delivery headers and body, for
+// deliveries received without an *http.Request
+func (hook Webhook) ParseBytes(headers http.Header, payload []byte, events ...Event) (interface{}, error) {
+	start := time.Now()
+	if hook.maxBodyBytes > 0 && int64(len(payload)) > hook.maxBodyBytes {
+		hook.report(start, headers, payload, webhooks.ErrPayloadTooLarge)
+		return nil, webhooks.ErrPayloadTooLarge
+	}
+	pl, err := parse(payload)
+	hook.report(start, headers, payload, err)
+	return pl, err
+}
+
+// parse decodes the build payload
+func parse(payload []byte) (interface{}, error) {
+	if len(payload) == 0 {
 		return nil, ErrParsingPayload
 	}
 
 	var pl BuildPayload
-	err = json.Unmarshal([]byte(payload), &pl)
+	err := json.Unmarshal([]byte(payload), &pl)
 	if err != nil {
 		return nil, ErrParsingPayload
 	}
 	return pl, err
+}
 
+// report notifies the registered observer and logger of the outcome of a delivery
+func (hook Webhook) report(start time.Time, headers http.Header, payload []byte, err error) {
+	if hook.observer == nil && hook.logger == nil {
+		return
+	}
+	o := webhooks.ParseObservation{
+		Provider: webhooks.Docker,
+		Event:    string(BuildEvent),
+		Outcome:  webhooks.Outcome(err, outcomes),
+		Size:     len(payload),
+		Duration: time.Since(start),
+	}
+	if hook.observer != nil {
+		hook.observer.ObserveParse(o)
+	}
+	if hook.logger != nil {
+		var body []byte
+		if hook.logBodies {
+			body = payload
+		}
+		webhooks.LogParse(hook.logger, o, "", err, body)
+	}
 }
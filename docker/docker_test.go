@@ -1,6 +1,8 @@
 package docker
 
 import (
+	"bytes"
+	"context"
 	"log"
 	"net/http"
 	"net/http/httptest"
@@ -10,6 +12,8 @@ import (
 	"reflect"
 
 	"github.com/stretchr/testify/require"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
 )
 
 // NOTES:
@@ -89,3 +93,103 @@ func TestWebhooks(t *testing.T) {
 		})
 	}
 }
+
+func TestParseDelivery(t *testing.T) {
+	assert := require.New(t)
+	body, err := os.ReadFile("../testdata/docker/docker_hub_build_notice.json")
+	assert.NoError(err)
+
+	req := httptest.NewRequest(http.MethodPost, ServerPath, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "python-requests/2.9.1")
+	delivery, err := hook.ParseDelivery(req, BuildEvent)
+	assert.NoError(err)
+	assert.Equal(webhooks.Docker, delivery.Provider)
+	assert.Empty(delivery.ID)
+	assert.Equal("python-requests/2.9.1", delivery.UserAgent)
+	assert.Equal(body, delivery.Body)
+	assert.False(delivery.ReceivedAt.IsZero())
+	assert.IsType(BuildPayload{}, delivery.Payload)
+
+	// the delivery is returned alongside the errors once the body has been read
+	req = httptest.NewRequest(http.MethodPost, ServerPath, bytes.NewReader([]byte("{")))
+	delivery, err = hook.ParseDelivery(req, BuildEvent)
+	assert.Equal(ErrParsingPayload, err)
+	assert.Equal([]byte("{"), delivery.Body)
+	assert.Nil(delivery.Payload)
+
+	_, err = hook.ParseDelivery(httptest.NewRequest(http.MethodGet, ServerPath, nil), BuildEvent)
+	assert.Equal(ErrInvalidHTTPMethod, err)
+}
+
+func TestParseBytes(t *testing.T) {
+	assert := require.New(t)
+	body, err := os.ReadFile("../testdata/docker/docker_hub_build_notice.json")
+	assert.NoError(err)
+
+	tests := []struct {
+		name string
+		body []byte
+		err  error
+	}{
+		{
+			name: "Parsed",
+			body: body,
+		},
+		{
+			name: "InvalidJSON",
+			body: []byte("{"),
+			err:  ErrParsingPayload,
+		},
+		{
+			name: "EmptyBody",
+			err:  ErrParsingPayload,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			results, err := hook.ParseBytes(http.Header{}, tc.body, BuildEvent)
+			if tc.err != nil {
+				assert.Equal(tc.err, err)
+				return
+			}
+			assert.NoError(err)
+			assert.IsType(BuildPayload{}, results)
+		})
+	}
+}
+
+func TestRouter(t *testing.T) {
+	assert := require.New(t)
+	payload, err := os.ReadFile("../testdata/docker/docker_hub_build_notice.json")
+	assert.NoError(err)
+
+	serve := func(router *Router, method string, body []byte) int {
+		req := httptest.NewRequest(method, ServerPath, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// deliveries are answered 204 No Content until a callback is registered
+	router := NewRouter(hook)
+	assert.Equal(http.StatusNoContent, serve(router, http.MethodPost, payload))
+
+	var tag string
+	router.OnBuild(func(ctx context.Context, pl BuildPayload) error {
+		tag = pl.PushData.Tag
+		return nil
+	})
+	assert.Equal(http.StatusOK, serve(router, http.MethodPost, payload))
+	assert.Equal("latest", tag)
+
+	// Docker Hub deliveries aren't signed, invalid ones are rejected before the callback
+	tag = ""
+	assert.Equal(http.StatusBadRequest, serve(router, http.MethodPost, []byte("{")))
+	assert.Equal(http.StatusMethodNotAllowed, serve(router, http.MethodGet, payload))
+	assert.Empty(tag)
+}
@@ -0,0 +1,63 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+)
+
+// Router dispatches the Docker Hub build deliveries to the registered callback.
+// It implements http.Handler
+type Router struct {
+	hook    *Webhook
+	onBuild func(ctx context.Context, pl BuildPayload) error
+}
+
+// NewRouter creates and returns a Router parsing the deliveries with the given Webhook
+func NewRouter(hook *Webhook) *Router {
+	return &Router{hook: hook}
+}
+
+// OnBuild registers the callback for the BuildEvent, registering it twice
+// replaces the previous callback. Callbacks must be registered before serving
+func (router *Router) OnBuild(fn func(ctx context.Context, pl BuildPayload) error) {
+	router.onBuild = fn
+}
+
+// ServeHTTP parses the delivery and calls the registered callback.
+//
+// Deliveries without callback are answered with 204 No Content, invalid methods
+// with 405 Method Not Allowed and malformed deliveries with 400 Bad Request.
+// Callback errors are answered with 500 Internal Server Error unless they are
+// a webhooks.StatusError
+func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	payload, err := router.hook.Parse(r, BuildEvent)
+	if err != nil {
+		http.Error(w, err.Error(), StatusCode(err))
+		return
+	}
+
+	if router.onBuild == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err := router.onBuild(r.Context(), payload.(BuildPayload)); err != nil {
+		code := webhooks.StatusCode(err)
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// StatusCode maps the errors returned by Parse onto HTTP status codes
+func StatusCode(err error) int {
+	if errors.Is(err, ErrInvalidHTTPMethod) {
+		return http.StatusMethodNotAllowed
+	}
+	if errors.Is(err, webhooks.ErrPayloadTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,24 @@
+package docker
+
+import (
+	"bytes"
+	"net/http"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+)
+
+// NewRequest returns a POST request to url delivering the build payload the way
+// Docker Hub does, Docker Hub deliveries are not signed. The payload is encoded
+// as by webhooks.MarshalPayload
+func NewRequest(url string, payload interface{}) (*http.Request, error) {
+	body, err := webhooks.MarshalPayload(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
@@ -0,0 +1,211 @@
+package webhooks
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Drift describes a delivery whose payload didn't map exactly onto the struct it
+// was decoded into, which tells when the payload structs drift from the forge API.
+// Paths are dot separated JSON field names, [] stands for the array elements and
+// * for the map values, e.g. commits[].author.username
+type Drift struct {
+	Provider ProviderName
+	Event    string
+	Delivery string
+	// Type is the Go type of the payload, e.g. github.PushPayload
+	Type string
+	// Unknown are the paths of the payload fields without struct field, they are
+	// dropped by the decoder
+	Unknown []string
+	// Missing are the paths of the struct fields absent from the payload, the
+	// fields of absent objects aren't reported
+	Missing []string
+}
+
+// DriftObserver is notified of the deliveries whose payload drifted from its
+// struct by the provider Webhooks in strict mode, it must be safe for concurrent use
+type DriftObserver interface {
+	ObserveDrift(drift Drift)
+}
+
+// DriftObserverFunc is an adapter allowing ordinary functions to be used as DriftObserver
+type DriftObserverFunc func(drift Drift)
+
+// ObserveDrift calls f(drift)
+func (f DriftObserverFunc) ObserveDrift(drift Drift) {
+	f(drift)
+}
+
+var (
+	jsonUnmarshaler = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// DetectDrift returns the paths of the payload fields that don't map onto a field
+// of the type of v and the paths of the fields of v absent from the payload,
+// matching names the way encoding/json does. Types implementing json.Unmarshaler
+// or encoding.TextUnmarshaler and interfaces are not inspected
+func DetectDrift(payload []byte, v interface{}) (unknown, missing []string, err error) {
+	var tree interface{}
+	if err := json.Unmarshal(payload, &tree); err != nil {
+		return nil, nil, err
+	}
+	d := &drifter{unknown: make(map[string]bool), missing: make(map[string]bool)}
+	d.walk("", tree, reflect.TypeOf(v))
+	return sorted(d.unknown), sorted(d.missing), nil
+}
+
+type drifter struct {
+	unknown map[string]bool
+	missing map[string]bool
+}
+
+func (d *drifter) walk(path string, value interface{}, t reflect.Type) {
+	if value == nil || t == nil {
+		return
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Interface || reflect.PtrTo(t).Implements(jsonUnmarshaler) || reflect.PtrTo(t).Implements(textUnmarshaler) {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return
+		}
+		fields := structFields(t)
+		seen := make(map[string]bool, len(fields))
+		for name, v := range object {
+			field, ok := matchField(fields, name)
+			if !ok {
+				d.unknown[join(path, name)] = true
+				continue
+			}
+			seen[field.name] = true
+			d.walk(join(path, name), v, field.typ)
+		}
+		for _, field := range fields {
+			if !seen[field.name] {
+				d.missing[join(path, field.name)] = true
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		array, ok := value.([]interface{})
+		if !ok {
+			return
+		}
+		for _, v := range array {
+			d.walk(path+"[]", v, t.Elem())
+		}
+	case reflect.Map:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for _, v := range object {
+			d.walk(join(path, "*"), v, t.Elem())
+		}
+	}
+}
+
+type structField struct {
+	name string
+	typ  reflect.Type
+}
+
+// structFields returns the fields decoded by encoding/json, the fields of
+// embedded structs without name included
+func structFields(t reflect.Type) []structField {
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			fields = append(fields, structFields(ft)...)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, structField{name: name, typ: f.Type})
+	}
+	return fields
+}
+
+// matchField returns the field of the JSON name, preferring an exact match to a
+// case insensitive one like encoding/json
+func matchField(fields []structField, name string) (structField, bool) {
+	for _, f := range fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.name, name) {
+			return f, true
+		}
+	}
+	return structField{}, false
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func sorted(set map[string]bool) []string {
+	if len(set) == 0 {
+		return nil
+	}
+	paths := make([]string, 0, len(set))
+	for path := range set {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// ReportDrift notifies the observers when the payload decoded into v drifted from
+// it, decoding errors are left to the decoder and raw events aren't inspected
+func ReportDrift(observers []DriftObserver, provider ProviderName, event, delivery string, payload []byte, v interface{}) {
+	if _, raw := v.(RawEvent); raw || len(observers) == 0 {
+		return
+	}
+	unknown, missing, err := DetectDrift(payload, v)
+	if err != nil || (len(unknown) == 0 && len(missing) == 0) {
+		return
+	}
+	drift := Drift{
+		Provider: provider,
+		Event:    event,
+		Delivery: delivery,
+		Type:     reflect.TypeOf(v).String(),
+		Unknown:  unknown,
+		Missing:  missing,
+	}
+	for _, o := range observers {
+		o.ObserveDrift(drift)
+	}
+}
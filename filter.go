@@ -0,0 +1,187 @@
+package webhooks
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Filter selects normalized events declaratively. Every field that is set must
+// match and a field matches when any of its patterns does. Patterns are globs
+// with the syntax of path.Match where a "**" segment also matches any number of
+// segments, e.g. "refs/heads/release/*" or "services/api/**". Brackets start a
+// character class and must be escaped to be matched, e.g. `*\[bot\]`
+type Filter struct {
+	// Kinds are the kinds of the selected events
+	Kinds []EventKind `json:"kinds,omitempty"`
+	// Refs match the fully qualified ref of pushes and tags (refs/tags/<name>)
+	// and the target branch of pull requests (refs/heads/<branch>). Issues and
+	// releases have no ref and never match
+	Refs []string `json:"refs,omitempty"`
+	// Paths match the paths added, modified or removed by the commits of pushes,
+	// other events aren't filtered on paths. Pushes of providers that don't list
+	// the changed paths, i.e. Bitbucket and Bitbucket Server, never match
+	Paths []string `json:"paths,omitempty"`
+	// Senders match the login of the user that triggered the event
+	Senders []string `json:"senders,omitempty"`
+	// ExcludeSenders reject the events triggered by the matching logins, e.g. bots
+	ExcludeSenders []string `json:"exclude_senders,omitempty"`
+	// Actions match the normalized action of the event, pushes are "created",
+	// "deleted" or "updated" depending on the ref update
+	Actions []string `json:"actions,omitempty"`
+}
+
+// Validate returns an error wrapping path.ErrBadPattern for malformed patterns
+func (f Filter) Validate() error {
+	for _, patterns := range [][]string{f.Refs, f.Paths, f.Senders, f.ExcludeSenders, f.Actions} {
+		for _, pattern := range patterns {
+			if _, err := MatchGlob(pattern, ""); err != nil {
+				return fmt.Errorf("%w: %q", err, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// Match reports whether the event is selected by the filter, malformed patterns
+// never match
+func (f Filter) Match(event NormalizedEvent) bool {
+	if len(f.Kinds) > 0 && !containsKind(f.Kinds, event.Kind()) {
+		return false
+	}
+
+	fields := filterFieldsOf(event)
+	if len(f.Refs) > 0 && (fields.ref == "" || !matchAny(f.Refs, fields.ref)) {
+		return false
+	}
+	if len(f.Actions) > 0 && !matchAny(f.Actions, fields.action) {
+		return false
+	}
+	if len(f.Senders) > 0 && !matchAny(f.Senders, fields.sender) {
+		return false
+	}
+	if len(f.ExcludeSenders) > 0 && matchAny(f.ExcludeSenders, fields.sender) {
+		return false
+	}
+	if len(f.Paths) > 0 && fields.commits != nil && !matchChangedPaths(f.Paths, fields.commits) {
+		return false
+	}
+	return true
+}
+
+// Select returns the events matched by the filter, usually the events returned
+// by a Normalize function
+func (f Filter) Select(events []NormalizedEvent) []NormalizedEvent {
+	var selected []NormalizedEvent
+	for _, event := range events {
+		if f.Match(event) {
+			selected = append(selected, event)
+		}
+	}
+	return selected
+}
+
+// filterFields are the values of a normalized event the filters match
+type filterFields struct {
+	ref    string
+	action string
+	sender string
+	// commits is not nil for pushes only
+	commits []NormalizedCommit
+}
+
+func filterFieldsOf(event NormalizedEvent) filterFields {
+	switch e := event.(type) {
+	case NormalizedPush:
+		action := ActionUpdated
+		switch {
+		case e.Created:
+			action = ActionCreated
+		case e.Deleted:
+			action = ActionDeleted
+		}
+		commits := e.Commits
+		if commits == nil {
+			commits = []NormalizedCommit{}
+		}
+		return filterFields{ref: e.Ref, action: action, sender: e.Sender.Login, commits: commits}
+	case NormalizedPullRequest:
+		return filterFields{ref: "refs/heads/" + e.TargetBranch, action: e.Action, sender: e.Sender.Login}
+	case NormalizedIssue:
+		return filterFields{action: e.Action, sender: e.Sender.Login}
+	case NormalizedTag:
+		return filterFields{ref: "refs/tags/" + e.Name, action: e.Action, sender: e.Sender.Login}
+	case NormalizedRelease:
+		return filterFields{action: e.Action, sender: e.Sender.Login}
+	default:
+		return filterFields{}
+	}
+}
+
+func containsKind(kinds []EventKind, kind EventKind) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := MatchGlob(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func matchChangedPaths(patterns []string, commits []NormalizedCommit) bool {
+	for _, commit := range commits {
+		for _, paths := range [][]string{commit.Added, commit.Modified, commit.Removed} {
+			for _, p := range paths {
+				if matchAny(patterns, p) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// MatchGlob reports whether name matches the slash separated glob pattern, a
+// "**" segment matching any number of segments and the other segments being
+// matched with path.Match. The only possible error is path.ErrBadPattern
+func MatchGlob(pattern, name string) (bool, error) {
+	patterns := strings.Split(pattern, "/")
+	for _, p := range patterns {
+		if p == "**" {
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return false, err
+		}
+	}
+	return matchSegments(patterns, strings.Split(name, "/")), nil
+}
+
+func matchSegments(patterns, names []string) bool {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			for i := len(names); i >= 0; i-- {
+				if matchSegments(patterns[1:], names[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(names) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(patterns[0], names[0]); !ok {
+			return false
+		}
+		patterns, names = patterns[1:], names[1:]
+	}
+	return len(names) == 0
+}
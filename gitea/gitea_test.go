@@ -1,6 +1,8 @@
 package gitea
 
 import (
+	"bytes"
+	"context"
 	"log"
 	"net/http"
 	"net/http/httptest"
@@ -9,6 +11,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
 )
 
 // NOTES:
@@ -195,3 +199,159 @@ func TestWebhooks(t *testing.T) {
 		})
 	}
 }
+
+func TestParseDelivery(t *testing.T) {
+	assert := require.New(t)
+	body, err := os.ReadFile("../testdata/gitea/push-event.json")
+	assert.NoError(err)
+
+	req := httptest.NewRequest(http.MethodPost, ServerPath, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Go-http-client/1.1")
+	req.Header.Set("X-Gitea-Event", "push")
+	req.Header.Set("X-Gitea-Delivery", "f6266f16-1bf3-46a5-9ea4-602e06ead473")
+	req.Header.Set("X-Gitea-Signature", "dc0bc1ab4a1e8f93a933fbfac3df3182072a02899436b26224eeb3cf28392037")
+	delivery, err := hook.ParseDelivery(req, PushEvents)
+	assert.NoError(err)
+	assert.Equal(webhooks.Gitea, delivery.Provider)
+	assert.Equal("f6266f16-1bf3-46a5-9ea4-602e06ead473", delivery.ID)
+	assert.Equal("push", delivery.Event)
+	assert.Equal("Go-http-client/1.1", delivery.UserAgent)
+	assert.Equal(body, delivery.Body)
+	assert.False(delivery.ReceivedAt.IsZero())
+	assert.IsType(PushPayload{}, delivery.Payload)
+
+	// the delivery is returned alongside the errors once the body has been read
+	req = httptest.NewRequest(http.MethodPost, ServerPath, bytes.NewReader(body))
+	req.Header.Set("X-Gitea-Event", "push")
+	req.Header.Set("X-Gitea-Signature", "111")
+	delivery, err = hook.ParseDelivery(req, PushEvents)
+	assert.Equal(ErrHMACVerificationFailed, err)
+	assert.Equal(body, delivery.Body)
+	assert.Nil(delivery.Payload)
+}
+
+func TestParseBytes(t *testing.T) {
+	assert := require.New(t)
+	body, err := os.ReadFile("../testdata/gitea/push-event.json")
+	assert.NoError(err)
+
+	tests := []struct {
+		name    string
+		headers http.Header
+		body    []byte
+		err     error
+	}{
+		{
+			name: "Verified",
+			headers: http.Header{
+				"X-Gitea-Event":     []string{"push"},
+				"X-Gitea-Signature": []string{"dc0bc1ab4a1e8f93a933fbfac3df3182072a02899436b26224eeb3cf28392037"},
+			},
+			body: body,
+		},
+		{
+			name: "BadSignature",
+			headers: http.Header{
+				"X-Gitea-Event":     []string{"push"},
+				"X-Gitea-Signature": []string{"111"},
+			},
+			body: body,
+			err:  ErrHMACVerificationFailed,
+		},
+		{
+			name: "MissingSignature",
+			headers: http.Header{
+				"X-Gitea-Event": []string{"push"},
+			},
+			body: body,
+			err:  ErrMissingGiteaSignatureHeader,
+		},
+		{
+			name: "UnknownEvent",
+			headers: http.Header{
+				"X-Gitea-Event":     []string{"fork"},
+				"X-Gitea-Signature": []string{"dc0bc1ab4a1e8f93a933fbfac3df3182072a02899436b26224eeb3cf28392037"},
+			},
+			body: body,
+			err:  ErrEventNotFound,
+		},
+		{
+			name: "EmptyBody",
+			headers: http.Header{
+				"X-Gitea-Event":     []string{"push"},
+				"X-Gitea-Signature": []string{"dc0bc1ab4a1e8f93a933fbfac3df3182072a02899436b26224eeb3cf28392037"},
+			},
+			err: ErrParsingPayload,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			results, err := hook.ParseBytes(tc.headers, tc.body, PushEvents)
+			if tc.err != nil {
+				assert.Equal(tc.err, err)
+				return
+			}
+			assert.NoError(err)
+			assert.IsType(PushPayload{}, results)
+		})
+	}
+}
+
+func TestRouter(t *testing.T) {
+	assert := require.New(t)
+	payload, err := os.ReadFile("../testdata/gitea/push-event.json")
+	assert.NoError(err)
+
+	var ref string
+	router := NewRouter(hook)
+	router.OnPush(func(ctx context.Context, pl PushPayload) error {
+		ref = pl.Ref
+		return nil
+	})
+
+	tests := []struct {
+		name      string
+		event     string
+		signature string
+		code      int
+	}{
+		{
+			name:      "Dispatched",
+			event:     "push",
+			signature: "dc0bc1ab4a1e8f93a933fbfac3df3182072a02899436b26224eeb3cf28392037",
+			code:      http.StatusOK,
+		},
+		{
+			name:      "Unregistered",
+			event:     "create",
+			signature: "dc0bc1ab4a1e8f93a933fbfac3df3182072a02899436b26224eeb3cf28392037",
+			code:      http.StatusNoContent,
+		},
+		{
+			name:      "VerificationFailed",
+			event:     "push",
+			signature: "111",
+			code:      http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range tests {
+		ref = ""
+		req := httptest.NewRequest(http.MethodPost, ServerPath, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Gitea-Event", tc.event)
+		req.Header.Set("X-Gitea-Signature", tc.signature)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(tc.code, w.Code, tc.name)
+		if tc.code == http.StatusOK {
+			assert.Equal("refs/heads/master", ref)
+		} else {
+			assert.Empty(ref, tc.name)
+		}
+	}
+}
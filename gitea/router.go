@@ -0,0 +1,143 @@
+package gitea
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+)
+
+// HandlerFunc handles the payload returned by Parse for a registered event
+type HandlerFunc func(ctx context.Context, payload interface{}) error
+
+// Router dispatches the Gitea deliveries to the callbacks registered per event, the
+// events to parse are derived from the registered callbacks. It implements http.Handler
+type Router struct {
+	hook     *Webhook
+	handlers map[Event]HandlerFunc
+}
+
+// NewRouter creates and returns a Router parsing the deliveries with the given Webhook
+func NewRouter(hook *Webhook) *Router {
+	return &Router{
+		hook:     hook,
+		handlers: make(map[Event]HandlerFunc),
+	}
+}
+
+// On registers the callback for the given event, registering an event twice
+// replaces the previous callback. Callbacks must be registered before serving
+func (router *Router) On(event Event, fn HandlerFunc) {
+	router.handlers[event] = fn
+}
+
+// ServeHTTP parses the delivery and calls the callback registered for its event.
+//
+// Events without callback are answered with 204 No Content, invalid methods with
+// 405 Method Not Allowed, failed verifications with 401 Unauthorized and malformed
+// deliveries with 400 Bad Request. Callback errors are answered with 500 Internal
+// Server Error unless they are a webhooks.StatusError
+func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	events := make([]Event, 0, len(router.handlers))
+	for event := range router.handlers {
+		events = append(events, event)
+	}
+
+	payload, err := router.hook.Parse(r, events...)
+	if err != nil {
+		code := StatusCode(err)
+		if code == http.StatusNoContent {
+			w.WriteHeader(code)
+			return
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	handler, ok := router.handlers[Event(r.Header.Get("X-Gitea-Event"))]
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err := handler(r.Context(), payload); err != nil {
+		code := webhooks.StatusCode(err)
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// StatusCode maps the errors returned by Parse onto HTTP status codes
+func StatusCode(err error) int {
+	switch {
+	case errors.Is(err, ErrEventNotFound), errors.Is(err, ErrEventNotSpecifiedToParse):
+		return http.StatusNoContent
+	case errors.Is(err, ErrInvalidHTTPMethod):
+		return http.StatusMethodNotAllowed
+	case errors.Is(err, webhooks.ErrPayloadTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrMissingGiteaSignatureHeader), errors.Is(err, ErrHMACVerificationFailed):
+		return http.StatusUnauthorized
+	case errors.Is(err, webhooks.ErrSecretLookup):
+		return http.StatusInternalServerError
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// OnCreate registers the callback for the CreateEvents
+func (router *Router) OnCreate(fn func(ctx context.Context, pl CreatePayload) error) {
+	router.On(CreateEvents, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(CreatePayload))
+	})
+}
+
+// OnDelete registers the callback for the DeleteEvents
+func (router *Router) OnDelete(fn func(ctx context.Context, pl DeletePayload) error) {
+	router.On(DeleteEvents, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(DeletePayload))
+	})
+}
+
+// OnFork registers the callback for the ForkEvents
+func (router *Router) OnFork(fn func(ctx context.Context, pl ForkPayload) error) {
+	router.On(ForkEvents, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(ForkPayload))
+	})
+}
+
+// OnPush registers the callback for the PushEvents
+func (router *Router) OnPush(fn func(ctx context.Context, pl PushPayload) error) {
+	router.On(PushEvents, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PushPayload))
+	})
+}
+
+// OnIssues registers the callback for the IssuesEvents
+func (router *Router) OnIssues(fn func(ctx context.Context, pl IssuePayload) error) {
+	router.On(IssuesEvents, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(IssuePayload))
+	})
+}
+
+// OnPullRequest registers the callback for the PullRequestEvents
+func (router *Router) OnPullRequest(fn func(ctx context.Context, pl PullRequestPayload) error) {
+	router.On(PullRequestEvents, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PullRequestPayload))
+	})
+}
+
+// OnRepository registers the callback for the RepositoryEvents
+func (router *Router) OnRepository(fn func(ctx context.Context, pl RepositoryPayload) error) {
+	router.On(RepositoryEvents, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(RepositoryPayload))
+	})
+}
+
+// OnRelease registers the callback for the ReleaseEvents
+func (router *Router) OnRelease(fn func(ctx context.Context, pl ReleasePayload) error) {
+	router.On(ReleaseEvents, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(ReleasePayload))
+	})
+}
@@ -0,0 +1,40 @@
+package gitea
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+)
+
+// Sign returns the X-Gitea-Signature header value of the body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewRequest returns a POST request to url delivering the payload as the given
+// event with the headers Gitea sends, signed when the secret is not empty. The
+// payload is encoded as by webhooks.MarshalPayload
+func NewRequest(url string, event Event, payload interface{}, secret string) (*http.Request, error) {
+	body, err := webhooks.MarshalPayload(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Gitea/golang-webhooks")
+	req.Header.Set("X-Gitea-Event", string(event))
+	req.Header.Set("X-Gitea-Delivery", webhooks.NewDeliveryID())
+	if secret != "" {
+		req.Header.Set("X-Gitea-Signature", Sign(secret, body))
+	}
+	return req, nil
+}
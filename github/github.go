@@ -3,13 +3,19 @@ package github
 import (
 	"crypto/hmac"
 	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strings"
+	"time"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
 )
 
 const (
@@ -18,13 +24,50 @@ const (
 
 // parse errors
 var (
-	ErrEventNotSpecifiedToParse  = errors.New("no Event specified to parse")
-	ErrInvalidHTTPMethod         = errors.New("invalid HTTP Method")
-	ErrMissingGithubEventHeader  = errors.New("missing X-GitHub-Event Header")
-	ErrMissingHubSignatureHeader = errors.New("missing X-Hub-Signature Header")
-	ErrEventNotFound             = errors.New("event not defined to be parsed")
-	ErrParsingPayload            = errors.New("error parsing payload")
-	ErrHMACVerificationFailed    = errors.New("HMAC verification failed")
+	ErrEventNotSpecifiedToParse     = errors.New("no Event specified to parse")
+	ErrInvalidHTTPMethod            = errors.New("invalid HTTP Method")
+	ErrMissingGithubEventHeader     = errors.New("missing X-GitHub-Event Header")
+	ErrMissingHubSignatureHeader    = errors.New("missing X-Hub-Signature Header")
+	ErrMissingHubSignature256Header = errors.New("missing X-Hub-Signature-256 Header")
+	ErrMalformedSignature           = errors.New("malformed signature header")
+	ErrEventNotFound                = errors.New("event not defined to be parsed")
+	ErrParsingPayload               = errors.New("error parsing payload")
+	ErrHMACVerificationFailed       = errors.New("HMAC verification failed")
+	ErrInvalidSignaturePolicy       = errors.New("invalid signature policy")
+)
+
+// outcomes label the parse errors reported to the ParseObserver
+var outcomes = map[error]string{
+	ErrEventNotSpecifiedToParse:     "event_not_specified_to_parse",
+	ErrInvalidHTTPMethod:            "invalid_http_method",
+	ErrMissingGithubEventHeader:     "missing_github_event_header",
+	ErrMissingHubSignatureHeader:    "missing_hub_signature_header",
+	ErrMissingHubSignature256Header: "missing_hub_signature256_header",
+	ErrMalformedSignature:           "malformed_signature",
+	ErrEventNotFound:                webhooks.OutcomeEventNotFound,
+	ErrParsingPayload:               "parsing_payload",
+	ErrHMACVerificationFailed:       "hmac_verification_failed",
+}
+
+// verificationErrors are the parse errors of deliveries failing verification
+var verificationErrors = []error{
+	ErrMissingHubSignatureHeader,
+	ErrMissingHubSignature256Header,
+	ErrMalformedSignature,
+	ErrHMACVerificationFailed,
+}
+
+// SignaturePolicy selects the signature headers verified when a secret is set
+type SignaturePolicy int
+
+// Signature policies
+const (
+	// SignatureEither verifies X-Hub-Signature-256 when present and falls back to X-Hub-Signature
+	SignatureEither SignaturePolicy = iota
+	// SignatureRequireSHA256 only accepts X-Hub-Signature-256
+	SignatureRequireSHA256
+	// SignatureLegacySHA1 only verifies X-Hub-Signature
+	SignatureLegacySHA1
 )
 
 // Event defines a GitHub hook event type
@@ -99,22 +142,120 @@ var Options = WebhookOptions{}
 // WebhookOptions is a namespace for configuration option methods
 type WebhookOptions struct{}
 
-// Secret registers the GitHub secret
+// Secret registers the GitHub secret, it may be combined with other secrets to rotate them
 func (WebhookOptions) Secret(secret string) Option {
 	return func(hook *Webhook) error {
-		hook.secret = secret
+		hook.secrets = hook.secrets.Add(webhooks.Secret{Value: secret})
 		return nil
 	}
 }
 
+// Secrets registers several GitHub secrets, deliveries signed with any unexpired
+// secret are accepted and the matching label is reported by ParseDelivery
+func (WebhookOptions) Secrets(secrets ...webhooks.Secret) Option {
+	return func(hook *Webhook) error {
+		hook.secrets = hook.secrets.Add(secrets...)
+		return nil
+	}
+}
+
+// SignaturePolicy sets the signature headers verified when a secret is set,
+// SignatureEither by default
+func (WebhookOptions) SignaturePolicy(policy SignaturePolicy) Option {
+	return func(hook *Webhook) error {
+		switch policy {
+		case SignatureEither, SignatureRequireSHA256, SignatureLegacySHA1:
+			hook.policy = policy
+			return nil
+		default:
+			return ErrInvalidSignaturePolicy
+		}
+	}
+}
+
 // Webhook instance contains all methods needed to process events
 type Webhook struct {
-	secret string
+	secrets        webhooks.Secrets
+	secretProvider webhooks.SecretProvider
+	policy         SignaturePolicy
+	observer       webhooks.ParseObserver
+	logger         webhooks.Logger
+	logBodies      bool
+	maxBodyBytes   int64
+	catchAll       bool
+	drift          []webhooks.DriftObserver
+}
+
+// SecretProvider registers a provider resolving the secrets per delivery, they are
+// used alongside the registered secrets. Deliveries are always verified once a
+// provider is registered, the ones it resolves no secret for are rejected
+func (WebhookOptions) SecretProvider(provider webhooks.SecretProvider) Option {
+	return func(hook *Webhook) error {
+		hook.secretProvider = provider
+		return nil
+	}
+}
+
+// Observer registers the observer notified of the outcome of every delivery
+// handed to a Parse method, e.g. the metrics collector of the metrics package
+func (WebhookOptions) Observer(observer webhooks.ParseObserver) Option {
+	return func(hook *Webhook) error {
+		hook.observer = observer
+		return nil
+	}
+}
+
+// Logger registers the logger of verification failures, unknown events and
+// decode errors, nothing is logged by default
+func (WebhookOptions) Logger(logger webhooks.Logger) Option {
+	return func(hook *Webhook) error {
+		hook.logger = logger
+		return nil
+	}
+}
+
+// LogBodies adds the delivery bodies to the log records, they may carry secrets
+// and personal data so they are never logged otherwise
+func (WebhookOptions) LogBodies() Option {
+	return func(hook *Webhook) error {
+		hook.logBodies = true
+		return nil
+	}
+}
+
+// MaxBodyBytes sets the size limit of the delivery bodies, larger deliveries are
+// rejected with webhooks.ErrPayloadTooLarge. The limit is webhooks.DefaultMaxBodyBytes
+// by default and 0 or less disables it
+func (WebhookOptions) MaxBodyBytes(max int64) Option {
+	return func(hook *Webhook) error {
+		hook.maxBodyBytes = max
+		return nil
+	}
+}
+
+// CatchAll returns the deliveries of events that weren't specified to Parse or
+// that this package doesn't know as a webhooks.RawEvent instead of an error,
+// they are verified like any other delivery
+func (WebhookOptions) CatchAll() Option {
+	return func(hook *Webhook) error {
+		hook.catchAll = true
+		return nil
+	}
+}
+
+// Strict reports the payload fields that don't map onto the payload structs, and
+// the struct fields absent from the payloads, to the observers, e.g. the metrics
+// collector of the metrics package. The deliveries aren't rejected for it
+func (WebhookOptions) Strict(observers ...webhooks.DriftObserver) Option {
+	return func(hook *Webhook) error {
+		hook.drift = append(hook.drift, observers...)
+		return nil
+	}
 }
 
 // New creates and returns a WebHook instance denoted by the Provider type
 func New(options ...Option) (*Webhook, error) {
-	hook := new(Webhook)
+	hook := &Webhook{maxBodyBytes: webhooks.DefaultMaxBodyBytes}
 	for _, opt := range options {
 		if err := opt(hook); err != nil {
 			return nil, errors.New("Error applying Option")
@@ -123,12 +264,113 @@ func New(options ...Option) (*Webhook, error) {
 	return hook, nil
 }
 
-// Parse verifies and parses the events specified and returns the payload object or an error
-func (hook Webhook) Parse(r *http.Request, events ...Event) (interface{}, error) {
-	defer func() {
+// events parsed by ParseAny
+var allEvents = []Event{
+	CheckRunEvent,
+	CheckSuiteEvent,
+	CommitCommentEvent,
+	CreateEvent,
+	DeleteEvent,
+	DeployKeyEvent,
+	DeploymentEvent,
+	DeploymentStatusEvent,
+	ForkEvent,
+	GollumEvent,
+	InstallationEvent,
+	InstallationRepositoriesEvent,
+	IntegrationInstallationEvent,
+	IntegrationInstallationRepositoriesEvent,
+	IssueCommentEvent,
+	IssuesEvent,
+	LabelEvent,
+	MemberEvent,
+	MembershipEvent,
+	MilestoneEvent,
+	MetaEvent,
+	OrganizationEvent,
+	OrgBlockEvent,
+	PageBuildEvent,
+	PingEvent,
+	ProjectCardEvent,
+	ProjectColumnEvent,
+	ProjectEvent,
+	PublicEvent,
+	PullRequestEvent,
+	PullRequestReviewEvent,
+	PullRequestReviewCommentEvent,
+	PushEvent,
+	ReleaseEvent,
+	RepositoryEvent,
+	RepositoryVulnerabilityAlertEvent,
+	SecurityAdvisoryEvent,
+	StatusEvent,
+	TeamEvent,
+	TeamAddEvent,
+	WatchEvent,
+	WorkflowDispatchEvent,
+	WorkflowJobEvent,
+	WorkflowRunEvent,
+}
+
+// knownEvent reports whether the event is parsed into a payload of this package
+func knownEvent(event Event) bool {
+	for _, evt := range allEvents {
+		if evt == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Name returns the provider name, it implements webhooks.Provider
+func (hook Webhook) Name() webhooks.ProviderName {
+	return webhooks.GitHub
+}
+
+// ParseAny verifies and parses any known event and returns the payload object or an error
+func (hook Webhook) ParseAny(r *http.Request) (interface{}, error) {
+	return hook.Parse(r, allEvents...)
+}
+
+// ParseDelivery verifies and parses the events specified like Parse and returns the
+// payload together with the delivery metadata and raw body. Once the body has been
+// read the delivery is returned alongside parse errors too
+func (hook Webhook) ParseDelivery(r *http.Request, events ...Event) (delivery *webhooks.Delivery, err error) {
+	var body []byte
+	defer func(start time.Time) {
+		_ = r.Body.Close()
+		hook.report(start, r.Header, len(body), body, err)
+	}(time.Now())
+
+	if r.Method != http.MethodPost {
+		return nil, ErrInvalidHTTPMethod
+	}
+
+	body, err = webhooks.ReadBody(r.Body, hook.maxBodyBytes)
+	if err == webhooks.ErrPayloadTooLarge {
+		return nil, err
+	}
+	if err != nil {
+		return nil, ErrParsingPayload
+	}
+	delivery = webhooks.NewDelivery(webhooks.GitHub, r.Header, body)
+	var secret webhooks.Secret
+	delivery.Payload, secret, err = hook.parse(r, body, events...)
+	delivery.Secret = secret.Label
+	return delivery, err
+}
+
+// Parse verifies and parses the events specified and returns the payload object or an error.
+// Unless a SecretProvider is registered, bodies are logged or strict mode is on, the signature is
+// verified while the body is decoded so large deliveries are not buffered twice
+func (hook Webhook) Parse(r *http.Request, events ...Event) (pl interface{}, err error) {
+	var payload []byte
+	var size int
+	defer func(start time.Time) {
 		_, _ = io.Copy(ioutil.Discard, r.Body)
 		_ = r.Body.Close()
-	}()
+		hook.report(start, r.Header, size, payload, err)
+	}(time.Now())
 
 	if len(events) == 0 {
 		return nil, ErrEventNotSpecifiedToParse
@@ -137,214 +379,485 @@ func (hook Webhook) Parse(r *http.Request, events ...Event) (interface{}, error)
 		return nil, ErrInvalidHTTPMethod
 	}
 
-	event := r.Header.Get("X-GitHub-Event")
+	if hook.secretProvider == nil && !hook.logBodies && len(hook.drift) == 0 {
+		pl, size, err = hook.parseStream(r.Header, r.Body, events...)
+		return pl, err
+	}
+
+	payload, err = webhooks.ReadBody(r.Body, hook.maxBodyBytes)
+	size = len(payload)
+	if err == webhooks.ErrPayloadTooLarge {
+		return nil, err
+	}
+	if err != nil {
+		return nil, ErrParsingPayload
+	}
+	pl, _, err = hook.parse(r, payload, events...)
+	return pl, err
+}
+
+// ParseBytes verifies and parses the events specified from the delivery headers
+// and body, for deliveries received without an *http.Request
+func (hook Webhook) ParseBytes(headers http.Header, payload []byte, events ...Event) (interface{}, error) {
+	start := time.Now()
+	if hook.maxBodyBytes > 0 && int64(len(payload)) > hook.maxBodyBytes {
+		hook.report(start, headers, len(payload), payload, webhooks.ErrPayloadTooLarge)
+		return nil, webhooks.ErrPayloadTooLarge
+	}
+	pl, _, err := hook.parse(&http.Request{Header: headers}, payload, events...)
+	hook.report(start, headers, len(payload), payload, err)
+	return pl, err
+}
+
+// parse verifies and parses the events specified and returns the payload object
+// together with the secret that verified it, r only needs to carry the headers
+// when parsing raw deliveries
+func (hook Webhook) parse(r *http.Request, payload []byte, events ...Event) (interface{}, webhooks.Secret, error) {
+	headers := r.Header
+	gitHubEvent, err := checkEvent(headers, events)
+	raw := hook.catches(gitHubEvent, err)
+	if err != nil && !raw {
+		return nil, webhooks.Secret{}, err
+	}
+
+	if len(payload) == 0 {
+		return nil, webhooks.Secret{}, ErrParsingPayload
+	}
+
+	// If we have a Secret set, we should check the MAC
+	var secret webhooks.Secret
+	secrets, err := hook.resolveSecrets(r, payload)
+	if err != nil {
+		return nil, webhooks.Secret{}, err
+	}
+	if len(secrets) > 0 || hook.secretProvider != nil {
+		if secret, err = hook.verifySignature(secrets, headers, payload); err != nil {
+			return nil, webhooks.Secret{}, err
+		}
+	}
+
+	if raw {
+		pl, err := webhooks.NewRawEvent(string(gitHubEvent), headers, payload)
+		return pl, secret, err
+	}
+	pl, err := parsePayload(gitHubEvent, payload)
+	if err == nil {
+		webhooks.ReportDrift(hook.drift, webhooks.GitHub, string(gitHubEvent), webhooks.DeliveryID(headers), payload, pl)
+	}
+	return pl, secret, err
+}
+
+// checkEvent returns the event of the delivery, together with ErrEventNotFound
+// when it isn't one of the events specified
+func checkEvent(headers http.Header, events []Event) (Event, error) {
+	if len(events) == 0 {
+		return "", ErrEventNotSpecifiedToParse
+	}
+
+	event := headers.Get("X-GitHub-Event")
 	if event == "" {
-		return nil, ErrMissingGithubEventHeader
+		return "", ErrMissingGithubEventHeader
 	}
 	gitHubEvent := Event(event)
 
-	var found bool
 	for _, evt := range events {
 		if evt == gitHubEvent {
-			found = true
-			break
+			return gitHubEvent, nil
 		}
 	}
 	// event not defined to be parsed
-	if !found {
-		return nil, ErrEventNotFound
+	return gitHubEvent, ErrEventNotFound
+}
+
+// catches reports whether the delivery of the event checked by checkEvent is
+// returned as a webhooks.RawEvent in catch-all mode
+func (hook Webhook) catches(event Event, err error) bool {
+	return hook.catchAll && (err == ErrEventNotFound || (err == nil && !knownEvent(event)))
+}
+
+// parseStream verifies and parses the events specified while reading the body:
+// the HMAC of every registered secret is computed as the JSON decoder consumes
+// the body, so it is never buffered whole. The number of bytes read is returned
+// alongside, verification errors take precedence over decode errors
+func (hook Webhook) parseStream(headers http.Header, body io.Reader, events ...Event) (interface{}, int, error) {
+	gitHubEvent, err := checkEvent(headers, events)
+	raw := hook.catches(gitHubEvent, err)
+	if err != nil && !raw {
+		return nil, 0, err
 	}
 
-	payload, err := ioutil.ReadAll(r.Body)
-	if err != nil || len(payload) == 0 {
-		return nil, ErrParsingPayload
+	counter := &countingWriter{}
+	writers := []io.Writer{counter}
+	macs := make(map[string]hash.Hash, len(hook.secrets))
+	var signature, prefix string
+	var signatureErr error
+	if len(hook.secrets) > 0 {
+		var h func() hash.Hash
+		signature, prefix, h, signatureErr = hook.signatureHeader(headers)
+		if signatureErr == nil {
+			for _, secret := range hook.secrets {
+				mac := hmac.New(h, []byte(secret.Value))
+				macs[secret.Value] = mac
+				writers = append(writers, mac)
+			}
+		}
 	}
 
-	// If we have a Secret set, we should check the MAC
-	if len(hook.secret) > 0 {
-		signature := r.Header.Get("X-Hub-Signature")
-		if len(signature) == 0 {
-			return nil, ErrMissingHubSignatureHeader
+	tee := io.TeeReader(webhooks.LimitReader(body, hook.maxBodyBytes), io.MultiWriter(writers...))
+	dec := json.NewDecoder(tee)
+	var pl interface{}
+	var decodeErr error
+	if raw {
+		var body json.RawMessage
+		decodeErr = dec.Decode(&body)
+		pl = webhooks.RawEvent{Name: string(gitHubEvent), Headers: headers.Clone(), Body: body}
+	} else {
+		pl, decodeErr = decodePayload(gitHubEvent, dec.Decode)
+	}
+	if decodeErr == io.EOF {
+		decodeErr = io.ErrUnexpectedEOF
+	}
+
+	// anything but white space after the JSON value is invalid, as with json.Unmarshal
+	if decodeErr == nil {
+		var extra json.RawMessage
+		switch err := dec.Decode(&extra); {
+		case err == nil:
+			decodeErr = ErrParsingPayload
+		case err != io.EOF:
+			decodeErr = err
 		}
-		mac := hmac.New(sha1.New, []byte(hook.secret))
-		_, _ = mac.Write(payload)
-		expectedMAC := hex.EncodeToString(mac.Sum(nil))
+	}
+	if errors.Is(decodeErr, webhooks.ErrPayloadTooLarge) {
+		return nil, counter.n, webhooks.ErrPayloadTooLarge
+	}
+
+	// the MACs cover the whole body
+	if _, err := io.Copy(ioutil.Discard, tee); err != nil {
+		if err == webhooks.ErrPayloadTooLarge {
+			return nil, counter.n, err
+		}
+		return nil, counter.n, ErrParsingPayload
+	}
+	if counter.n == 0 {
+		return nil, 0, ErrParsingPayload
+	}
 
-		if !hmac.Equal([]byte(signature[5:]), []byte(expectedMAC)) {
-			return nil, ErrHMACVerificationFailed
+	if len(hook.secrets) > 0 {
+		if signatureErr != nil {
+			return nil, counter.n, signatureErr
+		}
+		if !strings.HasPrefix(signature, prefix) {
+			return nil, counter.n, ErrMalformedSignature
+		}
+		_, ok := hook.secrets.Match(func(secret string) bool {
+			expectedMAC := hex.EncodeToString(macs[secret].Sum(nil))
+			return hmac.Equal([]byte(signature[len(prefix):]), []byte(expectedMAC))
+		})
+		if !ok {
+			return nil, counter.n, ErrHMACVerificationFailed
 		}
 	}
 
+	if decodeErr != nil {
+		return nil, counter.n, decodeErr
+	}
+	return pl, counter.n, nil
+}
+
+// countingWriter counts the bytes written to it
+type countingWriter struct {
+	n int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += len(p)
+	return len(p), nil
+}
+
+// parsePayload decodes the payload of the event
+func parsePayload(gitHubEvent Event, payload []byte) (interface{}, error) {
+	return decodePayload(gitHubEvent, func(v interface{}) error {
+		return json.Unmarshal(payload, v)
+	})
+}
+
+// decodePayload decodes the payload of the event with the decode function
+func decodePayload(gitHubEvent Event, decode func(v interface{}) error) (interface{}, error) {
+	var err error
 	switch gitHubEvent {
 	case CheckRunEvent:
 		var pl CheckRunPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case CheckSuiteEvent:
 		var pl CheckSuitePayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case CommitCommentEvent:
 		var pl CommitCommentPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case CreateEvent:
 		var pl CreatePayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case DeployKeyEvent:
 		var pl DeployKeyPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case DeleteEvent:
 		var pl DeletePayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case DeploymentEvent:
 		var pl DeploymentPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case DeploymentStatusEvent:
 		var pl DeploymentStatusPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case ForkEvent:
 		var pl ForkPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case GollumEvent:
 		var pl GollumPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case InstallationEvent, IntegrationInstallationEvent:
 		var pl InstallationPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case InstallationRepositoriesEvent, IntegrationInstallationRepositoriesEvent:
 		var pl InstallationRepositoriesPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case IssueCommentEvent:
 		var pl IssueCommentPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case IssuesEvent:
 		var pl IssuesPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case LabelEvent:
 		var pl LabelPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case MemberEvent:
 		var pl MemberPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case MembershipEvent:
 		var pl MembershipPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case MetaEvent:
 		var pl MetaPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case MilestoneEvent:
 		var pl MilestonePayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case OrganizationEvent:
 		var pl OrganizationPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case OrgBlockEvent:
 		var pl OrgBlockPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case PageBuildEvent:
 		var pl PageBuildPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case PingEvent:
 		var pl PingPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case ProjectCardEvent:
 		var pl ProjectCardPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case ProjectColumnEvent:
 		var pl ProjectColumnPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case ProjectEvent:
 		var pl ProjectPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case PublicEvent:
 		var pl PublicPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case PullRequestEvent:
 		var pl PullRequestPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case PullRequestReviewEvent:
 		var pl PullRequestReviewPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case PullRequestReviewCommentEvent:
 		var pl PullRequestReviewCommentPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case PushEvent:
 		var pl PushPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case ReleaseEvent:
 		var pl ReleasePayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case RepositoryEvent:
 		var pl RepositoryPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case RepositoryVulnerabilityAlertEvent:
 		var pl RepositoryVulnerabilityAlertPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case SecurityAdvisoryEvent:
 		var pl SecurityAdvisoryPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case StatusEvent:
 		var pl StatusPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case TeamEvent:
 		var pl TeamPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case TeamAddEvent:
 		var pl TeamAddPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case WatchEvent:
 		var pl WatchPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case WorkflowDispatchEvent:
 		var pl WorkflowDispatchPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case WorkflowJobEvent:
 		var pl WorkflowJobPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	case WorkflowRunEvent:
 		var pl WorkflowRunPayload
-		err = json.Unmarshal([]byte(payload), &pl)
+		err = decode(&pl)
 		return pl, err
 	default:
 		return nil, fmt.Errorf("unknown event %s", gitHubEvent)
 	}
 }
+
+// verifySignature checks the signature header selected by the policy against the
+// payload and returns the secret that produced it
+func (hook Webhook) verifySignature(secrets webhooks.Secrets, headers http.Header, payload []byte) (webhooks.Secret, error) {
+	signature, prefix, h, err := hook.signatureHeader(headers)
+	if err != nil {
+		return webhooks.Secret{}, err
+	}
+	return matchMAC(secrets, signature, prefix, h, payload)
+}
+
+// signatureHeader returns the signature selected by the policy together with its
+// prefix and hash function
+func (hook Webhook) signatureHeader(headers http.Header) (string, string, func() hash.Hash, error) {
+	sha256Signature := headers.Get("X-Hub-Signature-256")
+	switch hook.policy {
+	case SignatureRequireSHA256:
+		if len(sha256Signature) == 0 {
+			return "", "", nil, ErrMissingHubSignature256Header
+		}
+		return sha256Signature, "sha256=", sha256.New, nil
+	case SignatureEither:
+		if len(sha256Signature) > 0 {
+			return sha256Signature, "sha256=", sha256.New, nil
+		}
+	}
+
+	signature := headers.Get("X-Hub-Signature")
+	if len(signature) == 0 {
+		return "", "", nil, ErrMissingHubSignatureHeader
+	}
+	return signature, "sha1=", sha1.New, nil
+}
+
+// matchMAC returns the secret whose HMAC of the payload matches the "<prefix><hex digest>" signature
+func matchMAC(secrets webhooks.Secrets, signature, prefix string, h func() hash.Hash, payload []byte) (webhooks.Secret, error) {
+	if !strings.HasPrefix(signature, prefix) {
+		return webhooks.Secret{}, ErrMalformedSignature
+	}
+	secret, ok := secrets.Match(func(secret string) bool {
+		mac := hmac.New(h, []byte(secret))
+		_, _ = mac.Write(payload)
+		expectedMAC := hex.EncodeToString(mac.Sum(nil))
+		return hmac.Equal([]byte(signature[len(prefix):]), []byte(expectedMAC))
+	})
+	if !ok {
+		return webhooks.Secret{}, ErrHMACVerificationFailed
+	}
+	return secret, nil
+}
+
+// resolveSecrets returns the secrets verifying the delivery, including the ones
+// resolved by the SecretProvider
+func (hook Webhook) resolveSecrets(r *http.Request, payload []byte) (webhooks.Secrets, error) {
+	if hook.secretProvider == nil {
+		return hook.secrets, nil
+	}
+	return webhooks.ResolveSecrets(hook.secrets, hook.secretProvider, r, peekRepository(payload))
+}
+
+// peekRepository returns the repository full name of the unverified payload
+func peekRepository(payload []byte) string {
+	var pl struct {
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+	}
+	_ = json.Unmarshal(payload, &pl)
+	return pl.Repository.FullName
+}
+
+// report notifies the registered observer and logger of the outcome of a delivery,
+// events missing from allEvents are reported as unknown to bound the label values
+func (hook Webhook) report(start time.Time, headers http.Header, size int, payload []byte, err error) {
+	if hook.observer == nil && hook.logger == nil {
+		return
+	}
+	event := webhooks.UnknownEvent
+	for _, evt := range allEvents {
+		if string(evt) == headers.Get("X-GitHub-Event") {
+			event = string(evt)
+			break
+		}
+	}
+	o := webhooks.ParseObservation{
+		Provider:           webhooks.GitHub,
+		Event:              event,
+		Outcome:            webhooks.Outcome(err, outcomes),
+		VerificationFailed: webhooks.VerificationFailed(err, verificationErrors),
+		Size:               size,
+		Duration:           time.Since(start),
+	}
+	if hook.observer != nil {
+		hook.observer.ObserveParse(o)
+	}
+	if hook.logger != nil {
+		var body []byte
+		if hook.logBodies {
+			body = payload
+		}
+		webhooks.LogParse(hook.logger, o, webhooks.DeliveryID(headers), err, body)
+	}
+}
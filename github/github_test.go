@@ -2,16 +2,20 @@ package github
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"io"
 
 	"reflect"
 
+	webhooks "github.com/heitormejias/golang-webhooks"
 	"github.com/stretchr/testify/require"
 )
 
@@ -605,3 +609,539 @@ func TestWebhooks(t *testing.T) {
 		})
 	}
 }
+
+func TestRouter(t *testing.T) {
+	assert := require.New(t)
+	tests := []struct {
+		name     string
+		filename string
+		headers  http.Header
+		err      error
+		expected int
+	}{
+		{
+			name:     "Handled",
+			filename: "../testdata/github/push.json",
+			headers: http.Header{
+				"X-Github-Event":  []string{"push"},
+				"X-Hub-Signature": []string{"sha1=0534736f52c2fc5896ef1bd5a043127b20d233ba"},
+			},
+			expected: http.StatusOK,
+		},
+		{
+			name:     "HandlerError",
+			filename: "../testdata/github/push.json",
+			headers: http.Header{
+				"X-Github-Event":  []string{"push"},
+				"X-Hub-Signature": []string{"sha1=0534736f52c2fc5896ef1bd5a043127b20d233ba"},
+			},
+			err:      errors.New("handler failed"),
+			expected: http.StatusInternalServerError,
+		},
+		{
+			name:     "HandlerStatusError",
+			filename: "../testdata/github/push.json",
+			headers: http.Header{
+				"X-Github-Event":  []string{"push"},
+				"X-Hub-Signature": []string{"sha1=0534736f52c2fc5896ef1bd5a043127b20d233ba"},
+			},
+			err:      &webhooks.StatusError{Code: http.StatusServiceUnavailable, Err: errors.New("busy")},
+			expected: http.StatusServiceUnavailable,
+		},
+		{
+			name:     "Unhandled",
+			filename: "../testdata/github/fork.json",
+			headers: http.Header{
+				"X-Github-Event":  []string{"fork"},
+				"X-Hub-Signature": []string{"sha1=cec5f8fb7c383514c622d3eb9e121891dfcca848"},
+			},
+			expected: http.StatusNoContent,
+		},
+		{
+			name:     "BadSignature",
+			filename: "../testdata/github/push.json",
+			headers: http.Header{
+				"X-Github-Event":  []string{"push"},
+				"X-Hub-Signature": []string{"sha1=0000000000000000000000000000000000000000"},
+			},
+			expected: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		client := &http.Client{}
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			payload, err := os.Open(tc.filename)
+			assert.NoError(err)
+			defer func() {
+				_ = payload.Close()
+			}()
+
+			var results PushPayload
+			router := NewRouter(hook)
+			router.OnPush(func(ctx context.Context, pl PushPayload) error {
+				results = pl
+				return tc.err
+			})
+			server := httptest.NewServer(router)
+			defer server.Close()
+			req, err := http.NewRequest(http.MethodPost, server.URL+path, payload)
+			assert.NoError(err)
+			req.Header = tc.headers
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := client.Do(req)
+			assert.NoError(err)
+			assert.Equal(tc.expected, resp.StatusCode)
+			if tc.expected == http.StatusOK {
+				assert.NotEmpty(results.Ref)
+			}
+		})
+	}
+}
+
+func TestParseDelivery(t *testing.T) {
+	assert := require.New(t)
+	body, err := os.ReadFile("../testdata/github/push.json")
+	assert.NoError(err)
+
+	var delivery *webhooks.Delivery
+	var parseError error
+	server := newServer(func(w http.ResponseWriter, r *http.Request) {
+		delivery, parseError = hook.ParseDelivery(r, PushEvent)
+	})
+	defer server.Close()
+	req, err := http.NewRequest(http.MethodPost, server.URL+path, bytes.NewReader(body))
+	assert.NoError(err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GitHub-Hookshot/044aadd")
+	req.Header.Set("X-Github-Event", "push")
+	req.Header.Set("X-Github-Delivery", "72d3162e-cc78-11e3-81ab-4c9367dc0958")
+	req.Header.Set("X-Github-Hook-Id", "292430182")
+	req.Header.Set("X-Hub-Signature", "sha1=0534736f52c2fc5896ef1bd5a043127b20d233ba")
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.NoError(parseError)
+	assert.Equal(webhooks.GitHub, delivery.Provider)
+	assert.Equal("72d3162e-cc78-11e3-81ab-4c9367dc0958", delivery.ID)
+	assert.Equal("292430182", delivery.HookID)
+	assert.Equal("push", delivery.Event)
+	assert.Equal("GitHub-Hookshot/044aadd", delivery.UserAgent)
+	assert.Equal(body, delivery.Body)
+	assert.False(delivery.ReceivedAt.IsZero())
+	assert.IsType(PushPayload{}, delivery.Payload)
+}
+
+func TestParseBytes(t *testing.T) {
+	assert := require.New(t)
+	body, err := os.ReadFile("../testdata/github/push.json")
+	assert.NoError(err)
+
+	tests := []struct {
+		name    string
+		headers http.Header
+		body    []byte
+		err     error
+	}{
+		{
+			name: "Verified",
+			headers: http.Header{
+				"X-Github-Event":  []string{"push"},
+				"X-Hub-Signature": []string{"sha1=0534736f52c2fc5896ef1bd5a043127b20d233ba"},
+			},
+			body: body,
+		},
+		{
+			name: "BadSignature",
+			headers: http.Header{
+				"X-Github-Event":  []string{"push"},
+				"X-Hub-Signature": []string{"sha1=0000000000000000000000000000000000000000"},
+			},
+			body: body,
+			err:  ErrHMACVerificationFailed,
+		},
+		{
+			name: "MissingSignature",
+			headers: http.Header{
+				"X-Github-Event": []string{"push"},
+			},
+			body: body,
+			err:  ErrMissingHubSignatureHeader,
+		},
+		{
+			name: "EmptyBody",
+			headers: http.Header{
+				"X-Github-Event":  []string{"push"},
+				"X-Hub-Signature": []string{"sha1=0534736f52c2fc5896ef1bd5a043127b20d233ba"},
+			},
+			err: ErrParsingPayload,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			results, err := hook.ParseBytes(tc.headers, tc.body, PushEvent)
+			if tc.err != nil {
+				assert.Equal(tc.err, err)
+				return
+			}
+			assert.NoError(err)
+			assert.IsType(PushPayload{}, results)
+		})
+	}
+}
+
+func TestSignaturePolicy(t *testing.T) {
+	assert := require.New(t)
+	body, err := os.ReadFile("../testdata/github/push.json")
+	assert.NoError(err)
+
+	const (
+		sha1Signature   = "sha1=0534736f52c2fc5896ef1bd5a043127b20d233ba"
+		sha256Signature = "sha256=abcee8ae5f5c28fc2e4d2a0ffe46115bf9dc9d7c2e34592846d9361fffb864d5"
+	)
+	tests := []struct {
+		name   string
+		policy SignaturePolicy
+		sha1   string
+		sha256 string
+		err    error
+	}{
+		{name: "EitherSHA256", policy: SignatureEither, sha256: sha256Signature},
+		{name: "EitherSHA1", policy: SignatureEither, sha1: sha1Signature},
+		{name: "EitherBadSHA256", policy: SignatureEither, sha1: sha1Signature, sha256: "sha256=00", err: ErrHMACVerificationFailed},
+		{name: "EitherMissing", policy: SignatureEither, err: ErrMissingHubSignatureHeader},
+		{name: "RequireSHA256", policy: SignatureRequireSHA256, sha256: sha256Signature},
+		{name: "RequireSHA256Missing", policy: SignatureRequireSHA256, sha1: sha1Signature, err: ErrMissingHubSignature256Header},
+		{name: "LegacySHA1", policy: SignatureLegacySHA1, sha1: sha1Signature, sha256: "sha256=00"},
+		{name: "LegacySHA1Missing", policy: SignatureLegacySHA1, sha256: sha256Signature, err: ErrMissingHubSignatureHeader},
+		{name: "MalformedPrefix", policy: SignatureEither, sha1: "sha", err: ErrMalformedSignature},
+		{name: "MalformedSHA256Prefix", policy: SignatureRequireSHA256, sha256: sha1Signature, err: ErrMalformedSignature},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			hook, err := New(Options.Secret("IsWishesWereHorsesWedAllBeEatingSteak!"), Options.SignaturePolicy(tc.policy))
+			assert.NoError(err)
+
+			headers := http.Header{}
+			headers.Set("X-Github-Event", "push")
+			if tc.sha1 != "" {
+				headers.Set("X-Hub-Signature", tc.sha1)
+			}
+			if tc.sha256 != "" {
+				headers.Set("X-Hub-Signature-256", tc.sha256)
+			}
+			_, err = hook.ParseBytes(headers, body, PushEvent)
+			assert.Equal(tc.err, err)
+		})
+	}
+
+	_, err = New(Options.SignaturePolicy(SignaturePolicy(42)))
+	assert.Error(err)
+}
+
+func TestSecrets(t *testing.T) {
+	assert := require.New(t)
+	body, err := os.ReadFile("../testdata/github/push.json")
+	assert.NoError(err)
+
+	tests := []struct {
+		name    string
+		secrets []webhooks.Secret
+		label   string
+		err     error
+	}{
+		{
+			name: "Rotated",
+			secrets: []webhooks.Secret{
+				{Value: "previous", Label: "previous"},
+				{Value: "IsWishesWereHorsesWedAllBeEatingSteak!", Label: "current"},
+			},
+			label: "current",
+		},
+		{
+			name: "Expired",
+			secrets: []webhooks.Secret{
+				{Value: "IsWishesWereHorsesWedAllBeEatingSteak!", Label: "current", ExpiresAt: time.Now().Add(-time.Minute)},
+			},
+			err: ErrHMACVerificationFailed,
+		},
+		{
+			name: "NotExpired",
+			secrets: []webhooks.Secret{
+				{Value: "IsWishesWereHorsesWedAllBeEatingSteak!", Label: "current", ExpiresAt: time.Now().Add(time.Hour)},
+			},
+			label: "current",
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			hook, err := New(Options.Secrets(tc.secrets...))
+			assert.NoError(err)
+
+			req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+			req.Header.Set("X-Github-Event", "push")
+			req.Header.Set("X-Hub-Signature", "sha1=0534736f52c2fc5896ef1bd5a043127b20d233ba")
+			delivery, err := hook.ParseDelivery(req, PushEvent)
+			assert.Equal(tc.err, err)
+			if tc.err == nil {
+				assert.Equal(tc.label, delivery.Secret)
+			}
+		})
+	}
+}
+
+func TestSecretProvider(t *testing.T) {
+	assert := require.New(t)
+	body, err := os.ReadFile("../testdata/github/push.json")
+	assert.NoError(err)
+
+	secrets := map[string][]string{
+		"binkkatal/sample_app": {"IsWishesWereHorsesWedAllBeEatingSteak!"},
+	}
+	tests := []struct {
+		name     string
+		provider webhooks.SecretProviderFunc
+		err      error
+	}{
+		{
+			name: "Resolved",
+			provider: func(r *http.Request, unverifiedRepo string) ([]string, error) {
+				return secrets[unverifiedRepo], nil
+			},
+		},
+		{
+			name: "UnknownTenant",
+			provider: func(r *http.Request, unverifiedRepo string) ([]string, error) {
+				return nil, nil
+			},
+			err: ErrHMACVerificationFailed,
+		},
+		{
+			name: "LookupFailed",
+			provider: func(r *http.Request, unverifiedRepo string) ([]string, error) {
+				return nil, errors.New("store unavailable")
+			},
+			err: webhooks.ErrSecretLookup,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			hook, err := New(Options.SecretProvider(tc.provider))
+			assert.NoError(err)
+
+			headers := http.Header{}
+			headers.Set("X-Github-Event", "push")
+			headers.Set("X-Hub-Signature", "sha1=0534736f52c2fc5896ef1bd5a043127b20d233ba")
+			_, err = hook.ParseBytes(headers, body, PushEvent)
+			if tc.err != nil {
+				assert.True(errors.Is(err, tc.err))
+				return
+			}
+			assert.NoError(err)
+		})
+	}
+}
+
+func TestParseStream(t *testing.T) {
+	assert := require.New(t)
+	body, err := os.ReadFile("../testdata/github/push.json")
+	assert.NoError(err)
+	const secret = "IsWishesWereHorsesWedAllBeEatingSteak!"
+	trailing := append(append([]byte{}, body...), " x"...)
+	whitespace := append(append([]byte{}, body...), " \n"...)
+	truncated := body[:len(body)/2]
+
+	tests := []struct {
+		name      string
+		body      []byte
+		signature string
+		sha1      bool
+		err       error
+		outcome   string
+	}{
+		{
+			name:      "Verified",
+			body:      body,
+			signature: Sign(secret, body),
+		},
+		{
+			name:      "VerifiedSHA1",
+			body:      body,
+			signature: SignSHA1(secret, body),
+			sha1:      true,
+		},
+		{
+			name:      "TrailingWhiteSpace",
+			body:      whitespace,
+			signature: Sign(secret, whitespace),
+		},
+		{
+			name:      "Forged",
+			body:      body,
+			signature: Sign("forged", body),
+			err:       ErrHMACVerificationFailed,
+		},
+		{
+			name:      "ForgedInvalidJSON",
+			body:      truncated,
+			signature: Sign("forged", truncated),
+			err:       ErrHMACVerificationFailed,
+		},
+		{
+			name:      "SignedInvalidJSON",
+			body:      truncated,
+			signature: Sign(secret, truncated),
+			outcome:   webhooks.OutcomeInvalidJSON,
+		},
+		{
+			name:      "SignedTrailingData",
+			body:      trailing,
+			signature: Sign(secret, trailing),
+			outcome:   webhooks.OutcomeInvalidJSON,
+		},
+		{
+			name: "MissingSignature",
+			body: body,
+			err:  ErrMissingHubSignatureHeader,
+		},
+		{
+			name:      "MalformedSignature",
+			body:      body,
+			signature: "md5=abc",
+			err:       ErrMalformedSignature,
+		},
+		{
+			name:      "EmptyBody",
+			signature: Sign(secret, nil),
+			err:       ErrParsingPayload,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var outcomes []string
+			hook, err := New(
+				Options.Secrets(webhooks.Secret{Value: "previous"}, webhooks.Secret{Value: secret}),
+				Options.Observer(webhooks.ParseObserverFunc(func(o webhooks.ParseObservation) {
+					outcomes = append(outcomes, o.Outcome)
+				})),
+			)
+			assert.NoError(err)
+
+			newRequest := func() *http.Request {
+				req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(tc.body))
+				req.Header.Set("X-Github-Event", "push")
+				if tc.signature != "" && tc.sha1 {
+					req.Header.Set("X-Hub-Signature", tc.signature)
+				} else if tc.signature != "" {
+					req.Header.Set("X-Hub-Signature-256", tc.signature)
+				}
+				return req
+			}
+
+			streamed, streamErr := hook.Parse(newRequest(), PushEvent)
+			delivery, bufferedErr := hook.ParseDelivery(newRequest(), PushEvent)
+			switch {
+			case tc.err != nil:
+				assert.Equal(tc.err, streamErr)
+				assert.Equal(tc.err, bufferedErr)
+			case tc.outcome != "":
+				assert.Error(streamErr)
+				assert.Error(bufferedErr)
+			default:
+				assert.NoError(streamErr)
+				assert.NoError(bufferedErr)
+				assert.Equal(delivery.Payload, streamed)
+			}
+			assert.Len(outcomes, 2)
+			assert.Equal(outcomes[1], outcomes[0])
+			if tc.outcome != "" {
+				assert.Equal(tc.outcome, outcomes[0])
+			}
+		})
+	}
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	assert := require.New(t)
+	body, err := os.ReadFile("../testdata/github/push.json")
+	assert.NoError(err)
+	const secret = "IsWishesWereHorsesWedAllBeEatingSteak!"
+
+	tests := []struct {
+		name string
+		max  int64
+		err  error
+	}{
+		{
+			name: "Default",
+			max:  webhooks.DefaultMaxBodyBytes,
+		},
+		{
+			name: "Exact",
+			max:  int64(len(body)),
+		},
+		{
+			name: "Disabled",
+			max:  0,
+		},
+		{
+			name: "TooLarge",
+			max:  int64(len(body)) - 1,
+			err:  webhooks.ErrPayloadTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			hook, err := New(Options.Secret(secret), Options.MaxBodyBytes(tc.max))
+			assert.NoError(err)
+
+			newRequest := func() *http.Request {
+				req, err := NewRequest(path, PushEvent, body, secret)
+				assert.NoError(err)
+				return req
+			}
+
+			_, err = hook.Parse(newRequest(), PushEvent)
+			assert.Equal(tc.err, err)
+			_, err = hook.ParseDelivery(newRequest(), PushEvent)
+			assert.Equal(tc.err, err)
+			req := newRequest()
+			_, err = hook.ParseBytes(req.Header, body, PushEvent)
+			assert.Equal(tc.err, err)
+
+			w := httptest.NewRecorder()
+			router := NewRouter(hook)
+			router.OnPush(func(ctx context.Context, pl PushPayload) error {
+				return nil
+			})
+			router.ServeHTTP(w, newRequest())
+			if tc.err != nil {
+				assert.Equal(http.StatusRequestEntityTooLarge, w.Code)
+			} else {
+				assert.Equal(http.StatusOK, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package github
+
+import (
+	"time"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+)
+
+// Normalize converts a payload returned by Parse into the provider agnostic
+// normalized events, webhooks.ErrNotNormalizable is returned for payloads
+// without a normalized form
+func Normalize(payload interface{}) ([]webhooks.NormalizedEvent, error) {
+	switch pl := payload.(type) {
+	case PushPayload:
+		return []webhooks.NormalizedEvent{normalizePush(pl)}, nil
+	case PullRequestPayload:
+		return []webhooks.NormalizedEvent{normalizePullRequest(pl)}, nil
+	case IssuesPayload:
+		return []webhooks.NormalizedEvent{normalizeIssue(pl)}, nil
+	case ReleasePayload:
+		return []webhooks.NormalizedEvent{normalizeRelease(pl)}, nil
+	case CreatePayload:
+		if pl.RefType != "tag" {
+			return nil, webhooks.ErrNotNormalizable
+		}
+		return []webhooks.NormalizedEvent{webhooks.NormalizedTag{
+			Provider: webhooks.GitHub,
+			Repository: normalizeRepository(repository{
+				Name:          pl.Repository.Name,
+				FullName:      pl.Repository.FullName,
+				HTMLURL:       pl.Repository.HTMLURL,
+				CloneURL:      pl.Repository.CloneURL,
+				DefaultBranch: pl.Repository.DefaultBranch,
+				Private:       pl.Repository.Private,
+			}),
+			Action: webhooks.ActionCreated,
+			Name:   pl.Ref,
+			Sender: webhooks.NormalizedUser{Login: pl.Sender.Login},
+		}}, nil
+	case DeletePayload:
+		if pl.RefType != "tag" {
+			return nil, webhooks.ErrNotNormalizable
+		}
+		return []webhooks.NormalizedEvent{webhooks.NormalizedTag{
+			Provider: webhooks.GitHub,
+			Repository: normalizeRepository(repository{
+				Name:          pl.Repository.Name,
+				FullName:      pl.Repository.FullName,
+				HTMLURL:       pl.Repository.HTMLURL,
+				CloneURL:      pl.Repository.CloneURL,
+				DefaultBranch: pl.Repository.DefaultBranch,
+				Private:       pl.Repository.Private,
+			}),
+			Action: webhooks.ActionDeleted,
+			Name:   pl.Ref,
+			Sender: webhooks.NormalizedUser{Login: pl.Sender.Login},
+		}}, nil
+	default:
+		return nil, webhooks.ErrNotNormalizable
+	}
+}
+
+// Normalize converts a payload returned by Parse into normalized events, it implements webhooks.Provider
+func (hook Webhook) Normalize(payload interface{}) ([]webhooks.NormalizedEvent, error) {
+	return Normalize(payload)
+}
+
+// repository holds the normalized fields of a repository, every payload declares
+// its own repository struct
+type repository struct {
+	Name          string
+	FullName      string
+	HTMLURL       string
+	CloneURL      string
+	DefaultBranch string
+	Private       bool
+}
+
+func normalizeRepository(r repository) webhooks.NormalizedRepository {
+	return webhooks.NormalizedRepository{
+		Name:          r.Name,
+		FullName:      r.FullName,
+		HTMLURL:       r.HTMLURL,
+		CloneURL:      r.CloneURL,
+		DefaultBranch: r.DefaultBranch,
+		Private:       r.Private,
+	}
+}
+
+func normalizePush(pl PushPayload) webhooks.NormalizedPush {
+	push := webhooks.NormalizedPush{
+		Provider: webhooks.GitHub,
+		Repository: normalizeRepository(repository{
+			Name:          pl.Repository.Name,
+			FullName:      pl.Repository.FullName,
+			HTMLURL:       pl.Repository.HTMLURL,
+			CloneURL:      pl.Repository.CloneURL,
+			DefaultBranch: pl.Repository.DefaultBranch,
+			Private:       pl.Repository.Private,
+		}),
+		Ref:        pl.Ref,
+		Before:     pl.Before,
+		After:      pl.After,
+		Created:    pl.Created,
+		Deleted:    pl.Deleted,
+		Forced:     pl.Forced,
+		CompareURL: pl.Compare,
+		Sender:     webhooks.NormalizedUser{Login: pl.Sender.Login, Name: pl.Pusher.Name, Email: pl.Pusher.Email},
+	}
+	for _, c := range pl.Commits {
+		timestamp, _ := time.Parse(time.RFC3339, c.Timestamp)
+		push.Commits = append(push.Commits, webhooks.NormalizedCommit{
+			ID:        c.ID,
+			Message:   c.Message,
+			URL:       c.URL,
+			Timestamp: timestamp,
+			Author:    webhooks.NormalizedUser{Login: c.Author.Username, Name: c.Author.Name, Email: c.Author.Email},
+			Added:     c.Added,
+			Modified:  c.Modified,
+			Removed:   c.Removed,
+		})
+	}
+	return push
+}
+
+func normalizePullRequest(pl PullRequestPayload) webhooks.NormalizedPullRequest {
+	pr := webhooks.NormalizedPullRequest{
+		Provider: webhooks.GitHub,
+		Repository: normalizeRepository(repository{
+			Name:          pl.Repository.Name,
+			FullName:      pl.Repository.FullName,
+			HTMLURL:       pl.Repository.HTMLURL,
+			CloneURL:      pl.Repository.CloneURL,
+			DefaultBranch: pl.Repository.DefaultBranch,
+			Private:       pl.Repository.Private,
+		}),
+		Action:       normalizeAction(pl.Action),
+		Number:       pl.Number,
+		Title:        pl.PullRequest.Title,
+		Body:         pl.PullRequest.Body,
+		HTMLURL:      pl.PullRequest.HTMLURL,
+		State:        pl.PullRequest.State,
+		Merged:       pl.PullRequest.MergedAt != nil,
+		Draft:        pl.PullRequest.Draft,
+		SourceBranch: pl.PullRequest.Head.Ref,
+		TargetBranch: pl.PullRequest.Base.Ref,
+		HeadSHA:      pl.PullRequest.Head.Sha,
+		Author:       webhooks.NormalizedUser{Login: pl.PullRequest.User.Login},
+		Sender:       webhooks.NormalizedUser{Login: pl.Sender.Login},
+	}
+	if pr.Action == webhooks.ActionClosed && pr.Merged {
+		pr.Action = webhooks.ActionMerged
+	}
+	for _, l := range pl.PullRequest.Labels {
+		pr.Labels = append(pr.Labels, l.Name)
+	}
+	return pr
+}
+
+func normalizeIssue(pl IssuesPayload) webhooks.NormalizedIssue {
+	issue := webhooks.NormalizedIssue{
+		Provider: webhooks.GitHub,
+		Repository: normalizeRepository(repository{
+			Name:          pl.Repository.Name,
+			FullName:      pl.Repository.FullName,
+			HTMLURL:       pl.Repository.HTMLURL,
+			CloneURL:      pl.Repository.CloneURL,
+			DefaultBranch: pl.Repository.DefaultBranch,
+			Private:       pl.Repository.Private,
+		}),
+		Action:  normalizeAction(pl.Action),
+		Number:  pl.Issue.Number,
+		Title:   pl.Issue.Title,
+		Body:    pl.Issue.Body,
+		HTMLURL: pl.Issue.HTMLURL,
+		State:   pl.Issue.State,
+		Author:  webhooks.NormalizedUser{Login: pl.Issue.User.Login},
+		Sender:  webhooks.NormalizedUser{Login: pl.Sender.Login},
+	}
+	for _, l := range pl.Issue.Labels {
+		issue.Labels = append(issue.Labels, l.Name)
+	}
+	return issue
+}
+
+func normalizeRelease(pl ReleasePayload) webhooks.NormalizedRelease {
+	release := webhooks.NormalizedRelease{
+		Provider: webhooks.GitHub,
+		Repository: normalizeRepository(repository{
+			Name:          pl.Repository.Name,
+			FullName:      pl.Repository.FullName,
+			HTMLURL:       pl.Repository.HTMLURL,
+			CloneURL:      pl.Repository.CloneURL,
+			DefaultBranch: pl.Repository.DefaultBranch,
+			Private:       pl.Repository.Private,
+		}),
+		Action:     normalizeAction(pl.Action),
+		TagName:    pl.Release.TagName,
+		HTMLURL:    pl.Release.HTMLURL,
+		Draft:      pl.Release.Draft,
+		Prerelease: pl.Release.Prerelease,
+		Author:     webhooks.NormalizedUser{Login: pl.Release.Author.Login},
+		Sender:     webhooks.NormalizedUser{Login: pl.Sender.Login},
+	}
+	if pl.Release.Name != nil {
+		release.Name = *pl.Release.Name
+	}
+	if pl.Release.Body != nil {
+		release.Body = *pl.Release.Body
+	}
+	return release
+}
+
+// normalizeAction maps GitHub actions onto the normalized actions
+func normalizeAction(action string) string {
+	switch action {
+	case "edited", "synchronize":
+		return webhooks.ActionUpdated
+	default:
+		return action
+	}
+}
@@ -0,0 +1,396 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+)
+
+// HandlerFunc handles the payload returned by Parse for a registered event
+type HandlerFunc func(ctx context.Context, payload interface{}) error
+
+// Router dispatches the GitHub deliveries to the callbacks registered per event, the
+// events to parse are derived from the registered callbacks. It implements http.Handler
+type Router struct {
+	hook     *Webhook
+	handlers map[Event]HandlerFunc
+}
+
+// NewRouter creates and returns a Router parsing the deliveries with the given Webhook
+func NewRouter(hook *Webhook) *Router {
+	return &Router{
+		hook:     hook,
+		handlers: make(map[Event]HandlerFunc),
+	}
+}
+
+// On registers the callback for the given event, registering an event twice
+// replaces the previous callback. Callbacks must be registered before serving
+func (router *Router) On(event Event, fn HandlerFunc) {
+	router.handlers[event] = fn
+}
+
+// ServeHTTP parses the delivery and calls the callback registered for its event.
+//
+// Events without callback are answered with 204 No Content, invalid methods with
+// 405 Method Not Allowed, failed verifications with 401 Unauthorized and malformed
+// deliveries with 400 Bad Request. Callback errors are answered with 500 Internal
+// Server Error unless they are a webhooks.StatusError
+func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	events := make([]Event, 0, len(router.handlers))
+	for event := range router.handlers {
+		events = append(events, event)
+	}
+
+	payload, err := router.hook.Parse(r, events...)
+	if err != nil {
+		code := StatusCode(err)
+		if code == http.StatusNoContent {
+			w.WriteHeader(code)
+			return
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	handler, ok := router.handlers[Event(r.Header.Get("X-GitHub-Event"))]
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err := handler(r.Context(), payload); err != nil {
+		code := webhooks.StatusCode(err)
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// StatusCode maps the errors returned by Parse onto HTTP status codes
+func StatusCode(err error) int {
+	switch {
+	case errors.Is(err, ErrEventNotFound), errors.Is(err, ErrEventNotSpecifiedToParse):
+		return http.StatusNoContent
+	case errors.Is(err, ErrInvalidHTTPMethod):
+		return http.StatusMethodNotAllowed
+	case errors.Is(err, webhooks.ErrPayloadTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrMissingHubSignatureHeader), errors.Is(err, ErrMissingHubSignature256Header),
+		errors.Is(err, ErrMalformedSignature), errors.Is(err, ErrHMACVerificationFailed):
+		return http.StatusUnauthorized
+	case errors.Is(err, webhooks.ErrSecretLookup):
+		return http.StatusInternalServerError
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// OnCheckRun registers the callback for the CheckRunEvent
+func (router *Router) OnCheckRun(fn func(ctx context.Context, pl CheckRunPayload) error) {
+	router.On(CheckRunEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(CheckRunPayload))
+	})
+}
+
+// OnCheckSuite registers the callback for the CheckSuiteEvent
+func (router *Router) OnCheckSuite(fn func(ctx context.Context, pl CheckSuitePayload) error) {
+	router.On(CheckSuiteEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(CheckSuitePayload))
+	})
+}
+
+// OnCommitComment registers the callback for the CommitCommentEvent
+func (router *Router) OnCommitComment(fn func(ctx context.Context, pl CommitCommentPayload) error) {
+	router.On(CommitCommentEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(CommitCommentPayload))
+	})
+}
+
+// OnCreate registers the callback for the CreateEvent
+func (router *Router) OnCreate(fn func(ctx context.Context, pl CreatePayload) error) {
+	router.On(CreateEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(CreatePayload))
+	})
+}
+
+// OnDelete registers the callback for the DeleteEvent
+func (router *Router) OnDelete(fn func(ctx context.Context, pl DeletePayload) error) {
+	router.On(DeleteEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(DeletePayload))
+	})
+}
+
+// OnDeployKey registers the callback for the DeployKeyEvent
+func (router *Router) OnDeployKey(fn func(ctx context.Context, pl DeployKeyPayload) error) {
+	router.On(DeployKeyEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(DeployKeyPayload))
+	})
+}
+
+// OnDeployment registers the callback for the DeploymentEvent
+func (router *Router) OnDeployment(fn func(ctx context.Context, pl DeploymentPayload) error) {
+	router.On(DeploymentEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(DeploymentPayload))
+	})
+}
+
+// OnDeploymentStatus registers the callback for the DeploymentStatusEvent
+func (router *Router) OnDeploymentStatus(fn func(ctx context.Context, pl DeploymentStatusPayload) error) {
+	router.On(DeploymentStatusEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(DeploymentStatusPayload))
+	})
+}
+
+// OnFork registers the callback for the ForkEvent
+func (router *Router) OnFork(fn func(ctx context.Context, pl ForkPayload) error) {
+	router.On(ForkEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(ForkPayload))
+	})
+}
+
+// OnGollum registers the callback for the GollumEvent
+func (router *Router) OnGollum(fn func(ctx context.Context, pl GollumPayload) error) {
+	router.On(GollumEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(GollumPayload))
+	})
+}
+
+// OnInstallation registers the callback for the InstallationEvent
+func (router *Router) OnInstallation(fn func(ctx context.Context, pl InstallationPayload) error) {
+	router.On(InstallationEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(InstallationPayload))
+	})
+}
+
+// OnInstallationRepositories registers the callback for the InstallationRepositoriesEvent
+func (router *Router) OnInstallationRepositories(fn func(ctx context.Context, pl InstallationRepositoriesPayload) error) {
+	router.On(InstallationRepositoriesEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(InstallationRepositoriesPayload))
+	})
+}
+
+// OnIntegrationInstallation registers the callback for the IntegrationInstallationEvent
+func (router *Router) OnIntegrationInstallation(fn func(ctx context.Context, pl InstallationPayload) error) {
+	router.On(IntegrationInstallationEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(InstallationPayload))
+	})
+}
+
+// OnIntegrationInstallationRepositories registers the callback for the IntegrationInstallationRepositoriesEvent
+func (router *Router) OnIntegrationInstallationRepositories(fn func(ctx context.Context, pl InstallationRepositoriesPayload) error) {
+	router.On(IntegrationInstallationRepositoriesEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(InstallationRepositoriesPayload))
+	})
+}
+
+// OnIssueComment registers the callback for the IssueCommentEvent
+func (router *Router) OnIssueComment(fn func(ctx context.Context, pl IssueCommentPayload) error) {
+	router.On(IssueCommentEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(IssueCommentPayload))
+	})
+}
+
+// OnIssues registers the callback for the IssuesEvent
+func (router *Router) OnIssues(fn func(ctx context.Context, pl IssuesPayload) error) {
+	router.On(IssuesEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(IssuesPayload))
+	})
+}
+
+// OnLabel registers the callback for the LabelEvent
+func (router *Router) OnLabel(fn func(ctx context.Context, pl LabelPayload) error) {
+	router.On(LabelEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(LabelPayload))
+	})
+}
+
+// OnMember registers the callback for the MemberEvent
+func (router *Router) OnMember(fn func(ctx context.Context, pl MemberPayload) error) {
+	router.On(MemberEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(MemberPayload))
+	})
+}
+
+// OnMembership registers the callback for the MembershipEvent
+func (router *Router) OnMembership(fn func(ctx context.Context, pl MembershipPayload) error) {
+	router.On(MembershipEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(MembershipPayload))
+	})
+}
+
+// OnMilestone registers the callback for the MilestoneEvent
+func (router *Router) OnMilestone(fn func(ctx context.Context, pl MilestonePayload) error) {
+	router.On(MilestoneEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(MilestonePayload))
+	})
+}
+
+// OnMeta registers the callback for the MetaEvent
+func (router *Router) OnMeta(fn func(ctx context.Context, pl MetaPayload) error) {
+	router.On(MetaEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(MetaPayload))
+	})
+}
+
+// OnOrganization registers the callback for the OrganizationEvent
+func (router *Router) OnOrganization(fn func(ctx context.Context, pl OrganizationPayload) error) {
+	router.On(OrganizationEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(OrganizationPayload))
+	})
+}
+
+// OnOrgBlock registers the callback for the OrgBlockEvent
+func (router *Router) OnOrgBlock(fn func(ctx context.Context, pl OrgBlockPayload) error) {
+	router.On(OrgBlockEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(OrgBlockPayload))
+	})
+}
+
+// OnPageBuild registers the callback for the PageBuildEvent
+func (router *Router) OnPageBuild(fn func(ctx context.Context, pl PageBuildPayload) error) {
+	router.On(PageBuildEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PageBuildPayload))
+	})
+}
+
+// OnPing registers the callback for the PingEvent
+func (router *Router) OnPing(fn func(ctx context.Context, pl PingPayload) error) {
+	router.On(PingEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PingPayload))
+	})
+}
+
+// OnProjectCard registers the callback for the ProjectCardEvent
+func (router *Router) OnProjectCard(fn func(ctx context.Context, pl ProjectCardPayload) error) {
+	router.On(ProjectCardEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(ProjectCardPayload))
+	})
+}
+
+// OnProjectColumn registers the callback for the ProjectColumnEvent
+func (router *Router) OnProjectColumn(fn func(ctx context.Context, pl ProjectColumnPayload) error) {
+	router.On(ProjectColumnEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(ProjectColumnPayload))
+	})
+}
+
+// OnProject registers the callback for the ProjectEvent
+func (router *Router) OnProject(fn func(ctx context.Context, pl ProjectPayload) error) {
+	router.On(ProjectEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(ProjectPayload))
+	})
+}
+
+// OnPublic registers the callback for the PublicEvent
+func (router *Router) OnPublic(fn func(ctx context.Context, pl PublicPayload) error) {
+	router.On(PublicEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PublicPayload))
+	})
+}
+
+// OnPullRequest registers the callback for the PullRequestEvent
+func (router *Router) OnPullRequest(fn func(ctx context.Context, pl PullRequestPayload) error) {
+	router.On(PullRequestEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PullRequestPayload))
+	})
+}
+
+// OnPullRequestReview registers the callback for the PullRequestReviewEvent
+func (router *Router) OnPullRequestReview(fn func(ctx context.Context, pl PullRequestReviewPayload) error) {
+	router.On(PullRequestReviewEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PullRequestReviewPayload))
+	})
+}
+
+// OnPullRequestReviewComment registers the callback for the PullRequestReviewCommentEvent
+func (router *Router) OnPullRequestReviewComment(fn func(ctx context.Context, pl PullRequestReviewCommentPayload) error) {
+	router.On(PullRequestReviewCommentEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PullRequestReviewCommentPayload))
+	})
+}
+
+// OnPush registers the callback for the PushEvent
+func (router *Router) OnPush(fn func(ctx context.Context, pl PushPayload) error) {
+	router.On(PushEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PushPayload))
+	})
+}
+
+// OnRelease registers the callback for the ReleaseEvent
+func (router *Router) OnRelease(fn func(ctx context.Context, pl ReleasePayload) error) {
+	router.On(ReleaseEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(ReleasePayload))
+	})
+}
+
+// OnRepository registers the callback for the RepositoryEvent
+func (router *Router) OnRepository(fn func(ctx context.Context, pl RepositoryPayload) error) {
+	router.On(RepositoryEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(RepositoryPayload))
+	})
+}
+
+// OnRepositoryVulnerabilityAlert registers the callback for the RepositoryVulnerabilityAlertEvent
+func (router *Router) OnRepositoryVulnerabilityAlert(fn func(ctx context.Context, pl RepositoryVulnerabilityAlertPayload) error) {
+	router.On(RepositoryVulnerabilityAlertEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(RepositoryVulnerabilityAlertPayload))
+	})
+}
+
+// OnSecurityAdvisory registers the callback for the SecurityAdvisoryEvent
+func (router *Router) OnSecurityAdvisory(fn func(ctx context.Context, pl SecurityAdvisoryPayload) error) {
+	router.On(SecurityAdvisoryEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(SecurityAdvisoryPayload))
+	})
+}
+
+// OnStatus registers the callback for the StatusEvent
+func (router *Router) OnStatus(fn func(ctx context.Context, pl StatusPayload) error) {
+	router.On(StatusEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(StatusPayload))
+	})
+}
+
+// OnTeam registers the callback for the TeamEvent
+func (router *Router) OnTeam(fn func(ctx context.Context, pl TeamPayload) error) {
+	router.On(TeamEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(TeamPayload))
+	})
+}
+
+// OnTeamAdd registers the callback for the TeamAddEvent
+func (router *Router) OnTeamAdd(fn func(ctx context.Context, pl TeamAddPayload) error) {
+	router.On(TeamAddEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(TeamAddPayload))
+	})
+}
+
+// OnWatch registers the callback for the WatchEvent
+func (router *Router) OnWatch(fn func(ctx context.Context, pl WatchPayload) error) {
+	router.On(WatchEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(WatchPayload))
+	})
+}
+
+// OnWorkflowDispatch registers the callback for the WorkflowDispatchEvent
+func (router *Router) OnWorkflowDispatch(fn func(ctx context.Context, pl WorkflowDispatchPayload) error) {
+	router.On(WorkflowDispatchEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(WorkflowDispatchPayload))
+	})
+}
+
+// OnWorkflowJob registers the callback for the WorkflowJobEvent
+func (router *Router) OnWorkflowJob(fn func(ctx context.Context, pl WorkflowJobPayload) error) {
+	router.On(WorkflowJobEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(WorkflowJobPayload))
+	})
+}
+
+// OnWorkflowRun registers the callback for the WorkflowRunEvent
+func (router *Router) OnWorkflowRun(fn func(ctx context.Context, pl WorkflowRunPayload) error) {
+	router.On(WorkflowRunEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(WorkflowRunPayload))
+	})
+}
@@ -0,0 +1,49 @@
+package github
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+)
+
+// Sign returns the X-Hub-Signature-256 header value of the body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignSHA1 returns the legacy X-Hub-Signature header value of the body
+func SignSHA1(secret string, body []byte) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	_, _ = mac.Write(body)
+	return "sha1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewRequest returns a POST request to url delivering the payload as the given
+// event with the headers GitHub sends, signed with both signature headers when
+// the secret is not empty. The payload is encoded as by webhooks.MarshalPayload
+func NewRequest(url string, event Event, payload interface{}, secret string) (*http.Request, error) {
+	body, err := webhooks.MarshalPayload(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GitHub-Hookshot/golang-webhooks")
+	req.Header.Set("X-GitHub-Event", string(event))
+	req.Header.Set("X-GitHub-Delivery", webhooks.NewDeliveryID())
+	if secret != "" {
+		req.Header.Set("X-Hub-Signature", SignSHA1(secret, body))
+		req.Header.Set("X-Hub-Signature-256", Sign(secret, body))
+	}
+	return req, nil
+}
@@ -1,12 +1,16 @@
 package gitlab
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"time"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
 )
 
 // Server Path
@@ -26,6 +30,22 @@ var (
 	// ErrHMACVerificationFailed    = errors.New("HMAC verification failed")
 )
 
+// outcomes label the parse errors reported to the ParseObserver
+var outcomes = map[error]string{
+	ErrEventNotSpecifiedToParse:      "event_not_specified_to_parse",
+	ErrInvalidHTTPMethod:             "invalid_http_method",
+	ErrMissingGitLabEventHeader:      "missing_gitlab_event_header",
+	ErrGitLabTokenVerificationFailed: "gitlab_token_verification_failed",
+	ErrEventNotFound:                 webhooks.OutcomeEventNotFound,
+	ErrParsingPayload:                "parsing_payload",
+	ErrParsingSystemPayload:          "parsing_system_payload",
+}
+
+// verificationErrors are the parse errors of deliveries failing verification
+var verificationErrors = []error{
+	ErrGitLabTokenVerificationFailed,
+}
+
 // GitLab hook types
 const (
 	PushEvents               Event = "Push Hook"
@@ -55,25 +75,108 @@ var Options = WebhookOptions{}
 // WebhookOptions is a namespace for configuration option methods
 type WebhookOptions struct{}
 
-// Secret registers the GitLab secret
+// Secret registers the GitLab secret, it may be combined with other secrets to rotate them
 func (WebhookOptions) Secret(secret string) Option {
 	return func(hook *Webhook) error {
-		hook.secret = secret
+		hook.secrets = hook.secrets.Add(webhooks.Secret{Value: secret})
+		return nil
+	}
+}
+
+// Secrets registers several secret tokens, deliveries carrying any unexpired token
+// are accepted and the matching label is reported by ParseDelivery
+func (WebhookOptions) Secrets(secrets ...webhooks.Secret) Option {
+	return func(hook *Webhook) error {
+		hook.secrets = hook.secrets.Add(secrets...)
 		return nil
 	}
 }
 
 // Webhook instance contains all methods needed to process events
 type Webhook struct {
-	secret string
+	secrets        webhooks.Secrets
+	secretProvider webhooks.SecretProvider
+	observer       webhooks.ParseObserver
+	logger         webhooks.Logger
+	logBodies      bool
+	maxBodyBytes   int64
+	catchAll       bool
+	drift          []webhooks.DriftObserver
 }
 
 // Event defines a GitLab hook event type by the X-Gitlab-Event Header
 type Event string
 
+// SecretProvider registers a provider resolving the secrets per delivery, they are
+// used alongside the registered secrets. Deliveries are always verified once a
+// provider is registered, the ones it resolves no secret for are rejected
+func (WebhookOptions) SecretProvider(provider webhooks.SecretProvider) Option {
+	return func(hook *Webhook) error {
+		hook.secretProvider = provider
+		return nil
+	}
+}
+
+// Observer registers the observer notified of the outcome of every delivery
+// handed to a Parse method, e.g. the metrics collector of the metrics package
+func (WebhookOptions) Observer(observer webhooks.ParseObserver) Option {
+	return func(hook *Webhook) error {
+		hook.observer = observer
+		return nil
+	}
+}
+
+// Logger registers the logger of verification failures, unknown events and
+// decode errors, nothing is logged by default
+func (WebhookOptions) Logger(logger webhooks.Logger) Option {
+	return func(hook *Webhook) error {
+		hook.logger = logger
+		return nil
+	}
+}
+
+// LogBodies adds the delivery bodies to the log records, they may carry secrets
+// and personal data so they are never logged otherwise
+func (WebhookOptions) LogBodies() Option {
+	return func(hook *Webhook) error {
+		hook.logBodies = true
+		return nil
+	}
+}
+
+// MaxBodyBytes sets the size limit of the delivery bodies, larger deliveries are
+// rejected with webhooks.ErrPayloadTooLarge. The limit is webhooks.DefaultMaxBodyBytes
+// by default and 0 or less disables it
+func (WebhookOptions) MaxBodyBytes(max int64) Option {
+	return func(hook *Webhook) error {
+		hook.maxBodyBytes = max
+		return nil
+	}
+}
+
+// CatchAll returns the deliveries of events that weren't specified to Parse or
+// that this package doesn't know as a webhooks.RawEvent instead of an error,
+// they are verified like any other delivery
+func (WebhookOptions) CatchAll() Option {
+	return func(hook *Webhook) error {
+		hook.catchAll = true
+		return nil
+	}
+}
+
+// Strict reports the payload fields that don't map onto the payload structs, and
+// the struct fields absent from the payloads, to the observers, e.g. the metrics
+// collector of the metrics package. The deliveries aren't rejected for it
+func (WebhookOptions) Strict(observers ...webhooks.DriftObserver) Option {
+	return func(hook *Webhook) error {
+		hook.drift = append(hook.drift, observers...)
+		return nil
+	}
+}
+
 // New creates and returns a WebHook instance denoted by the Provider type
 func New(options ...Option) (*Webhook, error) {
-	hook := new(Webhook)
+	hook := &Webhook{maxBodyBytes: webhooks.DefaultMaxBodyBytes}
 	for _, opt := range options {
 		if err := opt(hook); err != nil {
 			return nil, errors.New("Error applying Option")
@@ -82,12 +185,77 @@ func New(options ...Option) (*Webhook, error) {
 	return hook, nil
 }
 
+// events parsed by ParseAny
+var allEvents = []Event{
+	PushEvents,
+	TagEvents,
+	IssuesEvents,
+	ConfidentialIssuesEvents,
+	CommentEvents,
+	MergeRequestEvents,
+	WikiPageEvents,
+	PipelineEvents,
+	BuildEvents,
+	JobEvents,
+	SystemHookEvents,
+}
+
+// knownEvent reports whether the event is parsed into a payload of this package
+func knownEvent(event Event) bool {
+	for _, evt := range allEvents {
+		if evt == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Name returns the provider name, it implements webhooks.Provider
+func (hook Webhook) Name() webhooks.ProviderName {
+	return webhooks.GitLab
+}
+
+// ParseAny verifies and parses any known event and returns the payload object or an error
+func (hook Webhook) ParseAny(r *http.Request) (interface{}, error) {
+	return hook.Parse(r, allEvents...)
+}
+
+// ParseDelivery verifies and parses the events specified like Parse and returns the
+// payload together with the delivery metadata and raw body. Once the body has been
+// read the delivery is returned alongside parse errors too
+func (hook Webhook) ParseDelivery(r *http.Request, events ...Event) (delivery *webhooks.Delivery, err error) {
+	var body []byte
+	defer func(start time.Time) {
+		_ = r.Body.Close()
+		hook.report(start, r.Header, body, err)
+	}(time.Now())
+
+	if r.Method != http.MethodPost {
+		return nil, ErrInvalidHTTPMethod
+	}
+
+	body, err = webhooks.ReadBody(r.Body, hook.maxBodyBytes)
+	if err == webhooks.ErrPayloadTooLarge {
+		return nil, err
+	}
+	if err != nil {
+		return nil, ErrParsingPayload
+	}
+	delivery = webhooks.NewDelivery(webhooks.GitLab, r.Header, body)
+	var secret webhooks.Secret
+	delivery.Payload, secret, err = hook.parse(r, body, events...)
+	delivery.Secret = secret.Label
+	return delivery, err
+}
+
 // Parse verifies and parses the events specified and returns the payload object or an error
-func (hook Webhook) Parse(r *http.Request, events ...Event) (interface{}, error) {
-	defer func() {
+func (hook Webhook) Parse(r *http.Request, events ...Event) (pl interface{}, err error) {
+	var payload []byte
+	defer func(start time.Time) {
 		_, _ = io.Copy(ioutil.Discard, r.Body)
 		_ = r.Body.Close()
-	}()
+		hook.report(start, r.Header, payload, err)
+	}(time.Now())
 
 	if len(events) == 0 {
 		return nil, ErrEventNotSpecifiedToParse
@@ -96,27 +264,81 @@ func (hook Webhook) Parse(r *http.Request, events ...Event) (interface{}, error)
 		return nil, ErrInvalidHTTPMethod
 	}
 
+	payload, err = webhooks.ReadBody(r.Body, hook.maxBodyBytes)
+	if err == webhooks.ErrPayloadTooLarge {
+		return nil, err
+	}
+	if err != nil {
+		return nil, ErrParsingPayload
+	}
+	pl, _, err = hook.parse(r, payload, events...)
+	return pl, err
+}
+
+// ParseBytes verifies and parses the events specified from the delivery headers
+// and body, for deliveries received without an *http.Request
+func (hook Webhook) ParseBytes(headers http.Header, payload []byte, events ...Event) (interface{}, error) {
+	start := time.Now()
+	if hook.maxBodyBytes > 0 && int64(len(payload)) > hook.maxBodyBytes {
+		hook.report(start, headers, payload, webhooks.ErrPayloadTooLarge)
+		return nil, webhooks.ErrPayloadTooLarge
+	}
+	pl, _, err := hook.parse(&http.Request{Header: headers}, payload, events...)
+	hook.report(start, headers, payload, err)
+	return pl, err
+}
+
+// parse verifies and parses the events specified and returns the payload object
+// together with the secret that verified it, r only needs to carry the headers
+// when parsing raw deliveries
+func (hook Webhook) parse(r *http.Request, payload []byte, events ...Event) (interface{}, webhooks.Secret, error) {
+	headers := r.Header
+	if len(events) == 0 {
+		return nil, webhooks.Secret{}, ErrEventNotSpecifiedToParse
+	}
+
 	// If we have a Secret set, we should check the MAC
-	if len(hook.secret) > 0 {
-		signature := r.Header.Get("X-Gitlab-Token")
-		if signature != hook.secret {
-			return nil, ErrGitLabTokenVerificationFailed
+	var secret webhooks.Secret
+	secrets, err := hook.resolveSecrets(r, payload)
+	if err != nil {
+		return nil, webhooks.Secret{}, err
+	}
+	if len(secrets) > 0 || hook.secretProvider != nil {
+		signature := headers.Get("X-Gitlab-Token")
+		var ok bool
+		secret, ok = secrets.Match(func(secret string) bool {
+			return subtle.ConstantTimeCompare([]byte(signature), []byte(secret)) == 1
+		})
+		if !ok {
+			return nil, webhooks.Secret{}, ErrGitLabTokenVerificationFailed
 		}
 	}
 
-	event := r.Header.Get("X-Gitlab-Event")
+	event := headers.Get("X-Gitlab-Event")
 	if len(event) == 0 {
-		return nil, ErrMissingGitLabEventHeader
+		return nil, webhooks.Secret{}, ErrMissingGitLabEventHeader
 	}
 
 	gitLabEvent := Event(event)
 
-	payload, err := ioutil.ReadAll(r.Body)
-	if err != nil || len(payload) == 0 {
-		return nil, ErrParsingPayload
+	if len(payload) == 0 {
+		return nil, webhooks.Secret{}, ErrParsingPayload
 	}
 
-	return eventParsing(gitLabEvent, events, payload)
+	// events this package doesn't know are returned raw in catch-all mode
+	if hook.catchAll && !knownEvent(gitLabEvent) {
+		pl, err := webhooks.NewRawEvent(event, headers, payload)
+		return pl, secret, err
+	}
+	pl, err := eventParsing(gitLabEvent, events, payload)
+	// as are the events not defined to be parsed, system hooks included
+	if err == ErrEventNotFound && hook.catchAll {
+		pl, err = webhooks.NewRawEvent(event, headers, payload)
+	}
+	if err == nil {
+		webhooks.ReportDrift(hook.drift, webhooks.GitLab, string(gitLabEvent), webhooks.DeliveryID(headers), payload, pl)
+	}
+	return pl, secret, err
 }
 
 func eventParsing(gitLabEvent Event, events []Event, payload []byte) (interface{}, error) {
@@ -218,3 +440,56 @@ func eventParsing(gitLabEvent Event, events []Event, payload []byte) (interface{
 		return nil, fmt.Errorf("unknown event %s", gitLabEvent)
 	}
 }
+
+// resolveSecrets returns the secrets verifying the delivery, including the ones
+// resolved by the SecretProvider
+func (hook Webhook) resolveSecrets(r *http.Request, payload []byte) (webhooks.Secrets, error) {
+	if hook.secretProvider == nil {
+		return hook.secrets, nil
+	}
+	return webhooks.ResolveSecrets(hook.secrets, hook.secretProvider, r, peekRepository(payload))
+}
+
+// peekRepository returns the repository full name of the unverified payload
+func peekRepository(payload []byte) string {
+	var pl struct {
+		Project struct {
+			PathWithNamespace string `json:"path_with_namespace"`
+		} `json:"project"`
+	}
+	_ = json.Unmarshal(payload, &pl)
+	return pl.Project.PathWithNamespace
+}
+
+// report notifies the registered observer and logger of the outcome of a delivery,
+// events missing from allEvents are reported as unknown to bound the label values
+func (hook Webhook) report(start time.Time, headers http.Header, payload []byte, err error) {
+	if hook.observer == nil && hook.logger == nil {
+		return
+	}
+	event := webhooks.UnknownEvent
+	for _, evt := range allEvents {
+		if string(evt) == headers.Get("X-Gitlab-Event") {
+			event = string(evt)
+			break
+		}
+	}
+	o := webhooks.ParseObservation{
+		Provider:           webhooks.GitLab,
+		Event:              event,
+		Outcome:            webhooks.Outcome(err, outcomes),
+		VerificationFailed: webhooks.VerificationFailed(err, verificationErrors),
+		Size:               len(payload),
+		Duration:           time.Since(start),
+	}
+	if hook.observer != nil {
+		hook.observer.ObserveParse(o)
+	}
+	if hook.logger != nil {
+		var body []byte
+		if hook.logBodies {
+			body = payload
+		}
+		webhooks.LogParse(hook.logger, o, webhooks.DeliveryID(headers), err, body)
+	}
+}
@@ -2,6 +2,7 @@ package gitlab
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"log"
 	"net/http"
@@ -9,7 +10,9 @@ import (
 	"os"
 	"reflect"
 	"testing"
+	"time"
 
+	webhooks "github.com/heitormejias/golang-webhooks"
 	"github.com/stretchr/testify/require"
 )
 
@@ -375,3 +378,135 @@ func TestSystemHooks(t *testing.T) {
 		})
 	}
 }
+
+func TestRouter(t *testing.T) {
+	assert := require.New(t)
+	tests := []struct {
+		name     string
+		filename string
+		event    string
+		token    string
+		expected int
+	}{
+		{
+			name:     "PushEvent",
+			filename: "../testdata/gitlab/push-event.json",
+			event:    "Push Hook",
+			token:    "sampleToken!",
+			expected: http.StatusOK,
+		},
+		{
+			name:     "SystemPushEvent",
+			filename: "../testdata/gitlab/system-push-event.json",
+			event:    "System Hook",
+			token:    "sampleToken!",
+			expected: http.StatusOK,
+		},
+		{
+			name:     "Unhandled",
+			filename: "../testdata/gitlab/tag-event.json",
+			event:    "Tag Push Hook",
+			token:    "sampleToken!",
+			expected: http.StatusNoContent,
+		},
+		{
+			name:     "BadToken",
+			filename: "../testdata/gitlab/push-event.json",
+			event:    "Push Hook",
+			token:    "badsampleToken!!",
+			expected: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		client := &http.Client{}
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			payload, err := os.Open(tc.filename)
+			assert.NoError(err)
+			defer func() {
+				_ = payload.Close()
+			}()
+
+			var results PushEventPayload
+			router := NewRouter(hook)
+			router.OnPush(func(ctx context.Context, pl PushEventPayload) error {
+				results = pl
+				return nil
+			})
+			server := httptest.NewServer(router)
+			defer server.Close()
+			req, err := http.NewRequest(http.MethodPost, server.URL+path, payload)
+			assert.NoError(err)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Gitlab-Token", tc.token)
+			req.Header.Set("X-Gitlab-Event", tc.event)
+
+			resp, err := client.Do(req)
+			assert.NoError(err)
+			assert.Equal(tc.expected, resp.StatusCode)
+			if tc.expected == http.StatusOK {
+				assert.NotEmpty(results.Ref)
+			}
+		})
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	assert := require.New(t)
+	body, err := os.ReadFile("../testdata/gitlab/system-push-event.json")
+	assert.NoError(err)
+
+	headers := http.Header{}
+	headers.Set("X-Gitlab-Event", "System Hook")
+	headers.Set("X-Gitlab-Token", "sampleToken!")
+	results, err := hook.ParseBytes(headers, body, SystemHookEvents, PushEvents)
+	assert.NoError(err)
+	assert.IsType(PushEventPayload{}, results)
+
+	headers.Set("X-Gitlab-Token", "badsampleToken!!")
+	_, err = hook.ParseBytes(headers, body, SystemHookEvents, PushEvents)
+	assert.Equal(ErrGitLabTokenVerificationFailed, err)
+}
+
+func TestSecrets(t *testing.T) {
+	assert := require.New(t)
+	body, err := os.ReadFile("../testdata/gitlab/push-event.json")
+	assert.NoError(err)
+
+	hook, err := New(Options.Secrets(
+		webhooks.Secret{Value: "sampleToken!", Label: "previous", ExpiresAt: time.Now().Add(time.Hour)},
+		webhooks.Secret{Value: "rotatedToken!", Label: "current"},
+	))
+	assert.NoError(err)
+
+	for token, label := range map[string]string{"sampleToken!": "previous", "rotatedToken!": "current"} {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+		req.Header.Set("X-Gitlab-Event", "Push Hook")
+		req.Header.Set("X-Gitlab-Token", token)
+		delivery, err := hook.ParseDelivery(req, PushEvents)
+		assert.NoError(err)
+		assert.Equal(label, delivery.Secret)
+	}
+}
+
+func TestSecretProvider(t *testing.T) {
+	assert := require.New(t)
+	body, err := os.ReadFile("../testdata/gitlab/push-event.json")
+	assert.NoError(err)
+
+	var repo string
+	hook, err := New(Options.SecretProvider(webhooks.SecretProviderFunc(func(r *http.Request, unverifiedRepo string) ([]string, error) {
+		repo = unverifiedRepo
+		return []string{"tenantToken!"}, nil
+	})))
+	assert.NoError(err)
+
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.Header.Set("X-Gitlab-Event", "Push Hook")
+	req.Header.Set("X-Gitlab-Token", "tenantToken!")
+	_, err = hook.Parse(req, PushEvents)
+	assert.NoError(err)
+	assert.Equal("mike/diaspora", repo)
+}
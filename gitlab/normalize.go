@@ -0,0 +1,150 @@
+package gitlab
+
+import (
+	"strings"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+)
+
+// zeroSHA is sent as before/after SHA when a ref is created or deleted
+const zeroSHA = "0000000000000000000000000000000000000000"
+
+// Normalize converts a payload returned by Parse into the provider agnostic
+// normalized events, webhooks.ErrNotNormalizable is returned for payloads
+// without a normalized form
+func Normalize(payload interface{}) ([]webhooks.NormalizedEvent, error) {
+	switch pl := payload.(type) {
+	case PushEventPayload:
+		return []webhooks.NormalizedEvent{normalizePush(pl)}, nil
+	case TagEventPayload:
+		return []webhooks.NormalizedEvent{normalizeTag(pl)}, nil
+	case MergeRequestEventPayload:
+		return []webhooks.NormalizedEvent{normalizeMergeRequest(pl)}, nil
+	case IssueEventPayload:
+		return []webhooks.NormalizedEvent{normalizeIssue(pl)}, nil
+	case ConfidentialIssueEventPayload:
+		return []webhooks.NormalizedEvent{normalizeIssue(pl.IssueEventPayload)}, nil
+	default:
+		return nil, webhooks.ErrNotNormalizable
+	}
+}
+
+// Normalize converts a payload returned by Parse into normalized events, it implements webhooks.Provider
+func (hook Webhook) Normalize(payload interface{}) ([]webhooks.NormalizedEvent, error) {
+	return Normalize(payload)
+}
+
+func normalizeProject(p Project) webhooks.NormalizedRepository {
+	return webhooks.NormalizedRepository{
+		Name:          p.Name,
+		FullName:      p.PathWithNamespace,
+		HTMLURL:       p.WebURL,
+		CloneURL:      p.GitHTTPURL,
+		DefaultBranch: p.DefaultBranch,
+		// 0 is private, 10 internal and 20 public
+		Private: p.VisibilityLevel == 0,
+	}
+}
+
+func normalizeUser(u User) webhooks.NormalizedUser {
+	return webhooks.NormalizedUser{Login: u.UserName, Name: u.Name, Email: u.Email}
+}
+
+func normalizePush(pl PushEventPayload) webhooks.NormalizedPush {
+	push := webhooks.NormalizedPush{
+		Provider:   webhooks.GitLab,
+		Repository: normalizeProject(pl.Project),
+		Ref:        pl.Ref,
+		Before:     pl.Before,
+		After:      pl.After,
+		Created:    pl.Before == zeroSHA,
+		Deleted:    pl.After == zeroSHA,
+		Sender:     webhooks.NormalizedUser{Login: pl.UserUsername, Name: pl.UserName, Email: pl.UserEmail},
+	}
+	for _, c := range pl.Commits {
+		push.Commits = append(push.Commits, webhooks.NormalizedCommit{
+			ID:        c.ID,
+			Message:   c.Message,
+			URL:       c.URL,
+			Timestamp: c.Timestamp.Time,
+			Author:    webhooks.NormalizedUser{Name: c.Author.Name, Email: c.Author.Email},
+			Added:     c.Added,
+			Modified:  c.Modified,
+			Removed:   c.Removed,
+		})
+	}
+	return push
+}
+
+func normalizeTag(pl TagEventPayload) webhooks.NormalizedTag {
+	tag := webhooks.NormalizedTag{
+		Provider:   webhooks.GitLab,
+		Repository: normalizeProject(pl.Project),
+		Action:     webhooks.ActionCreated,
+		Name:       strings.TrimPrefix(pl.Ref, "refs/tags/"),
+		SHA:        pl.CheckoutSHA,
+		Sender:     webhooks.NormalizedUser{Login: pl.UserUsername, Name: pl.UserName},
+	}
+	if pl.After == zeroSHA {
+		tag.Action = webhooks.ActionDeleted
+		tag.SHA = pl.Before
+	}
+	return tag
+}
+
+func normalizeMergeRequest(pl MergeRequestEventPayload) webhooks.NormalizedPullRequest {
+	attrs := pl.ObjectAttributes
+	pr := webhooks.NormalizedPullRequest{
+		Provider:     webhooks.GitLab,
+		Repository:   normalizeProject(pl.Project),
+		Action:       normalizeAction(attrs.Action),
+		Number:       attrs.IID,
+		Title:        attrs.Title,
+		Body:         attrs.Description,
+		HTMLURL:      attrs.URL,
+		State:        attrs.State,
+		Merged:       attrs.State == "merged",
+		Draft:        attrs.WorkInProgress,
+		SourceBranch: attrs.SourceBranch,
+		TargetBranch: attrs.TargetBranch,
+		HeadSHA:      attrs.LastCommit.ID,
+		Sender:       normalizeUser(pl.User),
+	}
+	for _, l := range pl.Labels {
+		pr.Labels = append(pr.Labels, l.Title)
+	}
+	return pr
+}
+
+func normalizeIssue(pl IssueEventPayload) webhooks.NormalizedIssue {
+	attrs := pl.ObjectAttributes
+	return webhooks.NormalizedIssue{
+		Provider:   webhooks.GitLab,
+		Repository: normalizeProject(pl.Project),
+		Action:     normalizeAction(attrs.Action),
+		Number:     attrs.IID,
+		Title:      attrs.Title,
+		Body:       attrs.Description,
+		HTMLURL:    attrs.URL,
+		State:      attrs.State,
+		Sender:     normalizeUser(pl.User),
+	}
+}
+
+// normalizeAction maps GitLab object actions onto the normalized actions
+func normalizeAction(action string) string {
+	switch action {
+	case "open":
+		return webhooks.ActionOpened
+	case "close":
+		return webhooks.ActionClosed
+	case "reopen":
+		return webhooks.ActionReopened
+	case "merge":
+		return webhooks.ActionMerged
+	case "update":
+		return webhooks.ActionUpdated
+	default:
+		return action
+	}
+}
@@ -0,0 +1,193 @@
+package gitlab
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+)
+
+// HandlerFunc handles the payload returned by Parse for a registered event
+type HandlerFunc func(ctx context.Context, payload interface{}) error
+
+// Router dispatches the GitLab deliveries to the callbacks registered per event, the
+// events to parse are derived from the registered callbacks. It implements http.Handler
+type Router struct {
+	hook     *Webhook
+	handlers map[Event]HandlerFunc
+}
+
+// NewRouter creates and returns a Router parsing the deliveries with the given Webhook
+func NewRouter(hook *Webhook) *Router {
+	return &Router{
+		hook:     hook,
+		handlers: make(map[Event]HandlerFunc),
+	}
+}
+
+// On registers the callback for the given event, registering an event twice
+// replaces the previous callback. Callbacks must be registered before serving
+func (router *Router) On(event Event, fn HandlerFunc) {
+	router.handlers[event] = fn
+}
+
+// ServeHTTP parses the delivery and calls the callback registered for its event.
+//
+// Events without callback are answered with 204 No Content, invalid methods with
+// 405 Method Not Allowed, failed verifications with 401 Unauthorized and malformed
+// deliveries with 400 Bad Request. Callback errors are answered with 500 Internal
+// Server Error unless they are a webhooks.StatusError
+func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	events := make([]Event, 0, len(router.handlers)+2)
+	for event := range router.handlers {
+		events = append(events, event)
+	}
+	// system hooks and job hooks are parsed as the events they carry
+	if router.handlers[PushEvents] != nil || router.handlers[TagEvents] != nil || router.handlers[MergeRequestEvents] != nil {
+		events = append(events, SystemHookEvents)
+	}
+	if router.handlers[BuildEvents] != nil && router.handlers[JobEvents] == nil {
+		events = append(events, JobEvents)
+	}
+
+	payload, err := router.hook.Parse(r, events...)
+	if err != nil {
+		code := StatusCode(err)
+		if code == http.StatusNoContent {
+			w.WriteHeader(code)
+			return
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	handler, ok := router.handlers[payloadEvent(payload)]
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err := handler(r.Context(), payload); err != nil {
+		code := webhooks.StatusCode(err)
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// StatusCode maps the errors returned by Parse onto HTTP status codes
+func StatusCode(err error) int {
+	switch {
+	case errors.Is(err, ErrEventNotFound), errors.Is(err, ErrEventNotSpecifiedToParse):
+		return http.StatusNoContent
+	case errors.Is(err, ErrInvalidHTTPMethod):
+		return http.StatusMethodNotAllowed
+	case errors.Is(err, webhooks.ErrPayloadTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrGitLabTokenVerificationFailed):
+		return http.StatusUnauthorized
+	case errors.Is(err, webhooks.ErrSecretLookup):
+		return http.StatusInternalServerError
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// payloadEvent returns the event of a parsed payload, system hooks and job
+// hooks are resolved to the event of the payload they carry
+func payloadEvent(payload interface{}) Event {
+	switch payload.(type) {
+	case PushEventPayload:
+		return PushEvents
+	case TagEventPayload:
+		return TagEvents
+	case IssueEventPayload:
+		return IssuesEvents
+	case ConfidentialIssueEventPayload:
+		return ConfidentialIssuesEvents
+	case CommentEventPayload:
+		return CommentEvents
+	case MergeRequestEventPayload:
+		return MergeRequestEvents
+	case WikiPageEventPayload:
+		return WikiPageEvents
+	case PipelineEventPayload:
+		return PipelineEvents
+	case BuildEventPayload:
+		return BuildEvents
+	case JobEventPayload:
+		return JobEvents
+	default:
+		return ""
+	}
+}
+
+// OnPush registers the callback for the PushEvents, system hooks carrying it are dispatched to it as well
+func (router *Router) OnPush(fn func(ctx context.Context, pl PushEventPayload) error) {
+	router.On(PushEvents, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PushEventPayload))
+	})
+}
+
+// OnTag registers the callback for the TagEvents, system hooks carrying it are dispatched to it as well
+func (router *Router) OnTag(fn func(ctx context.Context, pl TagEventPayload) error) {
+	router.On(TagEvents, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(TagEventPayload))
+	})
+}
+
+// OnIssues registers the callback for the IssuesEvents
+func (router *Router) OnIssues(fn func(ctx context.Context, pl IssueEventPayload) error) {
+	router.On(IssuesEvents, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(IssueEventPayload))
+	})
+}
+
+// OnConfidentialIssues registers the callback for the ConfidentialIssuesEvents
+func (router *Router) OnConfidentialIssues(fn func(ctx context.Context, pl ConfidentialIssueEventPayload) error) {
+	router.On(ConfidentialIssuesEvents, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(ConfidentialIssueEventPayload))
+	})
+}
+
+// OnComment registers the callback for the CommentEvents
+func (router *Router) OnComment(fn func(ctx context.Context, pl CommentEventPayload) error) {
+	router.On(CommentEvents, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(CommentEventPayload))
+	})
+}
+
+// OnMergeRequest registers the callback for the MergeRequestEvents, system hooks carrying it are dispatched to it as well
+func (router *Router) OnMergeRequest(fn func(ctx context.Context, pl MergeRequestEventPayload) error) {
+	router.On(MergeRequestEvents, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(MergeRequestEventPayload))
+	})
+}
+
+// OnWikiPage registers the callback for the WikiPageEvents
+func (router *Router) OnWikiPage(fn func(ctx context.Context, pl WikiPageEventPayload) error) {
+	router.On(WikiPageEvents, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(WikiPageEventPayload))
+	})
+}
+
+// OnPipeline registers the callback for the PipelineEvents
+func (router *Router) OnPipeline(fn func(ctx context.Context, pl PipelineEventPayload) error) {
+	router.On(PipelineEvents, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(PipelineEventPayload))
+	})
+}
+
+// OnBuild registers the callback for the BuildEvents, job hooks carrying a build are dispatched to it as well
+func (router *Router) OnBuild(fn func(ctx context.Context, pl BuildEventPayload) error) {
+	router.On(BuildEvents, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(BuildEventPayload))
+	})
+}
+
+// OnJob registers the callback for the JobEvents
+func (router *Router) OnJob(fn func(ctx context.Context, pl JobEventPayload) error) {
+	router.On(JobEvents, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(JobEventPayload))
+	})
+}
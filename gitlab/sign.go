@@ -0,0 +1,30 @@
+package gitlab
+
+import (
+	"bytes"
+	"net/http"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+)
+
+// NewRequest returns a POST request to url delivering the payload as the given
+// event with the headers GitLab sends, carrying the secret token when it is not
+// empty. The payload is encoded as by webhooks.MarshalPayload
+func NewRequest(url string, event Event, payload interface{}, secret string) (*http.Request, error) {
+	body, err := webhooks.MarshalPayload(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GitLab/golang-webhooks")
+	req.Header.Set("X-Gitlab-Event", string(event))
+	req.Header.Set("X-Gitlab-Event-UUID", webhooks.NewDeliveryID())
+	if secret != "" {
+		req.Header.Set("X-Gitlab-Token", secret)
+	}
+	return req, nil
+}
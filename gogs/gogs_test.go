@@ -0,0 +1,212 @@
+package gogs_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	client "github.com/gogits/go-gogs-client"
+	"github.com/stretchr/testify/require"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+	"github.com/heitormejias/golang-webhooks/gogs"
+	"github.com/heitormejias/golang-webhooks/webhookstest"
+)
+
+// the package is tested from outside as webhookstest imports it
+
+const secret = "sampleToken"
+
+func TestWebhooks(t *testing.T) {
+	tests := []struct {
+		name     string
+		event    gogs.Event
+		typ      interface{}
+		filename string
+	}{
+		{
+			name:     "PushEvent",
+			event:    gogs.PushEvent,
+			typ:      client.PushPayload{},
+			filename: "push-event.json",
+		},
+		{
+			name:     "CreateEvent",
+			event:    gogs.CreateEvent,
+			typ:      client.CreatePayload{},
+			filename: "create-event.json",
+		},
+		{
+			name:     "DeleteEvent",
+			event:    gogs.DeleteEvent,
+			typ:      client.DeletePayload{},
+			filename: "delete-event.json",
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			webhookstest.AssertPayload(t, webhookstest.Delivery{
+				Provider: webhooks.Gogs,
+				Event:    string(tc.event),
+				Fixture:  tc.filename,
+				Secret:   secret,
+			}, tc.typ)
+		})
+	}
+}
+
+func TestBadRequests(t *testing.T) {
+	assert := require.New(t)
+	hook, err := gogs.New(gogs.Options.Secret(secret))
+	assert.NoError(err)
+
+	tests := []struct {
+		name   string
+		event  gogs.Event
+		secret string
+		header http.Header
+		err    error
+	}{
+		{
+			name:   "UnsubscribedEvent",
+			event:  gogs.ReleaseEvent,
+			secret: secret,
+			err:    gogs.ErrEventNotFound,
+		},
+		{
+			name:   "MissingSignature",
+			event:  gogs.PushEvent,
+			header: http.Header{"X-Gogs-Signature": nil},
+			err:    gogs.ErrMissingGogsSignatureHeader,
+		},
+		{
+			name:   "SignatureMismatch",
+			event:  gogs.PushEvent,
+			secret: "badsampleToken",
+			err:    gogs.ErrHMACVerificationFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := webhookstest.NewRequest(webhookstest.Delivery{
+				Provider: webhooks.Gogs,
+				Event:    string(gogs.PushEvent),
+				Fixture:  "push-event.json",
+				Secret:   tc.secret,
+			})
+			assert.NoError(err)
+			for key, values := range tc.header {
+				req.Header[key] = values
+			}
+			_, err = hook.Parse(req, tc.event)
+			assert.Equal(tc.err, err)
+		})
+	}
+}
+
+func TestRouter(t *testing.T) {
+	assert := require.New(t)
+	hook, err := gogs.New(gogs.Options.Secret(secret))
+	assert.NoError(err)
+
+	var ref string
+	router := gogs.NewRouter(hook)
+	router.OnCreate(func(ctx context.Context, pl client.CreatePayload) error {
+		ref = pl.Ref
+		return nil
+	})
+
+	w, err := webhookstest.Serve(router, webhookstest.Delivery{
+		Provider: webhooks.Gogs,
+		Event:    string(gogs.CreateEvent),
+		Fixture:  "create-event.json",
+		Secret:   secret,
+	})
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("v1.0.0", ref)
+
+	w, err = webhookstest.Serve(router, webhookstest.Delivery{
+		Provider: webhooks.Gogs,
+		Event:    string(gogs.PushEvent),
+		Fixture:  "push-event.json",
+		Secret:   secret,
+	})
+	assert.NoError(err)
+	assert.Equal(http.StatusNoContent, w.Code)
+}
+
+type recordingLogger struct {
+	records []string
+}
+
+func (l *recordingLogger) record(level, msg string, args []interface{}) {
+	l.records = append(l.records, level+" "+msg+" "+fmt.Sprint(args...))
+}
+
+func (l *recordingLogger) Debug(msg string, args ...interface{}) { l.record("DEBUG", msg, args) }
+func (l *recordingLogger) Info(msg string, args ...interface{})  { l.record("INFO", msg, args) }
+func (l *recordingLogger) Warn(msg string, args ...interface{})  { l.record("WARN", msg, args) }
+func (l *recordingLogger) Error(msg string, args ...interface{}) { l.record("ERROR", msg, args) }
+
+func TestLogger(t *testing.T) {
+	assert := require.New(t)
+
+	tests := []struct {
+		name      string
+		secret    string
+		logBodies bool
+		level     string
+	}{
+		{
+			name:   "Parsed",
+			secret: secret,
+			level:  "DEBUG delivery parsed",
+		},
+		{
+			name:   "VerificationFailed",
+			secret: "badsampleToken",
+			level:  "WARN delivery verification failed",
+		},
+		{
+			name:      "BodyLogged",
+			secret:    secret,
+			logBodies: true,
+			level:     "DEBUG delivery parsed",
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			logger := &recordingLogger{}
+			options := []gogs.Option{gogs.Options.Secret(secret), gogs.Options.Logger(logger)}
+			if tc.logBodies {
+				options = append(options, gogs.Options.LogBodies())
+			}
+			hook, err := gogs.New(options...)
+			assert.NoError(err)
+
+			req, err := webhookstest.NewRequest(webhookstest.Delivery{
+				Provider: webhooks.Gogs,
+				Event:    string(gogs.PushEvent),
+				Fixture:  "push-event.json",
+				Secret:   tc.secret,
+			})
+			assert.NoError(err)
+			_, _ = hook.Parse(req, gogs.PushEvent)
+
+			assert.Len(logger.records, 1)
+			assert.True(strings.HasPrefix(logger.records[0], tc.level), logger.records[0])
+			assert.Contains(logger.records[0], req.Header.Get("X-Gogs-Delivery"))
+			assert.Equal(tc.logBodies, strings.Contains(logger.records[0], "email@example.com"))
+		})
+	}
+}
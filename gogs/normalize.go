@@ -0,0 +1,195 @@
+package gogs
+
+import (
+	"strings"
+
+	client "github.com/gogits/go-gogs-client"
+	webhooks "github.com/heitormejias/golang-webhooks"
+)
+
+// Normalize converts a payload returned by Parse into the provider agnostic
+// normalized events, webhooks.ErrNotNormalizable is returned for payloads
+// without a normalized form
+func Normalize(payload interface{}) ([]webhooks.NormalizedEvent, error) {
+	switch pl := payload.(type) {
+	case client.PushPayload:
+		return []webhooks.NormalizedEvent{normalizePush(pl)}, nil
+	case client.PullRequestPayload:
+		if pl.PullRequest == nil {
+			return nil, webhooks.ErrNotNormalizable
+		}
+		return []webhooks.NormalizedEvent{normalizePullRequest(pl)}, nil
+	case client.IssuesPayload:
+		if pl.Issue == nil {
+			return nil, webhooks.ErrNotNormalizable
+		}
+		return []webhooks.NormalizedEvent{normalizeIssue(pl)}, nil
+	case client.ReleasePayload:
+		if pl.Release == nil {
+			return nil, webhooks.ErrNotNormalizable
+		}
+		return []webhooks.NormalizedEvent{normalizeRelease(pl)}, nil
+	case client.CreatePayload:
+		if pl.RefType != "tag" {
+			return nil, webhooks.ErrNotNormalizable
+		}
+		return []webhooks.NormalizedEvent{webhooks.NormalizedTag{
+			Provider:   webhooks.Gogs,
+			Repository: normalizeRepository(pl.Repo),
+			Action:     webhooks.ActionCreated,
+			Name:       strings.TrimPrefix(pl.Ref, "refs/tags/"),
+			SHA:        pl.Sha,
+			Sender:     normalizeUser(pl.Sender),
+		}}, nil
+	case client.DeletePayload:
+		if pl.RefType != "tag" {
+			return nil, webhooks.ErrNotNormalizable
+		}
+		return []webhooks.NormalizedEvent{webhooks.NormalizedTag{
+			Provider:   webhooks.Gogs,
+			Repository: normalizeRepository(pl.Repo),
+			Action:     webhooks.ActionDeleted,
+			Name:       strings.TrimPrefix(pl.Ref, "refs/tags/"),
+			Sender:     normalizeUser(pl.Sender),
+		}}, nil
+	default:
+		return nil, webhooks.ErrNotNormalizable
+	}
+}
+
+// Normalize converts a payload returned by Parse into normalized events, it implements webhooks.Provider
+func (hook Webhook) Normalize(payload interface{}) ([]webhooks.NormalizedEvent, error) {
+	return Normalize(payload)
+}
+
+func normalizeRepository(r *client.Repository) webhooks.NormalizedRepository {
+	if r == nil {
+		return webhooks.NormalizedRepository{}
+	}
+	return webhooks.NormalizedRepository{
+		Name:          r.Name,
+		FullName:      r.FullName,
+		HTMLURL:       r.HTMLURL,
+		CloneURL:      r.CloneURL,
+		DefaultBranch: r.DefaultBranch,
+		Private:       r.Private,
+	}
+}
+
+func normalizeUser(u *client.User) webhooks.NormalizedUser {
+	if u == nil {
+		return webhooks.NormalizedUser{}
+	}
+	login := u.Login
+	if login == "" {
+		// LEGACY [Gogs 1.0]
+		login = u.UserName
+	}
+	return webhooks.NormalizedUser{Login: login, Name: u.FullName, Email: u.Email}
+}
+
+func normalizeLabels(labels []*client.Label) []string {
+	var names []string
+	for _, l := range labels {
+		if l != nil {
+			names = append(names, l.Name)
+		}
+	}
+	return names
+}
+
+func normalizePush(pl client.PushPayload) webhooks.NormalizedPush {
+	push := webhooks.NormalizedPush{
+		Provider:   webhooks.Gogs,
+		Repository: normalizeRepository(pl.Repo),
+		Ref:        pl.Ref,
+		Before:     pl.Before,
+		After:      pl.After,
+		Created:    strings.Trim(pl.Before, "0") == "",
+		Deleted:    strings.Trim(pl.After, "0") == "",
+		CompareURL: pl.CompareURL,
+		Sender:     normalizeUser(pl.Sender),
+	}
+	for _, c := range pl.Commits {
+		if c == nil {
+			continue
+		}
+		commit := webhooks.NormalizedCommit{
+			ID:        c.ID,
+			Message:   c.Message,
+			URL:       c.URL,
+			Timestamp: c.Timestamp,
+			Added:     c.Added,
+			Modified:  c.Modified,
+			Removed:   c.Removed,
+		}
+		if c.Author != nil {
+			commit.Author = webhooks.NormalizedUser{Login: c.Author.UserName, Name: c.Author.Name, Email: c.Author.Email}
+		}
+		push.Commits = append(push.Commits, commit)
+	}
+	return push
+}
+
+func normalizePullRequest(pl client.PullRequestPayload) webhooks.NormalizedPullRequest {
+	pr := webhooks.NormalizedPullRequest{
+		Provider:     webhooks.Gogs,
+		Repository:   normalizeRepository(pl.Repository),
+		Action:       normalizeAction(string(pl.Action)),
+		Number:       pl.Index,
+		Title:        pl.PullRequest.Title,
+		Body:         pl.PullRequest.Body,
+		HTMLURL:      pl.PullRequest.HTMLURL,
+		State:        string(pl.PullRequest.State),
+		Merged:       pl.PullRequest.HasMerged,
+		SourceBranch: pl.PullRequest.HeadBranch,
+		TargetBranch: pl.PullRequest.BaseBranch,
+		Labels:       normalizeLabels(pl.PullRequest.Labels),
+		Author:       normalizeUser(pl.PullRequest.Poster),
+		Sender:       normalizeUser(pl.Sender),
+	}
+	if pr.Action == webhooks.ActionClosed && pr.Merged {
+		pr.Action = webhooks.ActionMerged
+	}
+	return pr
+}
+
+func normalizeIssue(pl client.IssuesPayload) webhooks.NormalizedIssue {
+	return webhooks.NormalizedIssue{
+		Provider:   webhooks.Gogs,
+		Repository: normalizeRepository(pl.Repository),
+		Action:     normalizeAction(string(pl.Action)),
+		Number:     pl.Index,
+		Title:      pl.Issue.Title,
+		Body:       pl.Issue.Body,
+		State:      string(pl.Issue.State),
+		Labels:     normalizeLabels(pl.Issue.Labels),
+		Author:     normalizeUser(pl.Issue.Poster),
+		Sender:     normalizeUser(pl.Sender),
+	}
+}
+
+func normalizeRelease(pl client.ReleasePayload) webhooks.NormalizedRelease {
+	return webhooks.NormalizedRelease{
+		Provider:   webhooks.Gogs,
+		Repository: normalizeRepository(pl.Repository),
+		Action:     normalizeAction(string(pl.Action)),
+		TagName:    pl.Release.TagName,
+		Name:       pl.Release.Name,
+		Body:       pl.Release.Body,
+		Draft:      pl.Release.Draft,
+		Prerelease: pl.Release.Prerelease,
+		Author:     normalizeUser(pl.Release.Author),
+		Sender:     normalizeUser(pl.Sender),
+	}
+}
+
+// normalizeAction maps Gogs actions onto the normalized actions
+func normalizeAction(action string) string {
+	switch action {
+	case "edited", "synchronized":
+		return webhooks.ActionUpdated
+	default:
+		return action
+	}
+}
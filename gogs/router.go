@@ -0,0 +1,144 @@
+package gogs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	client "github.com/gogits/go-gogs-client"
+	webhooks "github.com/heitormejias/golang-webhooks"
+)
+
+// HandlerFunc handles the payload returned by Parse for a registered event
+type HandlerFunc func(ctx context.Context, payload interface{}) error
+
+// Router dispatches the Gogs deliveries to the callbacks registered per event, the
+// events to parse are derived from the registered callbacks. It implements http.Handler
+type Router struct {
+	hook     *Webhook
+	handlers map[Event]HandlerFunc
+}
+
+// NewRouter creates and returns a Router parsing the deliveries with the given Webhook
+func NewRouter(hook *Webhook) *Router {
+	return &Router{
+		hook:     hook,
+		handlers: make(map[Event]HandlerFunc),
+	}
+}
+
+// On registers the callback for the given event, registering an event twice
+// replaces the previous callback. Callbacks must be registered before serving
+func (router *Router) On(event Event, fn HandlerFunc) {
+	router.handlers[event] = fn
+}
+
+// ServeHTTP parses the delivery and calls the callback registered for its event.
+//
+// Events without callback are answered with 204 No Content, invalid methods with
+// 405 Method Not Allowed, failed verifications with 401 Unauthorized and malformed
+// deliveries with 400 Bad Request. Callback errors are answered with 500 Internal
+// Server Error unless they are a webhooks.StatusError
+func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	events := make([]Event, 0, len(router.handlers))
+	for event := range router.handlers {
+		events = append(events, event)
+	}
+
+	payload, err := router.hook.Parse(r, events...)
+	if err != nil {
+		code := StatusCode(err)
+		if code == http.StatusNoContent {
+			w.WriteHeader(code)
+			return
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	handler, ok := router.handlers[Event(r.Header.Get("X-Gogs-Event"))]
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err := handler(r.Context(), payload); err != nil {
+		code := webhooks.StatusCode(err)
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// StatusCode maps the errors returned by Parse onto HTTP status codes
+func StatusCode(err error) int {
+	switch {
+	case errors.Is(err, ErrEventNotFound), errors.Is(err, ErrEventNotSpecifiedToParse):
+		return http.StatusNoContent
+	case errors.Is(err, ErrInvalidHTTPMethod):
+		return http.StatusMethodNotAllowed
+	case errors.Is(err, webhooks.ErrPayloadTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrMissingGogsSignatureHeader), errors.Is(err, ErrHMACVerificationFailed):
+		return http.StatusUnauthorized
+	case errors.Is(err, webhooks.ErrSecretLookup):
+		return http.StatusInternalServerError
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// OnCreate registers the callback for the CreateEvent
+func (router *Router) OnCreate(fn func(ctx context.Context, pl client.CreatePayload) error) {
+	router.On(CreateEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(client.CreatePayload))
+	})
+}
+
+// OnDelete registers the callback for the DeleteEvent
+func (router *Router) OnDelete(fn func(ctx context.Context, pl client.DeletePayload) error) {
+	router.On(DeleteEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(client.DeletePayload))
+	})
+}
+
+// OnFork registers the callback for the ForkEvent
+func (router *Router) OnFork(fn func(ctx context.Context, pl client.ForkPayload) error) {
+	router.On(ForkEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(client.ForkPayload))
+	})
+}
+
+// OnPush registers the callback for the PushEvent
+func (router *Router) OnPush(fn func(ctx context.Context, pl client.PushPayload) error) {
+	router.On(PushEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(client.PushPayload))
+	})
+}
+
+// OnIssues registers the callback for the IssuesEvent
+func (router *Router) OnIssues(fn func(ctx context.Context, pl client.IssuesPayload) error) {
+	router.On(IssuesEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(client.IssuesPayload))
+	})
+}
+
+// OnIssueComment registers the callback for the IssueCommentEvent
+func (router *Router) OnIssueComment(fn func(ctx context.Context, pl client.IssueCommentPayload) error) {
+	router.On(IssueCommentEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(client.IssueCommentPayload))
+	})
+}
+
+// OnPullRequest registers the callback for the PullRequestEvent
+func (router *Router) OnPullRequest(fn func(ctx context.Context, pl client.PullRequestPayload) error) {
+	router.On(PullRequestEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(client.PullRequestPayload))
+	})
+}
+
+// OnRelease registers the callback for the ReleaseEvent
+func (router *Router) OnRelease(fn func(ctx context.Context, pl client.ReleasePayload) error) {
+	router.On(ReleaseEvent, func(ctx context.Context, payload interface{}) error {
+		return fn(ctx, payload.(client.ReleasePayload))
+	})
+}
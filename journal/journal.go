@@ -0,0 +1,434 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+)
+
+// journal errors
+var (
+	ErrJournalClosed      = errors.New("journal closed")
+	ErrInvalidSegmentSize = errors.New("segment size must be greater than 0")
+)
+
+const (
+	segmentPrefix = "segment-"
+	segmentSuffix = ".jsonl"
+)
+
+// Entry is a verified delivery recorded in the journal, the headers and raw body
+// are kept so the delivery can be verified and parsed again when replayed
+type Entry struct {
+	Provider   webhooks.ProviderName `json:"provider"`
+	ID         string                `json:"id"`
+	Event      string                `json:"event"`
+	Header     http.Header           `json:"header"`
+	Body       []byte                `json:"body"`
+	ReceivedAt time.Time             `json:"received_at"`
+}
+
+// Request returns a POST request to target carrying the headers and body of the
+// entry, ready to be handed to a Parse method, a Router or sent over the network
+func (entry Entry) Request(target string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(entry.Body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range entry.Header {
+		req.Header[key] = append([]string(nil), values...)
+	}
+	return req, nil
+}
+
+// Redelivered returns a copy of the entry with a new delivery ID, in its headers
+// too, so receivers deduplicating deliveries handle it again. Signatures don't
+// cover the delivery ID, they still verify
+func (entry Entry) Redelivered() Entry {
+	name := webhooks.DeliveryIDHeader(entry.Provider)
+	if name == "" {
+		return entry
+	}
+	entry.ID = webhooks.NewDeliveryID()
+	header := make(http.Header, len(entry.Header))
+	for key, values := range entry.Header {
+		header[key] = append([]string(nil), values...)
+	}
+	header.Set(name, entry.ID)
+	entry.Header = header
+	return entry
+}
+
+// Filter selects the entries to replay, zero fields match every entry
+type Filter struct {
+	// Since and Until bound the receive time, Until is exclusive
+	Since     time.Time
+	Until     time.Time
+	Providers []webhooks.ProviderName
+	Events    []string
+}
+
+// Match reports whether the entry is selected by the filter
+func (f Filter) Match(entry Entry) bool {
+	if !f.Since.IsZero() && entry.ReceivedAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !entry.ReceivedAt.Before(f.Until) {
+		return false
+	}
+	if len(f.Providers) > 0 {
+		var found bool
+		for _, p := range f.Providers {
+			if p == entry.Provider {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.Events) > 0 {
+		var found bool
+		for _, e := range f.Events {
+			if e == entry.Event {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Option is a configuration option for the journal
+type Option func(*Journal) error
+
+// Options is a namespace var for configuration options
+var Options = JournalOptions{}
+
+// JournalOptions is a namespace for configuration option methods
+type JournalOptions struct{}
+
+// SegmentSize sets the size in bytes after which a new segment is started, 64MiB by default
+func (JournalOptions) SegmentSize(size int64) Option {
+	return func(j *Journal) error {
+		if size <= 0 {
+			return ErrInvalidSegmentSize
+		}
+		j.segmentSize = size
+		return nil
+	}
+}
+
+// Sync flushes every entry to stable storage before Append returns
+func (JournalOptions) Sync() Option {
+	return func(j *Journal) error {
+		j.sync = true
+		return nil
+	}
+}
+
+// Journal is an append-only log of verified deliveries stored as JSON lines in
+// numbered segment files of a directory. It is safe for concurrent use.
+//
+// The recorded headers include the GitLab token, the files are only readable by
+// their owner
+type Journal struct {
+	dir         string
+	segmentSize int64
+	sync        bool
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	segment int
+}
+
+// Open opens or creates the journal in dir, entries are appended to its last segment
+func Open(dir string, options ...Option) (*Journal, error) {
+	j := &Journal{
+		dir:         dir,
+		segmentSize: 64 << 20,
+	}
+	for _, opt := range options {
+		if err := opt(j); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	segment := 1
+	if len(segments) > 0 {
+		segment = segments[len(segments)-1]
+	}
+	if err := j.openSegment(segment); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func segmentPath(dir string, segment int) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%08d%s", segmentPrefix, segment, segmentSuffix))
+}
+
+// listSegments returns the sorted segment numbers found in dir
+func listSegments(dir string) ([]int, error) {
+	names, err := filepath.Glob(filepath.Join(dir, segmentPrefix+"*"+segmentSuffix))
+	if err != nil {
+		return nil, err
+	}
+	var segments []int
+	for _, name := range names {
+		var segment int
+		base := strings.TrimSuffix(filepath.Base(name), segmentSuffix)
+		if _, err := fmt.Sscanf(base, segmentPrefix+"%d", &segment); err == nil {
+			segments = append(segments, segment)
+		}
+	}
+	sort.Ints(segments)
+	return segments, nil
+}
+
+func (j *Journal) openSegment(segment int) error {
+	file, err := os.OpenFile(segmentPath(j.dir, segment), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	j.file, j.size, j.segment = file, info.Size(), segment
+	return nil
+}
+
+// Append records the delivery, a new segment is started once the current one
+// exceeds the segment size
+func (j *Journal) Append(delivery *webhooks.Delivery) error {
+	line, err := json.Marshal(Entry{
+		Provider:   delivery.Provider,
+		ID:         delivery.ID,
+		Event:      delivery.Event,
+		Header:     delivery.Header,
+		Body:       delivery.Body,
+		ReceivedAt: delivery.ReceivedAt,
+	})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return ErrJournalClosed
+	}
+
+	if j.size > 0 && j.size+int64(len(line)) > j.segmentSize {
+		if err := j.file.Close(); err != nil {
+			return err
+		}
+		if err := j.openSegment(j.segment + 1); err != nil {
+			j.file = nil
+			return err
+		}
+	}
+
+	n, err := j.file.Write(line)
+	j.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if j.sync {
+		return j.file.Sync()
+	}
+	return nil
+}
+
+// Recording wraps a ParseDelivery style function so every verified delivery it
+// returns is appended to the journal, journal errors are returned as parse errors
+func (j *Journal) Recording(parse func(r *http.Request) (*webhooks.Delivery, error)) func(r *http.Request) (*webhooks.Delivery, error) {
+	return func(r *http.Request) (*webhooks.Delivery, error) {
+		delivery, err := parse(r)
+		if err != nil {
+			return delivery, err
+		}
+		if err := j.Append(delivery); err != nil {
+			return nil, &webhooks.StatusError{Code: http.StatusInternalServerError, Err: err}
+		}
+		return delivery, nil
+	}
+}
+
+// Replay calls fn for every entry of the journal matching the filter
+func (j *Journal) Replay(filter Filter, fn func(entry Entry) error) error {
+	return Replay(j.dir, filter, fn)
+}
+
+// Close closes the current segment
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// Replay calls fn in order for every entry of the journal in dir matching the
+// filter, the journal may be written to concurrently. Replaying stops at the
+// first error returned by fn
+func Replay(dir string, filter Filter, fn func(entry Entry) error) error {
+	segments, err := listSegments(dir)
+	if err != nil {
+		return err
+	}
+	for _, segment := range segments {
+		if err := replaySegment(segmentPath(dir, segment), filter, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func replaySegment(path string, filter Filter, fn func(entry Entry) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	r := bufio.NewReader(file)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// a trailing line without newline is still being written
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if !filter.Match(entry) {
+			continue
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+}
+
+// ReplayOption is a configuration option for ReplayTo
+type ReplayOption func(*replayConfig) error
+
+type replayConfig struct {
+	newIDs bool
+}
+
+// ReplayOptions is a namespace var for replay options
+var ReplayOptions = ReplayToOptions{}
+
+// ReplayToOptions is a namespace for replay option methods
+type ReplayToOptions struct{}
+
+// NewIDs replays the entries with new delivery IDs, see Entry.Redelivered.
+// Handlers behind webhooks.Deduplicate acknowledge the deliveries replayed with
+// their original ID as duplicates without handling them
+func (ReplayToOptions) NewIDs() ReplayOption {
+	return func(cfg *replayConfig) error {
+		cfg.newIDs = true
+		return nil
+	}
+}
+
+// ReplayTo hands the requests of the entries matching the filter to the handler,
+// usually the Router of the provider, and returns the number of entries replayed.
+// The entries keep their delivery ID unless replayed with ReplayOptions.NewIDs.
+// Handler responses other than 2xx are reported as errors once every entry was replayed
+func ReplayTo(dir string, filter Filter, handler http.Handler, options ...ReplayOption) (int, error) {
+	var cfg replayConfig
+	for _, opt := range options {
+		if err := opt(&cfg); err != nil {
+			return 0, err
+		}
+	}
+
+	var replayed int
+	var failed []string
+	err := Replay(dir, filter, func(entry Entry) error {
+		if cfg.newIDs {
+			entry = entry.Redelivered()
+		}
+		req, err := entry.Request("/")
+		if err != nil {
+			return err
+		}
+		w := &statusRecorder{header: http.Header{}, code: http.StatusOK}
+		handler.ServeHTTP(w, req)
+		replayed++
+		if w.code < 200 || w.code > 299 {
+			failed = append(failed, fmt.Sprintf("%s %s: %d", entry.Provider, entry.ID, w.code))
+		}
+		return nil
+	})
+	if err != nil {
+		return replayed, err
+	}
+	if len(failed) > 0 {
+		return replayed, fmt.Errorf("replay failed for %s", strings.Join(failed, ", "))
+	}
+	return replayed, nil
+}
+
+// statusRecorder is a minimal http.ResponseWriter keeping the status code only
+type statusRecorder struct {
+	header http.Header
+	code   int
+	wrote  bool
+}
+
+func (w *statusRecorder) Header() http.Header {
+	return w.header
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	w.wrote = true
+	return len(b), nil
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	if !w.wrote {
+		w.code = code
+		w.wrote = true
+	}
+}
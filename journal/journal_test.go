@@ -0,0 +1,158 @@
+package journal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+	"github.com/heitormejias/golang-webhooks/github"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	path = "/webhooks"
+)
+
+func newDelivery(provider webhooks.ProviderName, event, id string, receivedAt time.Time, body []byte) *webhooks.Delivery {
+	header := http.Header{}
+	header.Set("X-Github-Event", event)
+	header.Set("X-Github-Delivery", id)
+	delivery := webhooks.NewDelivery(provider, header, body)
+	delivery.ReceivedAt = receivedAt
+	return delivery
+}
+
+func TestReplay(t *testing.T) {
+	assert := require.New(t)
+	dir := t.TempDir()
+	j, err := Open(dir, Options.SegmentSize(512))
+	assert.NoError(err)
+
+	start := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		event := "push"
+		if i%2 == 1 {
+			event = "pull_request"
+		}
+		id := string(rune('a' + i))
+		assert.NoError(j.Append(newDelivery(webhooks.GitHub, event, id, start.Add(time.Duration(i)*time.Hour), []byte(`{"ref":"refs/heads/main"}`))))
+	}
+	assert.NoError(j.Close())
+
+	segments, err := listSegments(dir)
+	assert.NoError(err)
+	assert.Greater(len(segments), 1)
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		expected string
+	}{
+		{
+			name:     "All",
+			expected: "abcdefghij",
+		},
+		{
+			name:     "TimeRange",
+			filter:   Filter{Since: start.Add(2 * time.Hour), Until: start.Add(5 * time.Hour)},
+			expected: "cde",
+		},
+		{
+			name:     "Event",
+			filter:   Filter{Events: []string{"pull_request"}},
+			expected: "bdfhj",
+		},
+		{
+			name:     "Provider",
+			filter:   Filter{Providers: []webhooks.ProviderName{webhooks.GitLab}},
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var ids strings.Builder
+			err := Replay(dir, tc.filter, func(entry Entry) error {
+				ids.WriteString(entry.ID)
+				return nil
+			})
+			assert.NoError(err)
+			assert.Equal(tc.expected, ids.String())
+		})
+	}
+
+	// entries appended after reopening go to the last segment
+	j, err = Open(dir, Options.SegmentSize(512))
+	assert.NoError(err)
+	assert.NoError(j.Append(newDelivery(webhooks.GitHub, "push", "k", start.Add(10*time.Hour), []byte(`{}`))))
+	assert.NoError(j.Close())
+	var last string
+	assert.NoError(Replay(dir, Filter{}, func(entry Entry) error {
+		last = entry.ID
+		return nil
+	}))
+	assert.Equal("k", last)
+}
+
+func TestReplayTo(t *testing.T) {
+	assert := require.New(t)
+	body, err := os.ReadFile("../testdata/github/push.json")
+	assert.NoError(err)
+
+	hook, err := github.New(github.Options.Secret("IsWishesWereHorsesWedAllBeEatingSteak!"))
+	assert.NoError(err)
+	j, err := Open(filepath.Join(t.TempDir(), "journal"))
+	assert.NoError(err)
+	defer func() {
+		_ = j.Close()
+	}()
+
+	// record the delivery while parsing it
+	parse := j.Recording(func(r *http.Request) (*webhooks.Delivery, error) {
+		return hook.ParseDelivery(r, github.PushEvent)
+	})
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(string(body)))
+	req.Header.Set("X-Github-Event", "push")
+	req.Header.Set("X-Github-Delivery", "72d3162e-cc78-11e3-81ab-4c9367dc0958")
+	req.Header.Set("X-Hub-Signature", "sha1=0534736f52c2fc5896ef1bd5a043127b20d233ba")
+	_, err = parse(req)
+	assert.NoError(err)
+
+	// replay it through a router verifying the signature again
+	var pushes []github.PushPayload
+	router := github.NewRouter(hook)
+	router.OnPush(func(ctx context.Context, pl github.PushPayload) error {
+		pushes = append(pushes, pl)
+		return nil
+	})
+	replayed, err := ReplayTo(j.dir, Filter{Events: []string{"push"}}, router)
+	assert.NoError(err)
+	assert.Equal(1, replayed)
+	assert.Len(pushes, 1)
+
+	// deduplicating handlers acknowledge deliveries replayed with their ID without handling them
+	dedup := webhooks.Deduplicate(webhooks.NewMemoryDedupStore(10, time.Hour), webhooks.DedupReject, router)
+	_, err = ReplayTo(j.dir, Filter{}, dedup)
+	assert.NoError(err)
+	assert.Len(pushes, 2)
+	_, err = ReplayTo(j.dir, Filter{}, dedup)
+	assert.NoError(err)
+	assert.Len(pushes, 2)
+	_, err = ReplayTo(j.dir, Filter{}, dedup, ReplayOptions.NewIDs())
+	assert.NoError(err)
+	assert.Len(pushes, 3)
+	assert.NoError(Replay(j.dir, Filter{}, func(entry Entry) error {
+		redelivered := entry.Redelivered()
+		assert.NotEqual(entry.ID, redelivered.ID)
+		assert.Equal(redelivered.ID, redelivered.Header.Get("X-GitHub-Delivery"))
+		assert.Equal("72d3162e-cc78-11e3-81ab-4c9367dc0958", entry.Header.Get("X-GitHub-Delivery"))
+		return nil
+	}))
+}
@@ -0,0 +1,83 @@
+package webhooks
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Logger is the structured logger of the provider Webhooks. Every method takes a
+// message followed by alternating keys and values, *slog.Logger implements it
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// StdLogger adapts a *log.Logger to Logger, records are written on one line as
+// "level msg key=value ..."
+func StdLogger(logger *log.Logger) Logger {
+	return stdLogger{logger: logger}
+}
+
+type stdLogger struct {
+	logger *log.Logger
+}
+
+func (l stdLogger) Debug(msg string, args ...interface{}) { l.log("DEBUG", msg, args) }
+func (l stdLogger) Info(msg string, args ...interface{})  { l.log("INFO", msg, args) }
+func (l stdLogger) Warn(msg string, args ...interface{})  { l.log("WARN", msg, args) }
+func (l stdLogger) Error(msg string, args ...interface{}) { l.log("ERROR", msg, args) }
+
+func (l stdLogger) log(level, msg string, args []interface{}) {
+	var b strings.Builder
+	b.WriteString(level)
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 < len(args) {
+			_, _ = fmt.Fprintf(&b, " %v=%q", args[i], fmt.Sprint(args[i+1]))
+		} else {
+			_, _ = fmt.Fprintf(&b, " !BADKEY=%q", fmt.Sprint(args[i]))
+		}
+	}
+	_ = l.logger.Output(3, b.String())
+}
+
+// LogParse logs the outcome of a delivery handed to a Parse method: parsed
+// deliveries at debug level, unparsed events at info level, verification and
+// decode failures at warn level and secret lookup failures at error level.
+// Verification failures are told apart by o.VerificationFailed, whatever the event.
+//
+// The body is only logged when not nil, provider Webhooks pass it when the
+// LogBodies option is set as it may carry secrets and personal data
+func LogParse(logger Logger, o ParseObservation, deliveryID string, err error, body []byte) {
+	args := []interface{}{
+		"provider", string(o.Provider),
+		"event", o.Event,
+		"delivery", deliveryID,
+		"outcome", o.Outcome,
+		"size", o.Size,
+		"duration", o.Duration,
+	}
+	if err != nil {
+		args = append(args, "error", err.Error())
+	}
+	if body != nil {
+		args = append(args, "body", string(body))
+	}
+
+	switch {
+	case o.Outcome == OutcomeOK:
+		logger.Debug("delivery parsed", args...)
+	case o.Outcome == OutcomeSecretLookup:
+		logger.Error("secret lookup failed", args...)
+	case o.VerificationFailed:
+		logger.Warn("delivery verification failed", args...)
+	case o.Outcome == OutcomeEventNotFound, o.Event == UnknownEvent:
+		logger.Info("event not parsed", args...)
+	default:
+		logger.Warn("delivery parse failed", args...)
+	}
+}
@@ -0,0 +1,322 @@
+// Package metrics collects delivery counts, parse latency and body sizes from
+// the provider Webhooks and exposes them in the Prometheus text exposition format
+package metrics
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+)
+
+// ErrInvalidBuckets is returned for empty or not strictly increasing bucket bounds
+var ErrInvalidBuckets = errors.New("buckets must be strictly increasing")
+
+// ContentType is the content type of the Prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	defaultDurationBuckets = []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1}
+	defaultSizeBuckets     = []float64{1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20}
+)
+
+// Option is a configuration option for the collector
+type Option func(*Collector) error
+
+// Options is a namespace var for configuration options
+var Options = CollectorOptions{}
+
+// CollectorOptions is a namespace for configuration option methods
+type CollectorOptions struct{}
+
+// DurationBuckets sets the upper bounds in seconds of the parse latency histogram
+// buckets, from 100µs to 1s by default
+func (CollectorOptions) DurationBuckets(buckets ...float64) Option {
+	return func(c *Collector) error {
+		if !increasing(buckets) {
+			return ErrInvalidBuckets
+		}
+		c.durationBuckets = buckets
+		return nil
+	}
+}
+
+// SizeBuckets sets the upper bounds in bytes of the body size histogram buckets,
+// from 1KiB to 16MiB by default
+func (CollectorOptions) SizeBuckets(buckets ...float64) Option {
+	return func(c *Collector) error {
+		if !increasing(buckets) {
+			return ErrInvalidBuckets
+		}
+		c.sizeBuckets = buckets
+		return nil
+	}
+}
+
+func increasing(buckets []float64) bool {
+	if len(buckets) == 0 {
+		return false
+	}
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] <= buckets[i-1] {
+			return false
+		}
+	}
+	return true
+}
+
+type series struct {
+	provider webhooks.ProviderName
+	event    string
+}
+
+type outcomeSeries struct {
+	series
+	outcome string
+}
+
+type driftSeries struct {
+	series
+	kind string
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(bounds []float64, v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(bounds))
+	}
+	for i, bound := range bounds {
+		if v <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// Collector is a webhooks.ParseObserver counting the deliveries by provider, event
+// and outcome and recording the parse latency and body size histograms by provider
+// and event. As a webhooks.DriftObserver it counts the deliveries with unknown or
+// missing payload fields. It implements http.Handler serving the metrics to Prometheus:
+//
+//	collector, _ := metrics.New()
+//	hook, _ := github.New(github.Options.Secret("..."), github.Options.Observer(collector))
+//	http.Handle("/metrics", collector)
+type Collector struct {
+	durationBuckets []float64
+	sizeBuckets     []float64
+
+	mu         sync.Mutex
+	deliveries map[outcomeSeries]uint64
+	durations  map[series]*histogram
+	sizes      map[series]*histogram
+	drifts     map[driftSeries]uint64
+}
+
+// New creates and returns a Collector
+func New(options ...Option) (*Collector, error) {
+	c := &Collector{
+		durationBuckets: defaultDurationBuckets,
+		sizeBuckets:     defaultSizeBuckets,
+		deliveries:      make(map[outcomeSeries]uint64),
+		durations:       make(map[series]*histogram),
+		sizes:           make(map[series]*histogram),
+		drifts:          make(map[driftSeries]uint64),
+	}
+	for _, opt := range options {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// ObserveParse records the delivery, it implements webhooks.ParseObserver
+func (c *Collector) ObserveParse(o webhooks.ParseObservation) {
+	s := series{provider: o.Provider, event: o.Event}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deliveries[outcomeSeries{series: s, outcome: o.Outcome}]++
+
+	duration, ok := c.durations[s]
+	if !ok {
+		duration = &histogram{}
+		c.durations[s] = duration
+	}
+	duration.observe(c.durationBuckets, o.Duration.Seconds())
+
+	size, ok := c.sizes[s]
+	if !ok {
+		size = &histogram{}
+		c.sizes[s] = size
+	}
+	size.observe(c.sizeBuckets, float64(o.Size))
+}
+
+// Drift kinds
+const (
+	DriftUnknown = "unknown"
+	DriftMissing = "missing"
+)
+
+// ObserveDrift records the drifted delivery, it implements webhooks.DriftObserver
+func (c *Collector) ObserveDrift(d webhooks.Drift) {
+	s := series{provider: d.Provider, event: d.Event}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(d.Unknown) > 0 {
+		c.drifts[driftSeries{series: s, kind: DriftUnknown}]++
+	}
+	if len(d.Missing) > 0 {
+		c.drifts[driftSeries{series: s, kind: DriftMissing}]++
+	}
+}
+
+// Drifts returns the number of deliveries of the provider and event recorded
+// with fields of the drift kind
+func (c *Collector) Drifts(provider webhooks.ProviderName, event, kind string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.drifts[driftSeries{series: series{provider: provider, event: event}, kind: kind}]
+}
+
+// Deliveries returns the number of deliveries recorded for the provider, event and outcome
+func (c *Collector) Deliveries(provider webhooks.ProviderName, event, outcome string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.deliveries[outcomeSeries{series: series{provider: provider, event: event}, outcome: outcome}]
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	_, _ = c.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format, it
+// implements io.WriterTo
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	c.mu.Lock()
+	c.writeDeliveries(bw)
+	writeHistograms(bw, "webhooks_parse_duration_seconds", "Time spent parsing deliveries, reading the body included.", c.durationBuckets, c.durations)
+	writeHistograms(bw, "webhooks_body_size_bytes", "Size of the delivery bodies.", c.sizeBuckets, c.sizes)
+	c.writeDrifts(bw)
+	c.mu.Unlock()
+
+	err := bw.Flush()
+	return cw.n, err
+}
+
+func (c *Collector) writeDeliveries(w *bufio.Writer) {
+	keys := make([]outcomeSeries, 0, len(c.deliveries))
+	for key := range c.deliveries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].series != keys[j].series {
+			return keys[i].series.less(keys[j].series)
+		}
+		return keys[i].outcome < keys[j].outcome
+	})
+
+	_, _ = fmt.Fprintln(w, "# HELP webhooks_deliveries_total Deliveries parsed by provider, event and outcome.")
+	_, _ = fmt.Fprintln(w, "# TYPE webhooks_deliveries_total counter")
+	for _, key := range keys {
+		_, _ = fmt.Fprintf(w, "webhooks_deliveries_total{%s,outcome=%s} %d\n", key.labels(), quote(key.outcome), c.deliveries[key])
+	}
+}
+
+func (c *Collector) writeDrifts(w *bufio.Writer) {
+	keys := make([]driftSeries, 0, len(c.drifts))
+	for key := range c.drifts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].series != keys[j].series {
+			return keys[i].series.less(keys[j].series)
+		}
+		return keys[i].kind < keys[j].kind
+	})
+
+	_, _ = fmt.Fprintln(w, "# HELP webhooks_payload_drift_total Deliveries with payload fields unknown to or missing from the payload structs.")
+	_, _ = fmt.Fprintln(w, "# TYPE webhooks_payload_drift_total counter")
+	for _, key := range keys {
+		_, _ = fmt.Fprintf(w, "webhooks_payload_drift_total{%s,kind=%s} %d\n", key.labels(), quote(key.kind), c.drifts[key])
+	}
+}
+
+func writeHistograms(w *bufio.Writer, name, help string, bounds []float64, histograms map[series]*histogram) {
+	keys := make([]series, 0, len(histograms))
+	for key := range histograms {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].less(keys[j])
+	})
+
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	_, _ = fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	for _, key := range keys {
+		h := histograms[key]
+		labels := key.labels()
+		var cumulative uint64
+		for i, bound := range bounds {
+			cumulative += h.counts[i]
+			_, _ = fmt.Fprintf(w, "%s_bucket{%s,le=%s} %d\n", name, labels, quote(formatFloat(bound)), cumulative)
+		}
+		_, _ = fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+		_, _ = fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, formatFloat(h.sum))
+		_, _ = fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.count)
+	}
+}
+
+func (s series) less(o series) bool {
+	if s.provider != o.provider {
+		return s.provider < o.provider
+	}
+	return s.event < o.event
+}
+
+func (s series) labels() string {
+	return "provider=" + quote(string(s.provider)) + ",event=" + quote(s.event)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// quote returns the escaped and quoted label value
+func quote(value string) string {
+	return `"` + labelEscaper.Replace(value) + `"`
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
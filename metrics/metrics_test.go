@@ -0,0 +1,182 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+	"github.com/heitormejias/golang-webhooks/github"
+	"github.com/heitormejias/golang-webhooks/gitlab"
+	"github.com/heitormejias/golang-webhooks/webhookstest"
+)
+
+func TestCollector(t *testing.T) {
+	assert := require.New(t)
+	collector, err := New()
+	assert.NoError(err)
+	githubHook, err := github.New(github.Options.Secret("secret"), github.Options.Observer(collector))
+	assert.NoError(err)
+	gitlabHook, err := gitlab.New(gitlab.Options.Secret("secret"), gitlab.Options.Observer(collector))
+	assert.NoError(err)
+
+	tests := []struct {
+		name     string
+		delivery webhookstest.Delivery
+		parse    func(r *http.Request) error
+		event    string
+		outcome  string
+	}{
+		{
+			name:     "GitHubPush",
+			delivery: webhookstest.Delivery{Provider: webhooks.GitHub, Event: "push", Fixture: "push.json", Secret: "secret"},
+			parse: func(r *http.Request) error {
+				_, err := githubHook.Parse(r, github.PushEvent)
+				return err
+			},
+			event:   "push",
+			outcome: webhooks.OutcomeOK,
+		},
+		{
+			name:     "GitHubForged",
+			delivery: webhookstest.Delivery{Provider: webhooks.GitHub, Event: "push", Fixture: "push.json", Secret: "forged"},
+			parse: func(r *http.Request) error {
+				_, err := githubHook.Parse(r, github.PushEvent)
+				return err
+			},
+			event:   "push",
+			outcome: "hmac_verification_failed",
+		},
+		{
+			name:     "GitHubUnknownEvent",
+			delivery: webhookstest.Delivery{Provider: webhooks.GitHub, Event: "made_up", Fixture: "push.json", Secret: "secret"},
+			parse: func(r *http.Request) error {
+				_, err := githubHook.ParseAny(r)
+				return err
+			},
+			event:   webhooks.UnknownEvent,
+			outcome: "event_not_found",
+		},
+		{
+			name:     "GitLabToken",
+			delivery: webhookstest.Delivery{Provider: webhooks.GitLab, Event: string(gitlab.PushEvents), Fixture: "push-event.json", Secret: "forged"},
+			parse: func(r *http.Request) error {
+				_, err := gitlabHook.ParseDelivery(r, gitlab.PushEvents)
+				return err
+			},
+			event:   string(gitlab.PushEvents),
+			outcome: "gitlab_token_verification_failed",
+		},
+		{
+			name:     "GitLabMissingEvent",
+			delivery: webhookstest.Delivery{Provider: webhooks.GitLab, Fixture: "push-event.json", Secret: "secret"},
+			parse: func(r *http.Request) error {
+				_, err := gitlabHook.ParseDelivery(r, gitlab.PushEvents)
+				return err
+			},
+			event:   webhooks.UnknownEvent,
+			outcome: "missing_gitlab_event_header",
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := webhookstest.NewRequest(tc.delivery)
+			assert.NoError(err)
+			err = tc.parse(req)
+			assert.Equal(tc.outcome == webhooks.OutcomeOK, err == nil)
+			assert.Equal(uint64(1), collector.Deliveries(tc.delivery.Provider, tc.event, tc.outcome))
+		})
+	}
+
+	payload, err := webhookstest.Fixture(webhooks.GitHub, "push.json")
+	assert.NoError(err)
+	_, err = githubHook.ParseBytes(http.Header{"X-Github-Event": []string{"push"}}, []byte("{"), github.PushEvent)
+	assert.Error(err)
+	assert.Equal(uint64(1), collector.Deliveries(webhooks.GitHub, "push", "missing_hub_signature_header"))
+
+	w := httptest.NewRecorder()
+	collector.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(ContentType, w.Header().Get("Content-Type"))
+	body := w.Body.String()
+	for _, line := range []string{
+		"# TYPE webhooks_deliveries_total counter",
+		`webhooks_deliveries_total{provider="github",event="push",outcome="ok"} 1`,
+		`webhooks_deliveries_total{provider="github",event="unknown",outcome="event_not_found"} 1`,
+		`webhooks_deliveries_total{provider="gitlab",event="Push Hook",outcome="gitlab_token_verification_failed"} 1`,
+		`webhooks_deliveries_total{provider="gitlab",event="unknown",outcome="missing_gitlab_event_header"} 1`,
+		"# TYPE webhooks_parse_duration_seconds histogram",
+		`webhooks_parse_duration_seconds_count{provider="github",event="push"} 3`,
+		`webhooks_body_size_bytes_bucket{provider="github",event="push",le="+Inf"} 3`,
+		`webhooks_body_size_bytes_bucket{provider="github",event="push",le="1024"} 1`,
+		`webhooks_body_size_bytes_sum{provider="github",event="push"} ` + formatFloat(float64(2*len(payload)+1)),
+	} {
+		assert.Contains(body, line+"\n")
+	}
+	assert.True(strings.Index(body, `provider="github",event="push",outcome="hmac_verification_failed"`) <
+		strings.Index(body, `provider="github",event="push",outcome="missing_hub_signature_header"`))
+}
+
+func TestCollectorDrift(t *testing.T) {
+	assert := require.New(t)
+	collector, err := New()
+	assert.NoError(err)
+	hook, err := gitlab.New(gitlab.Options.Strict(collector))
+	assert.NoError(err)
+
+	headers := http.Header{"X-Gitlab-Event": []string{string(gitlab.PushEvents)}}
+	_, err = hook.ParseBytes(headers, []byte(`{"object_kind": "push", "made_up": true}`), gitlab.PushEvents)
+	assert.NoError(err)
+	_, err = hook.ParseBytes(headers, []byte(`{"object_kind": "push"}`), gitlab.PushEvents)
+	assert.NoError(err)
+	assert.Equal(uint64(1), collector.Drifts(webhooks.GitLab, string(gitlab.PushEvents), DriftUnknown))
+	assert.Equal(uint64(2), collector.Drifts(webhooks.GitLab, string(gitlab.PushEvents), DriftMissing))
+
+	w := httptest.NewRecorder()
+	collector.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+	for _, line := range []string{
+		"# TYPE webhooks_payload_drift_total counter",
+		`webhooks_payload_drift_total{provider="gitlab",event="Push Hook",kind="missing"} 2`,
+		`webhooks_payload_drift_total{provider="gitlab",event="Push Hook",kind="unknown"} 1`,
+	} {
+		assert.Contains(body, line+"\n")
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	assert := require.New(t)
+	collector, err := New(Options.DurationBuckets(0.5, 1), Options.SizeBuckets(10))
+	assert.NoError(err)
+
+	for _, d := range []time.Duration{100 * time.Millisecond, 700 * time.Millisecond, 2 * time.Second} {
+		collector.ObserveParse(webhooks.ParseObservation{Provider: webhooks.Gitea, Event: "push", Outcome: webhooks.OutcomeOK, Size: 20, Duration: d})
+	}
+
+	var b strings.Builder
+	n, err := collector.WriteTo(&b)
+	assert.NoError(err)
+	assert.Equal(int64(b.Len()), n)
+	assert.Contains(b.String(), `webhooks_parse_duration_seconds_bucket{provider="gitea",event="push",le="0.5"} 1
+webhooks_parse_duration_seconds_bucket{provider="gitea",event="push",le="1"} 2
+webhooks_parse_duration_seconds_bucket{provider="gitea",event="push",le="+Inf"} 3
+webhooks_parse_duration_seconds_sum{provider="gitea",event="push"} 2.8
+webhooks_parse_duration_seconds_count{provider="gitea",event="push"} 3
+`)
+	assert.Contains(b.String(), `webhooks_body_size_bytes_bucket{provider="gitea",event="push",le="10"} 0`)
+
+	_, err = New(Options.DurationBuckets())
+	assert.Equal(ErrInvalidBuckets, err)
+	_, err = New(Options.SizeBuckets(2, 1))
+	assert.Equal(ErrInvalidBuckets, err)
+}
+
+func TestQuote(t *testing.T) {
+	assert := require.New(t)
+	assert.Equal(`"a\"b\\c\nd"`, quote("a\"b\\c\nd"))
+}
@@ -0,0 +1,189 @@
+package webhooks
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// normalization errors
+var (
+	ErrNotNormalizable = errors.New("payload can't be normalized")
+)
+
+// EventKind defines the kind of a normalized event
+type EventKind string
+
+// Normalized event kinds
+const (
+	PushKind        EventKind = "push"
+	PullRequestKind EventKind = "pull_request"
+	IssueKind       EventKind = "issue"
+	TagKind         EventKind = "tag"
+	ReleaseKind     EventKind = "release"
+)
+
+// Normalized actions, providers actions that can't be mapped are kept as sent
+const (
+	ActionOpened    = "opened"
+	ActionClosed    = "closed"
+	ActionReopened  = "reopened"
+	ActionMerged    = "merged"
+	ActionUpdated   = "updated"
+	ActionCreated   = "created"
+	ActionDeleted   = "deleted"
+	ActionPublished = "published"
+)
+
+// NormalizedEvent is implemented by every normalized event type, the converters
+// of the provider packages return them so business logic can be written once
+type NormalizedEvent interface {
+	// Kind returns the kind of the normalized event
+	Kind() EventKind
+}
+
+// NormalizedRepository is the provider agnostic repository information
+type NormalizedRepository struct {
+	Name          string `json:"name"`
+	FullName      string `json:"full_name"`
+	HTMLURL       string `json:"html_url"`
+	CloneURL      string `json:"clone_url"`
+	DefaultBranch string `json:"default_branch"`
+	Private       bool   `json:"private"`
+}
+
+// NormalizedUser is the provider agnostic user or commit author information
+type NormalizedUser struct {
+	Login string `json:"login"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// NormalizedCommit is the provider agnostic commit information
+type NormalizedCommit struct {
+	ID        string         `json:"id"`
+	Message   string         `json:"message"`
+	URL       string         `json:"url"`
+	Timestamp time.Time      `json:"timestamp"`
+	Author    NormalizedUser `json:"author"`
+	Added     []string       `json:"added"`
+	Modified  []string       `json:"modified"`
+	Removed   []string       `json:"removed"`
+}
+
+// NormalizedPush is a ref update, Ref is always the fully qualified reference
+// (e.g. refs/heads/main)
+type NormalizedPush struct {
+	Provider   ProviderName         `json:"provider"`
+	Repository NormalizedRepository `json:"repository"`
+	Ref        string               `json:"ref"`
+	Before     string               `json:"before"`
+	After      string               `json:"after"`
+	Created    bool                 `json:"created"`
+	Deleted    bool                 `json:"deleted"`
+	Forced     bool                 `json:"forced"`
+	CompareURL string               `json:"compare_url"`
+	Commits    []NormalizedCommit   `json:"commits"`
+	Sender     NormalizedUser       `json:"sender"`
+}
+
+// Kind returns PushKind
+func (NormalizedPush) Kind() EventKind {
+	return PushKind
+}
+
+// Branch returns the branch name of the pushed ref or an empty string if it isn't a branch
+func (p NormalizedPush) Branch() string {
+	if !strings.HasPrefix(p.Ref, "refs/heads/") {
+		return ""
+	}
+	return strings.TrimPrefix(p.Ref, "refs/heads/")
+}
+
+// Tag returns the tag name of the pushed ref or an empty string if it isn't a tag
+func (p NormalizedPush) Tag() string {
+	if !strings.HasPrefix(p.Ref, "refs/tags/") {
+		return ""
+	}
+	return strings.TrimPrefix(p.Ref, "refs/tags/")
+}
+
+// NormalizedPullRequest is a pull or merge request event
+type NormalizedPullRequest struct {
+	Provider     ProviderName         `json:"provider"`
+	Repository   NormalizedRepository `json:"repository"`
+	Action       string               `json:"action"`
+	Number       int64                `json:"number"`
+	Title        string               `json:"title"`
+	Body         string               `json:"body"`
+	HTMLURL      string               `json:"html_url"`
+	State        string               `json:"state"`
+	Merged       bool                 `json:"merged"`
+	Draft        bool                 `json:"draft"`
+	SourceBranch string               `json:"source_branch"`
+	TargetBranch string               `json:"target_branch"`
+	HeadSHA      string               `json:"head_sha"`
+	Labels       []string             `json:"labels"`
+	Author       NormalizedUser       `json:"author"`
+	Sender       NormalizedUser       `json:"sender"`
+}
+
+// Kind returns PullRequestKind
+func (NormalizedPullRequest) Kind() EventKind {
+	return PullRequestKind
+}
+
+// NormalizedIssue is an issue event
+type NormalizedIssue struct {
+	Provider   ProviderName         `json:"provider"`
+	Repository NormalizedRepository `json:"repository"`
+	Action     string               `json:"action"`
+	Number     int64                `json:"number"`
+	Title      string               `json:"title"`
+	Body       string               `json:"body"`
+	HTMLURL    string               `json:"html_url"`
+	State      string               `json:"state"`
+	Labels     []string             `json:"labels"`
+	Author     NormalizedUser       `json:"author"`
+	Sender     NormalizedUser       `json:"sender"`
+}
+
+// Kind returns IssueKind
+func (NormalizedIssue) Kind() EventKind {
+	return IssueKind
+}
+
+// NormalizedTag is a tag creation or deletion event
+type NormalizedTag struct {
+	Provider   ProviderName         `json:"provider"`
+	Repository NormalizedRepository `json:"repository"`
+	Action     string               `json:"action"`
+	Name       string               `json:"name"`
+	SHA        string               `json:"sha"`
+	Sender     NormalizedUser       `json:"sender"`
+}
+
+// Kind returns TagKind
+func (NormalizedTag) Kind() EventKind {
+	return TagKind
+}
+
+// NormalizedRelease is a release event
+type NormalizedRelease struct {
+	Provider   ProviderName         `json:"provider"`
+	Repository NormalizedRepository `json:"repository"`
+	Action     string               `json:"action"`
+	TagName    string               `json:"tag_name"`
+	Name       string               `json:"name"`
+	Body       string               `json:"body"`
+	HTMLURL    string               `json:"html_url"`
+	Draft      bool                 `json:"draft"`
+	Prerelease bool                 `json:"prerelease"`
+	Author     NormalizedUser       `json:"author"`
+	Sender     NormalizedUser       `json:"sender"`
+}
+
+// Kind returns ReleaseKind
+func (NormalizedRelease) Kind() EventKind {
+	return ReleaseKind
+}
@@ -0,0 +1,368 @@
+// Package notify renders deliveries into chat messages and posts them to Slack
+// compatible, Matrix and Microsoft Teams incoming webhooks
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+	"github.com/heitormejias/golang-webhooks/bitbucket"
+	bitbucketserver "github.com/heitormejias/golang-webhooks/bitbucket-server"
+	"github.com/heitormejias/golang-webhooks/gitea"
+	"github.com/heitormejias/golang-webhooks/github"
+	"github.com/heitormejias/golang-webhooks/gitlab"
+	"github.com/heitormejias/golang-webhooks/gogs"
+	"github.com/heitormejias/golang-webhooks/sender"
+)
+
+// notify errors
+var (
+	ErrNoTargets      = errors.New("no targets")
+	ErrInvalidTarget  = errors.New("target must have a name and URL")
+	ErrUnknownFormat  = errors.New("unknown message format")
+	ErrNoTemplate     = errors.New("no template for the delivery")
+	ErrInvalidPayload = errors.New("delivery has no parsed payload")
+)
+
+// Format is the message format of an incoming webhook
+type Format string
+
+// Message formats
+const (
+	// Slack posts {"text": ...} with Slack mrkdwn links, Mattermost and
+	// Rocket.Chat accept it too
+	Slack Format = "slack"
+	// Matrix posts {"text": ...} with Markdown links, the format of the generic
+	// webhooks of matrix-hookshot
+	Matrix Format = "matrix"
+	// Teams posts a MessageCard with Markdown links
+	Teams Format = "teams"
+)
+
+var formats = map[Format]bool{Slack: true, Matrix: true, Teams: true}
+
+// normalizers are the Normalize functions of the supported providers
+var normalizers = map[webhooks.ProviderName]func(payload interface{}) ([]webhooks.NormalizedEvent, error){
+	webhooks.GitHub:          github.Normalize,
+	webhooks.GitLab:          gitlab.Normalize,
+	webhooks.Gitea:           gitea.Normalize,
+	webhooks.Gogs:            gogs.Normalize,
+	webhooks.Bitbucket:       bitbucket.Normalize,
+	webhooks.BitbucketServer: bitbucketserver.Normalize,
+}
+
+// Target is an incoming webhook the messages are posted to
+type Target struct {
+	// Name identifies the target in errors, the URL of incoming webhooks is a secret
+	Name   string
+	URL    string
+	Format Format
+}
+
+// Option is a configuration option for the notifier
+type Option func(*Notifier) error
+
+// Options is a namespace var for configuration options
+var Options = NotifierOptions{}
+
+// NotifierOptions is a namespace for configuration option methods
+type NotifierOptions struct{}
+
+// Template registers the template of an event of a provider, executed on the
+// parsed payload, e.g. {{ .Project.PathWithNamespace }} for GitLab. It takes
+// precedence over the templates of the normalized events
+func (NotifierOptions) Template(provider webhooks.ProviderName, event, text string) Option {
+	return func(n *Notifier) error {
+		n.texts[eventName(provider, event)] = text
+		return nil
+	}
+}
+
+// FormatTemplate registers the template of an event of a provider for the
+// targets of the format only, it takes precedence over Template
+func (NotifierOptions) FormatTemplate(format Format, provider webhooks.ProviderName, event, text string) Option {
+	return func(n *Notifier) error {
+		if !formats[format] {
+			return fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+		}
+		if n.formatTexts[format] == nil {
+			n.formatTexts[format] = make(map[string]string)
+		}
+		n.formatTexts[format][eventName(provider, event)] = text
+		return nil
+	}
+}
+
+// KindTemplate registers the template of a normalized event kind, executed on
+// the normalized event whatever the provider, e.g. {{ .Repository.FullName }}
+func (NotifierOptions) KindTemplate(kind webhooks.EventKind, text string) Option {
+	return func(n *Notifier) error {
+		n.texts[string(kind)] = text
+		return nil
+	}
+}
+
+// Client registers the client posting the messages, a sender.Client with the
+// default retry policy is used by default
+func (NotifierOptions) Client(client *sender.Client) Option {
+	return func(n *Notifier) error {
+		n.client = client
+		return nil
+	}
+}
+
+// Notifier renders the deliveries with the template of their event, or the
+// template of the kind of their normalized events, and posts the messages to the
+// targets. Every kind has a default template, as have the pipeline events of
+// GitHub (workflow_run), GitLab (Pipeline Hook) and Bitbucket
+// (repo:commit_status_updated). Deliveries without template or rendering blank
+// messages are not notified, so templates can skip deliveries with {{ if }}.
+//
+// The templates can call:
+//
+//	link text url  a link in the format of the target, the text when url is empty
+//	bold text      bold text in the format of the target
+//	short sha      the 7 first characters of a commit SHA
+//	firstLine s    the first line of a commit message
+//	user u         the login of a webhooks.NormalizedUser, the name without login
+//	join list sep  strings.Join
+//
+// The values printed by the Slack templates are escaped, so payload fields can't
+// inject Slack markup. Its Notify method is an async.HandlerFunc.
+type Notifier struct {
+	targets []Target
+	client  *sender.Client
+	// texts are the templates by eventName or kind, formatTexts the ones of a
+	// format only
+	texts       map[string]string
+	formatTexts map[Format]map[string]string
+	templates   map[Format]*template.Template
+}
+
+// New creates and returns a Notifier posting to the targets
+func New(targets []Target, options ...Option) (*Notifier, error) {
+	if len(targets) == 0 {
+		return nil, ErrNoTargets
+	}
+	for _, target := range targets {
+		if target.Name == "" || target.URL == "" {
+			return nil, ErrInvalidTarget
+		}
+		if !formats[target.Format] {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, target.Format)
+		}
+	}
+
+	n := &Notifier{
+		targets:     targets,
+		texts:       make(map[string]string, len(defaults)),
+		formatTexts: make(map[Format]map[string]string),
+		templates:   make(map[Format]*template.Template, len(formats)),
+	}
+	for name, text := range defaults {
+		n.texts[name] = text
+	}
+	for _, opt := range options {
+		if err := opt(n); err != nil {
+			return nil, err
+		}
+	}
+	if n.client == nil {
+		client, err := sender.New()
+		if err != nil {
+			return nil, err
+		}
+		n.client = client
+	}
+
+	for format := range formats {
+		root := template.New("").Option("missingkey=error").Funcs(funcs(format))
+		texts := make(map[string]string, len(n.texts)+len(n.formatTexts[format]))
+		for name, text := range n.texts {
+			texts[name] = text
+		}
+		for name, text := range n.formatTexts[format] {
+			texts[name] = text
+		}
+		for name, text := range texts {
+			if _, err := root.New(name).Parse(text); err != nil {
+				return nil, err
+			}
+		}
+		if format == Slack {
+			for _, tmpl := range root.Templates() {
+				if tmpl.Tree != nil {
+					escapeActions(tmpl.Tree, tmpl.Tree.Root)
+				}
+			}
+		}
+		n.templates[format] = root
+	}
+	return n, nil
+}
+
+func eventName(provider webhooks.ProviderName, event string) string {
+	return string(provider) + " " + event
+}
+
+// Render returns the messages of the delivery in the format, one per normalized
+// event or a single one when the event has its own template. ErrNoTemplate is
+// returned when no template applies or they all rendered blank messages
+func (n *Notifier) Render(format Format, delivery *webhooks.Delivery) ([]string, error) {
+	return n.render(format, delivery, nil, true)
+}
+
+// RenderEvents is Render with the normalized events of the delivery given, e.g.
+// the ones selected by filters, rather than all of them
+func (n *Notifier) RenderEvents(format Format, delivery *webhooks.Delivery, events []webhooks.NormalizedEvent) ([]string, error) {
+	return n.render(format, delivery, events, false)
+}
+
+func (n *Notifier) render(format Format, delivery *webhooks.Delivery, events []webhooks.NormalizedEvent, normalize bool) ([]string, error) {
+	root, ok := n.templates[format]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+	if delivery.Payload == nil {
+		return nil, ErrInvalidPayload
+	}
+
+	var messages []string
+	if tmpl := root.Lookup(eventName(delivery.Provider, delivery.Event)); tmpl != nil {
+		msg, err := execute(tmpl, delivery.Payload)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	} else {
+		if normalizer, ok := normalizers[delivery.Provider]; ok && normalize {
+			var err error
+			events, err = normalizer(delivery.Payload)
+			if err != nil && !errors.Is(err, webhooks.ErrNotNormalizable) {
+				return nil, err
+			}
+		}
+		for _, event := range events {
+			tmpl := root.Lookup(string(event.Kind()))
+			if tmpl == nil {
+				continue
+			}
+			msg, err := execute(tmpl, event)
+			if err != nil {
+				return nil, err
+			}
+			messages = append(messages, msg)
+		}
+	}
+
+	kept := messages[:0]
+	for _, msg := range messages {
+		if strings.TrimSpace(msg) != "" {
+			kept = append(kept, msg)
+		}
+	}
+	if len(kept) == 0 {
+		return nil, ErrNoTemplate
+	}
+	return kept, nil
+}
+
+func execute(tmpl *template.Template, data interface{}) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Notify renders the delivery and posts its messages to every target, targets
+// without messages for the delivery are skipped
+func (n *Notifier) Notify(ctx context.Context, delivery *webhooks.Delivery) error {
+	return n.notify(ctx, delivery, nil, true)
+}
+
+// NotifyEvents is Notify with the normalized events of the delivery given, see RenderEvents
+func (n *Notifier) NotifyEvents(ctx context.Context, delivery *webhooks.Delivery, events []webhooks.NormalizedEvent) error {
+	return n.notify(ctx, delivery, events, false)
+}
+
+func (n *Notifier) notify(ctx context.Context, delivery *webhooks.Delivery, events []webhooks.NormalizedEvent, normalize bool) error {
+	failed := make(map[string]error)
+	for _, target := range n.targets {
+		messages, err := n.render(target.Format, delivery, events, normalize)
+		if errors.Is(err, ErrNoTemplate) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, msg := range messages {
+			if err := n.post(ctx, target, msg); err != nil {
+				failed[target.Name] = err
+				break
+			}
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(failed))
+	for name := range failed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msgs := make([]string, 0, len(names))
+	for _, name := range names {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", name, failed[name]))
+	}
+	return errors.New("notify failed: " + strings.Join(msgs, ", "))
+}
+
+func (n *Notifier) post(ctx context.Context, target Target, text string) error {
+	req, err := NewRequest(target.URL, target.Format, text)
+	if err != nil {
+		return err
+	}
+	_, err = n.client.Send(ctx, req)
+	return err
+}
+
+// NewRequest builds the request posting the message to an incoming webhook of the format
+func NewRequest(url string, format Format, text string) (*http.Request, error) {
+	var body interface{}
+	switch format {
+	case Slack, Matrix:
+		body = struct {
+			Text string `json:"text"`
+		}{text}
+	case Teams:
+		body = struct {
+			Type    string `json:"@type"`
+			Context string `json:"@context"`
+			Summary string `json:"summary"`
+			Text    string `json:"text"`
+		}{"MessageCard", "https://schema.org/extensions", firstLine(text), text}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
@@ -0,0 +1,263 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+	"github.com/heitormejias/golang-webhooks/github"
+	"github.com/heitormejias/golang-webhooks/sender"
+	"github.com/heitormejias/golang-webhooks/webhookstest"
+	"github.com/stretchr/testify/require"
+)
+
+func delivery(t *testing.T, d webhookstest.Delivery) *webhooks.Delivery {
+	t.Helper()
+	payload, err := webhookstest.Parse(d)
+	require.NoError(t, err)
+	return &webhooks.Delivery{Provider: d.Provider, ID: "1", Event: d.Event, Payload: payload}
+}
+
+func TestNew(t *testing.T) {
+	assert := require.New(t)
+	slack := Target{Name: "slack", URL: "http://localhost/slack", Format: Slack}
+
+	tests := []struct {
+		name    string
+		targets []Target
+		options []Option
+		err     error
+	}{
+		{
+			name: "NoTargets",
+			err:  ErrNoTargets,
+		},
+		{
+			name:    "InvalidTarget",
+			targets: []Target{{URL: "http://localhost/slack", Format: Slack}},
+			err:     ErrInvalidTarget,
+		},
+		{
+			name:    "UnknownFormat",
+			targets: []Target{{Name: "irc", URL: "http://localhost/irc", Format: "irc"}},
+			err:     ErrUnknownFormat,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tc.targets, tc.options...)
+			assert.True(errors.Is(err, tc.err), "expected %v, got %v", tc.err, err)
+		})
+	}
+
+	_, err := New([]Target{slack}, Options.KindTemplate(webhooks.PushKind, "{{ .Ref "))
+	assert.Error(err)
+	_, err = New([]Target{slack}, Options.KindTemplate(webhooks.PushKind, "{{ unknown .Ref }}"))
+	assert.Error(err)
+}
+
+func TestRender(t *testing.T) {
+	assert := require.New(t)
+
+	n, err := New([]Target{{Name: "slack", URL: "http://localhost/slack", Format: Slack}})
+	assert.NoError(err)
+
+	tests := []struct {
+		name     string
+		delivery webhookstest.Delivery
+		format   Format
+		expected []string
+	}{
+		{
+			name:     "GitHubPush",
+			delivery: webhookstest.Delivery{Provider: webhooks.GitHub, Event: "push", Fixture: "push.json"},
+			format:   Slack,
+			expected: []string{"binkkatal pushed 1 commit(s) to <https://github.com/binkkatal/sample_app/compare/737d38c599c1...fd489864e764|master>" +
+				" in <https://github.com/binkkatal/sample_app|binkkatal/sample_app>\n" +
+				"• <https://github.com/binkkatal/sample_app/commit/fd489864e7642b48eaad6e3f155c10e46810ec72|fd48986> test a push event - binkkatal"},
+		},
+		{
+			name:     "GitHubPushMarkdown",
+			delivery: webhookstest.Delivery{Provider: webhooks.GitHub, Event: "push", Fixture: "push.json"},
+			format:   Teams,
+			expected: []string{"binkkatal pushed 1 commit(s) to [master](https://github.com/binkkatal/sample_app/compare/737d38c599c1...fd489864e764)" +
+				" in [binkkatal/sample_app](https://github.com/binkkatal/sample_app)\n" +
+				"• [fd48986](https://github.com/binkkatal/sample_app/commit/fd489864e7642b48eaad6e3f155c10e46810ec72) test a push event - binkkatal"},
+		},
+		{
+			name:     "GitLabMergeRequest",
+			delivery: webhookstest.Delivery{Provider: webhooks.GitLab, Event: "Merge Request Hook", Fixture: "merge-request-event.json"},
+			format:   Matrix,
+			expected: []string{"root opened pull request [#1 MS-Viewport](http://example.com/diaspora/merge_requests/1) (ms-viewport → master)" +
+				" in [gitlabhq/gitlab-test](http://example.com/gitlabhq/gitlab-test)"},
+		},
+		{
+			name:     "GitLabPipeline",
+			delivery: webhookstest.Delivery{Provider: webhooks.GitLab, Event: "Pipeline Hook", Fixture: "pipeline-event.json"},
+			format:   Slack,
+			expected: []string{"Pipeline <http://192.168.64.1:3005/gitlab-org/gitlab-test/-/pipelines/31|#31> *success* on master" +
+				" in <http://192.168.64.1:3005/gitlab-org/gitlab-test|gitlab-org/gitlab-test>"},
+		},
+		{
+			name:     "GitLabTag",
+			delivery: webhookstest.Delivery{Provider: webhooks.GitLab, Event: "Tag Push Hook", Fixture: "tag-event.json"},
+			format:   Teams,
+			expected: []string{"John Smith created tag **v1.0.0** in [jsmith/example](http://example.com/jsmith/example)"},
+		},
+		{
+			name:     "BitbucketCommitStatus",
+			delivery: webhookstest.Delivery{Provider: webhooks.Bitbucket, Event: "repo:commit_status_updated", Fixture: "repo-commit-status-updated.json"},
+			format:   Slack,
+			expected: []string{"<https://my-build-tool.com/builds/MY-PROJECT/BUILD-792|Unit Tests (Python)> *SUCCESSFUL*" +
+				" in <https://api.bitbucket.org/bitbucket/bitbucket|team_name/repo_name>"},
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			messages, err := n.Render(tc.format, delivery(t, tc.delivery))
+			assert.NoError(err)
+			assert.Equal(tc.expected, messages)
+		})
+	}
+
+	for _, d := range []webhookstest.Delivery{
+		{Provider: webhooks.BitbucketServer, Event: "pr:opened", Fixture: "pr-opened.json"},
+		{Provider: webhooks.Gitea, Event: "push", Fixture: "push-event.json"},
+	} {
+		messages, err := n.Render(Slack, delivery(t, d))
+		assert.NoError(err, d.String())
+		assert.Len(messages, 1, d.String())
+	}
+
+	// only the given normalized events are rendered
+	push := delivery(t, webhookstest.Delivery{Provider: webhooks.GitHub, Event: "push", Fixture: "push.json"})
+	events, err := github.Normalize(push.Payload)
+	assert.NoError(err)
+	messages, err := n.RenderEvents(Slack, push, events)
+	assert.NoError(err)
+	assert.Equal(tests[0].expected, messages)
+	_, err = n.RenderEvents(Slack, push, nil)
+	assert.True(errors.Is(err, ErrNoTemplate))
+
+	// events without normalized form nor template aren't notified
+	_, err = n.Render(Slack, delivery(t, webhookstest.Delivery{Provider: webhooks.GitHub, Event: "ping", Fixture: "ping.json"}))
+	assert.True(errors.Is(err, ErrNoTemplate))
+	_, err = n.Render("irc", delivery(t, webhookstest.Delivery{Provider: webhooks.GitHub, Event: "push", Fixture: "push.json"}))
+	assert.True(errors.Is(err, ErrUnknownFormat))
+	_, err = n.Render(Slack, &webhooks.Delivery{Provider: webhooks.GitHub, Event: "push"})
+	assert.True(errors.Is(err, ErrInvalidPayload))
+
+	n, err = New([]Target{{Name: "slack", URL: "http://localhost/slack", Format: Slack}},
+		Options.Template(webhooks.GitHub, "ping", "hook {{ .HookID }} pinged"),
+		Options.Template(webhooks.GitLab, "Pipeline Hook", `{{ if eq .ObjectAttributes.Status "failed" }}failed{{ end }}`),
+		Options.KindTemplate(webhooks.PushKind, "{{ bold .Ref }} by {{ user .Sender }}"),
+	)
+	assert.NoError(err)
+	messages, err = n.Render(Slack, delivery(t, webhookstest.Delivery{Provider: webhooks.GitHub, Event: "ping", Fixture: "ping.json"}))
+	assert.NoError(err)
+	assert.Equal([]string{"hook 20081052 pinged"}, messages)
+	messages, err = n.Render(Slack, delivery(t, webhookstest.Delivery{Provider: webhooks.GitLab, Event: "Push Hook", Fixture: "push-event.json"}))
+	assert.NoError(err)
+	assert.Equal([]string{"*refs/heads/master* by John Smith"}, messages)
+	_, err = n.Render(Slack, delivery(t, webhookstest.Delivery{Provider: webhooks.GitLab, Event: "Pipeline Hook", Fixture: "pipeline-event.json"}))
+	assert.True(errors.Is(err, ErrNoTemplate))
+
+	// payload fields can't inject Slack markup
+	n, err = New([]Target{{Name: "slack", URL: "http://localhost/slack", Format: Slack}},
+		Options.Template(webhooks.GitHub, "push", `<{{ .Compare }}|{{ .Ref }}> {{ bold .Ref }} {{ link .Ref .Compare }}{{ $ref := .Ref }}{{ with .Compare }} {{ $ref }}{{ end }}`),
+	)
+	assert.NoError(err)
+	push = &webhooks.Delivery{Provider: webhooks.GitHub, Event: "push", Payload: github.PushPayload{
+		Ref:     "<!channel> & <http://evil|x>",
+		Compare: "http://example.com/a>b",
+	}}
+	messages, err = n.Render(Slack, push)
+	assert.NoError(err)
+	const ref = "&lt;!channel&gt; &amp; &lt;http://evil|x&gt;"
+	assert.Equal([]string{"<http://example.com/a&gt;b|" + ref + "> *" + ref + "* <http://example.com/a&gt;b|" + ref + "> " + ref}, messages)
+	messages, err = n.Render(Teams, push)
+	assert.NoError(err)
+	assert.Equal([]string{"<http://example.com/a>b|<!channel> & <http://evil|x>> **<!channel> & <http://evil|x>** [<!channel> & <http://evil|x>](http://example.com/a>b) <!channel> & <http://evil|x>"}, messages)
+}
+
+func TestNotify(t *testing.T) {
+	assert := require.New(t)
+
+	var mu sync.Mutex
+	received := make(map[string]string)
+	chat := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		received[r.URL.Path] = string(body)
+		mu.Unlock()
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer chat.Close()
+
+	client, err := sender.New(sender.Options.MaxAttempts(1))
+	assert.NoError(err)
+	n, err := New([]Target{
+		{Name: "slack", URL: chat.URL + "/slack", Format: Slack},
+		{Name: "matrix", URL: chat.URL + "/matrix", Format: Matrix},
+		{Name: "teams", URL: chat.URL + "/teams", Format: Teams},
+	}, Options.Client(client), Options.KindTemplate(webhooks.TagKind, "{{ link .Name .Repository.HTMLURL }}\n{{ user .Sender }}"))
+	assert.NoError(err)
+
+	d := delivery(t, webhookstest.Delivery{Provider: webhooks.GitLab, Event: "Tag Push Hook", Fixture: "tag-event.json"})
+	assert.NoError(n.Notify(context.Background(), d))
+	assert.JSONEq(`{"text": "<http://example.com/jsmith/example|v1.0.0>\nJohn Smith"}`, received["/slack"])
+	assert.JSONEq(`{"text": "[v1.0.0](http://example.com/jsmith/example)\nJohn Smith"}`, received["/matrix"])
+	var card map[string]string
+	assert.NoError(json.Unmarshal([]byte(received["/teams"]), &card))
+	assert.Equal(map[string]string{
+		"@type":    "MessageCard",
+		"@context": "https://schema.org/extensions",
+		"summary":  "[v1.0.0](http://example.com/jsmith/example)",
+		"text":     "[v1.0.0](http://example.com/jsmith/example)\nJohn Smith",
+	}, card)
+
+	// deliveries without message aren't posted
+	received = make(map[string]string)
+	assert.NoError(n.Notify(context.Background(), delivery(t, webhookstest.Delivery{Provider: webhooks.GitHub, Event: "ping", Fixture: "ping.json"})))
+	assert.Empty(received)
+
+	// targets without message don't stop the next ones
+	n, err = New([]Target{
+		{Name: "slack", URL: chat.URL + "/slack", Format: Slack},
+		{Name: "matrix", URL: chat.URL + "/matrix", Format: Matrix},
+	}, Options.Client(client), Options.FormatTemplate(Matrix, webhooks.GitHub, "ping", "hook {{ .HookID }} pinged"))
+	assert.NoError(err)
+	assert.NoError(n.Notify(context.Background(), delivery(t, webhookstest.Delivery{Provider: webhooks.GitHub, Event: "ping", Fixture: "ping.json"})))
+	assert.Equal(map[string]string{"/matrix": `{"text":"hook 20081052 pinged"}`}, received)
+	_, err = New([]Target{{Name: "slack", URL: chat.URL + "/slack", Format: Slack}}, Options.FormatTemplate("irc", webhooks.GitHub, "ping", "pinged"))
+	assert.True(errors.Is(err, ErrUnknownFormat))
+
+	received = make(map[string]string)
+	n, err = New([]Target{
+		{Name: "down", URL: chat.URL + "/down", Format: Slack},
+		{Name: "slack", URL: chat.URL + "/slack", Format: Slack},
+	}, Options.Client(client))
+	assert.NoError(err)
+	err = n.Notify(context.Background(), d)
+	assert.Error(err)
+	assert.Contains(err.Error(), "notify failed: down: ")
+	paths := make([]string, 0, len(received))
+	for path := range received {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	assert.Equal([]string{"/down", "/slack"}, paths)
+}
@@ -0,0 +1,138 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+	"github.com/heitormejias/golang-webhooks/bitbucket"
+	"github.com/heitormejias/golang-webhooks/github"
+	"github.com/heitormejias/golang-webhooks/gitlab"
+)
+
+const repository = `{{ link .Repository.FullName .Repository.HTMLURL }}`
+
+// defaults are the default templates by kind or eventName
+var defaults = map[string]string{
+	string(webhooks.PushKind): `{{ if .Deleted }}{{ user .Sender }} deleted {{ or .Branch .Tag .Ref }} in ` + repository +
+		`{{ else }}{{ user .Sender }} pushed {{ len .Commits }} commit(s) to {{ link (or .Branch .Tag .Ref) .CompareURL }} in ` + repository +
+		`{{ range .Commits }}` + "\n" + `• {{ link (short .ID) .URL }} {{ firstLine .Message }} - {{ or .Author.Name .Author.Login }}{{ end }}{{ end }}`,
+
+	string(webhooks.PullRequestKind): `{{ user .Sender }} {{ .Action }} pull request {{ link (printf "#%d %s" .Number .Title) .HTMLURL }}` +
+		` ({{ .SourceBranch }} → {{ .TargetBranch }}) in ` + repository,
+
+	string(webhooks.IssueKind): `{{ user .Sender }} {{ .Action }} issue {{ link (printf "#%d %s" .Number .Title) .HTMLURL }} in ` + repository,
+
+	string(webhooks.TagKind): `{{ user .Sender }} {{ .Action }} tag {{ bold .Name }} in ` + repository,
+
+	string(webhooks.ReleaseKind): `{{ user .Sender }} {{ .Action }} release {{ link (or .Name .TagName) .HTMLURL }} in ` + repository,
+
+	eventName(webhooks.GitHub, string(github.WorkflowRunEvent)): `{{ if eq .Action "completed" }}{{ with .WorkflowRun }}` +
+		`Workflow {{ link .Name .HTMLURL }} {{ bold .Conclusion }} on {{ .HeadBranch }}{{ end }} in ` + repository + `{{ end }}`,
+
+	eventName(webhooks.GitLab, string(gitlab.PipelineEvents)): `{{ with .ObjectAttributes }}` +
+		`{{ if or (eq .Status "success") (eq .Status "failed") (eq .Status "canceled") }}` +
+		`Pipeline {{ link (printf "#%d" .ID) (printf "%s/-/pipelines/%d" $.Project.WebURL .ID) }} {{ bold .Status }} on {{ .Ref }}` +
+		` in {{ link $.Project.PathWithNamespace $.Project.WebURL }}{{ end }}{{ end }}`,
+
+	eventName(webhooks.Bitbucket, string(bitbucket.RepoCommitStatusUpdatedEvent)): `{{ with .CommitStatus }}` +
+		`{{ link .Name .URL }} {{ bold .State }}{{ end }} in {{ link .Repository.FullName .Repository.Links.HTML.Href }}`,
+}
+
+// funcs are the functions of the templates rendering messages in the format
+func funcs(format Format) template.FuncMap {
+	fm := template.FuncMap{
+		"link": func(text, url string) string {
+			if url == "" {
+				return text
+			}
+			return "[" + text + "](" + url + ")"
+		},
+		"bold": func(text string) string {
+			return "**" + text + "**"
+		},
+		"short": func(sha string) string {
+			if len(sha) > 7 {
+				return sha[:7]
+			}
+			return sha
+		},
+		"firstLine": firstLine,
+		"user": func(u webhooks.NormalizedUser) string {
+			if u.Login != "" {
+				return u.Login
+			}
+			return u.Name
+		},
+		"join": strings.Join,
+	}
+	if format == Slack {
+		fm["link"] = func(text, url string) slackText {
+			if url == "" {
+				return slackText(slackEscaper.Replace(text))
+			}
+			return slackText("<" + slackEscaper.Replace(url) + "|" + slackEscaper.Replace(text) + ">")
+		}
+		fm["bold"] = func(text string) slackText {
+			return slackText("*" + slackEscaper.Replace(text) + "*")
+		}
+		fm[slackEscapeFunc] = slackEscape
+	}
+	return fm
+}
+
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// slackText is Slack markup built by link and bold, it isn't escaped again
+type slackText string
+
+// slackEscapeFunc is the function escaping the output of the Slack templates
+const slackEscapeFunc = "slackEscape"
+
+// slackEscape escapes the values printed by the Slack templates so payload
+// fields can't inject links or mentions such as <!channel>
+func slackEscape(v interface{}) slackText {
+	if text, ok := v.(slackText); ok {
+		return text
+	}
+	return slackText(slackEscaper.Replace(fmt.Sprint(v)))
+}
+
+// escapeActions pipes the value printed by every action of the tree to
+// slackEscape, the text of the template itself is left as is
+func escapeActions(tree *parse.Tree, node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			escapeActions(tree, child)
+		}
+	case *parse.ActionNode:
+		// assignments print nothing
+		if len(n.Pipe.Decl) > 0 {
+			return
+		}
+		escape := parse.NewIdentifier(slackEscapeFunc).SetTree(tree).SetPos(n.Pos)
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{NodeType: parse.NodeCommand, Pos: n.Pos, Args: []parse.Node{escape}})
+	case *parse.IfNode:
+		escapeActions(tree, n.List)
+		escapeActions(tree, n.ElseList)
+	case *parse.RangeNode:
+		escapeActions(tree, n.List)
+		escapeActions(tree, n.ElseList)
+	case *parse.WithNode:
+		escapeActions(tree, n.List)
+		escapeActions(tree, n.ElseList)
+	}
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
@@ -0,0 +1,90 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+)
+
+// Outcomes reported for deliveries that are not described by a provider error, and
+// the one every provider reports for the events it wasn't asked to parse
+const (
+	OutcomeOK              = "ok"
+	OutcomeEventNotFound   = "event_not_found"
+	OutcomeSecretLookup    = "secret_lookup_failed"
+	OutcomePayloadTooLarge = "payload_too_large"
+	OutcomeInvalidJSON     = "invalid_json"
+	OutcomeError           = "error"
+)
+
+// UnknownEvent is the event reported for deliveries of events the provider doesn't know
+const UnknownEvent = "unknown"
+
+// ParseObservation describes a delivery handed to a Parse method of a provider Webhook
+type ParseObservation struct {
+	Provider ProviderName
+	// Event is the event header value, UnknownEvent when the provider doesn't know it
+	Event string
+	// Outcome is OutcomeOK or the label of the error that rejected the delivery
+	Outcome string
+	// VerificationFailed reports whether the delivery was rejected by the secret
+	// verification of the provider, missing signature or token included
+	VerificationFailed bool
+	// Size is the body size in bytes, 0 when the body wasn't read
+	Size int
+	// Duration is the time spent in the Parse method, reading the body included
+	Duration time.Duration
+}
+
+// ParseObserver is notified of every delivery parsed by the provider Webhooks it
+// is registered with, it must be safe for concurrent use
+type ParseObserver interface {
+	ObserveParse(observation ParseObservation)
+}
+
+// ParseObserverFunc is an adapter allowing ordinary functions to be used as ParseObserver
+type ParseObserverFunc func(observation ParseObservation)
+
+// ObserveParse calls f(observation)
+func (f ParseObserverFunc) ObserveParse(observation ParseObservation) {
+	f(observation)
+}
+
+// Outcome returns the outcome label of a parse error, outcomes maps the error
+// sentinels of the provider onto their label. Errors that are neither a sentinel,
+// a secret lookup, a size limit or a JSON error are reported as OutcomeError
+func Outcome(err error, outcomes map[error]string) string {
+	if err == nil {
+		return OutcomeOK
+	}
+	for sentinel, outcome := range outcomes {
+		if errors.Is(err, sentinel) {
+			return outcome
+		}
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, ErrSecretLookup):
+		return OutcomeSecretLookup
+	case errors.Is(err, ErrPayloadTooLarge):
+		return OutcomePayloadTooLarge
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return OutcomeInvalidJSON
+	default:
+		return OutcomeError
+	}
+}
+
+// VerificationFailed reports whether a parse error is one of the verification
+// error sentinels of a provider
+func VerificationFailed(err error, sentinels []error) bool {
+	for _, sentinel := range sentinels {
+		if errors.Is(err, sentinel) {
+			return true
+		}
+	}
+	return false
+}
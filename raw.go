@@ -0,0 +1,25 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// RawEvent is the payload returned by the provider Webhooks in catch-all mode for
+// events that weren't specified to Parse or that the provider package doesn't
+// know yet. The delivery is verified like any other before its body is returned
+type RawEvent struct {
+	// Name is the value of the event header of the provider, e.g. "merge_group"
+	Name    string          `json:"name"`
+	Headers http.Header     `json:"headers"`
+	Body    json.RawMessage `json:"body"`
+}
+
+// NewRawEvent returns the RawEvent of a delivery, the body must be valid JSON
+func NewRawEvent(name string, headers http.Header, body []byte) (RawEvent, error) {
+	var raw json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return RawEvent{}, err
+	}
+	return RawEvent{Name: name, Headers: headers.Clone(), Body: raw}, nil
+}
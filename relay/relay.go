@@ -0,0 +1,266 @@
+// Package relay forwards verified deliveries to several downstream receivers,
+// re-signed with the secret of each receiver
+package relay
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+	bitbucketserver "github.com/heitormejias/golang-webhooks/bitbucket-server"
+	"github.com/heitormejias/golang-webhooks/gitea"
+	"github.com/heitormejias/golang-webhooks/github"
+	"github.com/heitormejias/golang-webhooks/gogs"
+	"github.com/heitormejias/golang-webhooks/sender"
+)
+
+// relay errors
+var (
+	ErrNoTargets     = errors.New("no targets")
+	ErrInvalidTarget = errors.New("target must have a name and URL")
+	ErrDuplicateName = errors.New("duplicate target name")
+)
+
+// ParseFunc verifies and parses a delivery, usually the ParseDelivery method of a provider Webhook
+type ParseFunc func(r *http.Request) (*webhooks.Delivery, error)
+
+// Target is a downstream receiver of the relayed deliveries
+type Target struct {
+	// Name identifies the target in errors
+	Name string
+	URL  string
+	// Secret re-signs the deliveries the way the provider signs them, it is the
+	// webhook UUID for Bitbucket. Deliveries are forwarded unsigned without secret
+	Secret string
+	// Client sends the deliveries with the retry and timeout policy of the target,
+	// a sender.Client with the default policy is used when nil
+	Client *sender.Client
+}
+
+// TargetError is returned when some targets failed to receive a delivery
+type TargetError struct {
+	// Errors are the errors of the failed targets by name
+	Errors map[string]error
+}
+
+// Error returns the error message
+func (e *TargetError) Error() string {
+	names := make([]string, 0, len(e.Errors))
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	msgs := make([]string, 0, len(names))
+	for _, name := range names {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", name, e.Errors[name]))
+	}
+	return "relay failed: " + strings.Join(msgs, ", ")
+}
+
+// Option is a configuration option for the relay
+type Option func(*Relay) error
+
+// Options is a namespace var for configuration options
+var Options = RelayOptions{}
+
+// RelayOptions is a namespace for configuration option methods
+type RelayOptions struct{}
+
+// StatusCode registers the function mapping parse errors onto HTTP status codes,
+// usually the StatusCode function of the provider package. By default parse errors
+// are answered with 400 Bad Request unless they are a webhooks.StatusError
+func (RelayOptions) StatusCode(fn func(err error) int) Option {
+	return func(relay *Relay) error {
+		relay.statusCode = fn
+		return nil
+	}
+}
+
+// Relay verifies the deliveries and forwards their original body and provider
+// headers to every target concurrently, delivery ID included so the targets can
+// deduplicate redeliveries. It implements http.Handler and its Forward method is
+// an async.HandlerFunc, to acknowledge deliveries before they are forwarded:
+//
+//	r, _ := relay.New(parse, targets)
+//	d, _ := async.New(async.ParseFunc(parse), r.Forward)
+//	http.Handle("/webhooks", d)
+type Relay struct {
+	parse      ParseFunc
+	targets    []Target
+	statusCode func(err error) int
+}
+
+// New creates and returns a Relay forwarding the deliveries parsed by parse to the targets
+func New(parse ParseFunc, targets []Target, options ...Option) (*Relay, error) {
+	if len(targets) == 0 {
+		return nil, ErrNoTargets
+	}
+
+	relay := &Relay{
+		parse:      parse,
+		targets:    make([]Target, 0, len(targets)),
+		statusCode: defaultStatusCode,
+	}
+	names := make(map[string]bool, len(targets))
+	for _, target := range targets {
+		if target.Name == "" || target.URL == "" {
+			return nil, ErrInvalidTarget
+		}
+		if names[target.Name] {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateName, target.Name)
+		}
+		names[target.Name] = true
+
+		if target.Client == nil {
+			client, err := sender.New()
+			if err != nil {
+				return nil, err
+			}
+			target.Client = client
+		}
+		relay.targets = append(relay.targets, target)
+	}
+
+	for _, opt := range options {
+		if err := opt(relay); err != nil {
+			return nil, err
+		}
+	}
+	return relay, nil
+}
+
+func defaultStatusCode(err error) int {
+	var statusErr *webhooks.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code
+	}
+	return http.StatusBadRequest
+}
+
+// ServeHTTP parses the delivery and forwards it, forwarded deliveries are answered
+// with 200 OK and deliveries some targets failed to receive with 502 Bad Gateway
+// so the provider may redeliver them
+func (relay *Relay) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	delivery, err := relay.parse(r)
+	if err != nil {
+		code := relay.statusCode(err)
+		if code == http.StatusNoContent {
+			w.WriteHeader(code)
+			return
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	if err := relay.Forward(r.Context(), delivery); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Forward sends the delivery to every target and waits for them, a *TargetError
+// is returned when some targets failed to receive it
+func (relay *Relay) Forward(ctx context.Context, delivery *webhooks.Delivery) error {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errs := make(map[string]error)
+
+	wg.Add(len(relay.targets))
+	for _, target := range relay.targets {
+		go func(target Target) {
+			defer wg.Done()
+			if err := forward(ctx, target, delivery); err != nil {
+				mu.Lock()
+				errs[target.Name] = err
+				mu.Unlock()
+			}
+		}(target)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return &TargetError{Errors: errs}
+	}
+	return nil
+}
+
+func forward(ctx context.Context, target Target, delivery *webhooks.Delivery) error {
+	req, err := NewRequest(target.URL, delivery, target.Secret)
+	if err != nil {
+		return err
+	}
+	_, err = target.Client.Send(ctx, req)
+	return err
+}
+
+// signatureHeaders are the headers carrying the credentials of a provider, they
+// are never forwarded as is
+var signatureHeaders = map[webhooks.ProviderName][]string{
+	webhooks.GitHub:          {"X-Hub-Signature", "X-Hub-Signature-256"},
+	webhooks.GitLab:          {"X-Gitlab-Token"},
+	webhooks.Gitea:           {"X-Gitea-Signature", "X-Gogs-Signature", "X-Hub-Signature", "X-Hub-Signature-256"},
+	webhooks.Gogs:            {"X-Gogs-Signature"},
+	webhooks.Bitbucket:       {"X-Hook-UUID"},
+	webhooks.BitbucketServer: {"X-Hub-Signature"},
+}
+
+// NewRequest returns a POST request to url delivering the original body and
+// provider headers of the delivery, re-signed with the secret when it is not empty
+func NewRequest(url string, delivery *webhooks.Delivery, secret string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(delivery.Body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range delivery.Header {
+		if forwarded(name) {
+			req.Header[name] = append([]string(nil), values...)
+		}
+	}
+	for _, name := range signatureHeaders[delivery.Provider] {
+		req.Header.Del(name)
+	}
+	if secret != "" {
+		sign(req.Header, delivery.Provider, delivery.Body, secret)
+	}
+	return req, nil
+}
+
+// forwarded reports whether the header is sent to the targets: the content type,
+// user agent and provider headers but not the ones added by proxies
+func forwarded(name string) bool {
+	name = http.CanonicalHeaderKey(name)
+	switch {
+	case name == "Content-Type", name == "User-Agent":
+		return true
+	case strings.HasPrefix(name, "X-Forwarded-"):
+		return false
+	default:
+		return strings.HasPrefix(name, "X-")
+	}
+}
+
+func sign(header http.Header, provider webhooks.ProviderName, body []byte, secret string) {
+	switch provider {
+	case webhooks.GitHub:
+		header.Set("X-Hub-Signature", github.SignSHA1(secret, body))
+		header.Set("X-Hub-Signature-256", github.Sign(secret, body))
+	case webhooks.GitLab:
+		header.Set("X-Gitlab-Token", secret)
+	case webhooks.Gitea:
+		header.Set("X-Gitea-Signature", gitea.Sign(secret, body))
+	case webhooks.Gogs:
+		header.Set("X-Gogs-Signature", gogs.Sign(secret, body))
+	case webhooks.Bitbucket:
+		header.Set("X-Hook-UUID", secret)
+	case webhooks.BitbucketServer:
+		header.Set("X-Hub-Signature", bitbucketserver.Sign(secret, body))
+	}
+}
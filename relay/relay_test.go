@@ -0,0 +1,310 @@
+package relay
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+	"github.com/heitormejias/golang-webhooks/bitbucket"
+	bitbucketserver "github.com/heitormejias/golang-webhooks/bitbucket-server"
+	"github.com/heitormejias/golang-webhooks/gitea"
+	"github.com/heitormejias/golang-webhooks/github"
+	"github.com/heitormejias/golang-webhooks/gitlab"
+	"github.com/heitormejias/golang-webhooks/gogs"
+	"github.com/heitormejias/golang-webhooks/sender"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	upstreamSecret = "upstream"
+	payload        = `{"zen":"Keep it logically awesome."}`
+)
+
+// receiver is a downstream target verifying the deliveries with its own secret
+type receiver struct {
+	*httptest.Server
+	mu         sync.Mutex
+	deliveries []string
+	status     int
+}
+
+func newReceiver(t *testing.T, secret string, status int) *receiver {
+	hook, err := github.New(github.Options.Secret(secret))
+	require.NoError(t, err)
+	rec := &receiver{status: status}
+	rec.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivery, err := hook.ParseDelivery(r, github.PingEvent)
+		if err != nil {
+			http.Error(w, err.Error(), github.StatusCode(err))
+			return
+		}
+		rec.mu.Lock()
+		rec.deliveries = append(rec.deliveries, delivery.ID)
+		rec.mu.Unlock()
+		w.WriteHeader(rec.status)
+	}))
+	return rec
+}
+
+func (rec *receiver) received() []string {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return append([]string(nil), rec.deliveries...)
+}
+
+func TestRelay(t *testing.T) {
+	assert := require.New(t)
+	hook, err := github.New(github.Options.Secret(upstreamSecret))
+	assert.NoError(err)
+	parse := func(r *http.Request) (*webhooks.Delivery, error) {
+		return hook.ParseDelivery(r, github.PingEvent)
+	}
+	client, err := sender.New(sender.Options.MaxAttempts(2), sender.Options.Backoff(time.Millisecond, time.Millisecond))
+	assert.NoError(err)
+
+	tests := []struct {
+		name    string
+		secret  string
+		status  int
+		code    int
+		targets int
+		failed  bool
+	}{
+		{
+			name:    "Forwarded",
+			secret:  upstreamSecret,
+			status:  http.StatusOK,
+			code:    http.StatusOK,
+			targets: 1,
+		},
+		{
+			name:    "TargetFailed",
+			secret:  upstreamSecret,
+			status:  http.StatusInternalServerError,
+			code:    http.StatusBadGateway,
+			targets: 2,
+			failed:  true,
+		},
+		{
+			name:   "Forged",
+			secret: "forged",
+			status: http.StatusOK,
+			code:   http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ok := newReceiver(t, "ok", http.StatusOK)
+			defer ok.Close()
+			other := newReceiver(t, "other", tc.status)
+			defer other.Close()
+
+			relay, err := New(parse, []Target{
+				{Name: "ok", URL: ok.URL, Secret: "ok"},
+				{Name: "other", URL: other.URL, Secret: "other", Client: client},
+			}, Options.StatusCode(github.StatusCode))
+			assert.NoError(err)
+
+			req, err := github.NewRequest("http://localhost/webhooks", github.PingEvent, []byte(payload), tc.secret)
+			assert.NoError(err)
+			w := httptest.NewRecorder()
+			relay.ServeHTTP(w, req)
+			assert.Equal(tc.code, w.Code)
+
+			if tc.code == http.StatusUnauthorized {
+				assert.Empty(ok.received())
+				assert.Empty(other.received())
+				return
+			}
+			assert.Equal([]string{req.Header.Get("X-GitHub-Delivery")}, ok.received())
+			assert.Len(other.received(), tc.targets)
+			for _, id := range other.received() {
+				assert.Equal(req.Header.Get("X-GitHub-Delivery"), id)
+			}
+			if tc.failed {
+				assert.Contains(w.Body.String(), "other: delivery failed with status 500 after 2 attempts")
+			}
+		})
+	}
+}
+
+func TestForward(t *testing.T) {
+	assert := require.New(t)
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+	received := newReceiver(t, "secret", http.StatusOK)
+	defer received.Close()
+	client, err := sender.New(sender.Options.MaxAttempts(1))
+	assert.NoError(err)
+
+	relay, err := New(nil, []Target{
+		{Name: "received", URL: received.URL, Secret: "secret"},
+		{Name: "unreachable", URL: unreachable.URL, Client: client},
+	})
+	assert.NoError(err)
+
+	req, err := github.NewRequest("http://localhost/webhooks", github.PingEvent, []byte(payload), upstreamSecret)
+	assert.NoError(err)
+	delivery := webhooks.NewDelivery(webhooks.GitHub, req.Header, []byte(payload))
+
+	err = relay.Forward(req.Context(), delivery)
+	var targetErr *TargetError
+	assert.True(errors.As(err, &targetErr))
+	assert.Len(targetErr.Errors, 1)
+	assert.Error(targetErr.Errors["unreachable"])
+	assert.Equal([]string{delivery.ID}, received.received())
+}
+
+func TestNew(t *testing.T) {
+	assert := require.New(t)
+
+	_, err := New(nil, nil)
+	assert.Equal(ErrNoTargets, err)
+	_, err = New(nil, []Target{{Name: "a"}})
+	assert.Equal(ErrInvalidTarget, err)
+	_, err = New(nil, []Target{{Name: "a", URL: "http://a"}, {Name: "a", URL: "http://b"}})
+	assert.True(errors.Is(err, ErrDuplicateName))
+}
+
+func TestNewRequest(t *testing.T) {
+	assert := require.New(t)
+	const downstreamSecret = "downstream"
+	body := []byte(payload)
+
+	tests := []struct {
+		name     string
+		provider webhooks.ProviderName
+		request  func(secret string) (*http.Request, error)
+		parse    func(secret string, headers http.Header) error
+	}{
+		{
+			name:     "GitHub",
+			provider: webhooks.GitHub,
+			request: func(secret string) (*http.Request, error) {
+				return github.NewRequest("http://localhost/webhooks", github.PingEvent, body, secret)
+			},
+			parse: func(secret string, headers http.Header) error {
+				hook, err := github.New(github.Options.Secret(secret), github.Options.SignaturePolicy(github.SignatureLegacySHA1))
+				if err != nil {
+					return err
+				}
+				_, err = hook.ParseBytes(headers, body, github.PingEvent)
+				return err
+			},
+		},
+		{
+			name:     "GitLab",
+			provider: webhooks.GitLab,
+			request: func(secret string) (*http.Request, error) {
+				return gitlab.NewRequest("http://localhost/webhooks", gitlab.PushEvents, body, secret)
+			},
+			parse: func(secret string, headers http.Header) error {
+				hook, err := gitlab.New(gitlab.Options.Secret(secret))
+				if err != nil {
+					return err
+				}
+				_, err = hook.ParseBytes(headers, body, gitlab.PushEvents)
+				return err
+			},
+		},
+		{
+			name:     "Gitea",
+			provider: webhooks.Gitea,
+			request: func(secret string) (*http.Request, error) {
+				return gitea.NewRequest("http://localhost/webhooks", gitea.PushEvents, body, secret)
+			},
+			parse: func(secret string, headers http.Header) error {
+				hook, err := gitea.New(gitea.Options.Secret(secret))
+				if err != nil {
+					return err
+				}
+				_, err = hook.ParseBytes(headers, body, gitea.PushEvents)
+				return err
+			},
+		},
+		{
+			name:     "Gogs",
+			provider: webhooks.Gogs,
+			request: func(secret string) (*http.Request, error) {
+				return gogs.NewRequest("http://localhost/webhooks", gogs.PushEvent, body, secret)
+			},
+			parse: func(secret string, headers http.Header) error {
+				hook, err := gogs.New(gogs.Options.Secret(secret))
+				if err != nil {
+					return err
+				}
+				_, err = hook.ParseBytes(headers, body, gogs.PushEvent)
+				return err
+			},
+		},
+		{
+			name:     "Bitbucket",
+			provider: webhooks.Bitbucket,
+			request: func(secret string) (*http.Request, error) {
+				return bitbucket.NewRequest("http://localhost/webhooks", bitbucket.RepoPushEvent, body, secret)
+			},
+			parse: func(secret string, headers http.Header) error {
+				hook, err := bitbucket.New(bitbucket.Options.UUID(secret))
+				if err != nil {
+					return err
+				}
+				_, err = hook.ParseBytes(headers, body, bitbucket.RepoPushEvent)
+				return err
+			},
+		},
+		{
+			name:     "BitbucketServer",
+			provider: webhooks.BitbucketServer,
+			request: func(secret string) (*http.Request, error) {
+				return bitbucketserver.NewRequest("http://localhost/webhooks", bitbucketserver.RepositoryReferenceChangedEvent, body, secret)
+			},
+			parse: func(secret string, headers http.Header) error {
+				hook, err := bitbucketserver.New(bitbucketserver.Options.Secret(secret))
+				if err != nil {
+					return err
+				}
+				_, err = hook.ParseBytes(headers, body, bitbucketserver.RepositoryReferenceChangedEvent)
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			upstream, err := tc.request(upstreamSecret)
+			assert.NoError(err)
+			upstream.Header.Set("X-Forwarded-For", "203.0.113.7")
+			upstream.Header.Set("Authorization", "Bearer ingress")
+			delivery := webhooks.NewDelivery(tc.provider, upstream.Header, body)
+
+			req, err := NewRequest("http://target/webhooks", delivery, downstreamSecret)
+			assert.NoError(err)
+			forwarded, err := ioutil.ReadAll(req.Body)
+			assert.NoError(err)
+			assert.True(bytes.Equal(body, forwarded))
+			assert.Equal(upstream.Header.Get("User-Agent"), req.Header.Get("User-Agent"))
+			assert.Empty(req.Header.Get("X-Forwarded-For"))
+			assert.Empty(req.Header.Get("Authorization"))
+			assert.NoError(tc.parse(downstreamSecret, req.Header))
+			assert.Error(tc.parse(upstreamSecret, req.Header))
+
+			// unsigned deliveries don't leak the upstream credentials
+			req, err = NewRequest("http://target/webhooks", delivery, "")
+			assert.NoError(err)
+			for _, name := range signatureHeaders[tc.provider] {
+				assert.Empty(req.Header.Get(name), name)
+			}
+			assert.Error(tc.parse(upstreamSecret, req.Header))
+		})
+	}
+}
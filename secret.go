@@ -0,0 +1,85 @@
+package webhooks
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrSecretLookup is returned when a SecretProvider fails to resolve the secrets of a delivery
+var ErrSecretLookup = errors.New("secret lookup failed")
+
+// Secret is a shared secret of a webhook, several secrets may be registered at
+// once so they can be rotated without rejecting deliveries
+type Secret struct {
+	Value string
+	// Label identifies the secret in the Delivery it verified
+	Label string
+	// ExpiresAt is the time the secret stops being accepted, zero never expires
+	ExpiresAt time.Time
+}
+
+// Expired reports whether the secret is no longer accepted at the given time
+func (s Secret) Expired(now time.Time) bool {
+	return !s.ExpiresAt.IsZero() && !now.Before(s.ExpiresAt)
+}
+
+// Secrets are the secrets registered for a webhook
+type Secrets []Secret
+
+// Add returns the secrets with the given ones appended, empty values are skipped
+func (secrets Secrets) Add(add ...Secret) Secrets {
+	for _, s := range add {
+		if s.Value != "" {
+			secrets = append(secrets, s)
+		}
+	}
+	return secrets
+}
+
+// Match returns the first unexpired secret accepted by verify
+func (secrets Secrets) Match(verify func(secret string) bool) (Secret, bool) {
+	now := time.Now()
+	for _, s := range secrets {
+		if s.Expired(now) {
+			continue
+		}
+		if verify(s.Value) {
+			return s, true
+		}
+	}
+	return Secret{}, false
+}
+
+// SecretProvider resolves the secrets verifying a delivery per request, allowing a
+// single receiver to serve many tenants each with its own secret.
+//
+// unverifiedRepo is the repository full name peeked from the payload before it is
+// verified, it must only be used to look the secrets up. Deliveries parsed from raw
+// headers and body are passed a request carrying only the headers
+type SecretProvider interface {
+	Secrets(r *http.Request, unverifiedRepo string) ([]string, error)
+}
+
+// SecretProviderFunc is an adapter allowing ordinary functions to be used as SecretProvider
+type SecretProviderFunc func(r *http.Request, unverifiedRepo string) ([]string, error)
+
+// Secrets calls f(r, unverifiedRepo)
+func (f SecretProviderFunc) Secrets(r *http.Request, unverifiedRepo string) ([]string, error) {
+	return f(r, unverifiedRepo)
+}
+
+// ResolveSecrets returns the registered secrets together with the ones resolved
+// by the provider for the request
+func ResolveSecrets(secrets Secrets, provider SecretProvider, r *http.Request, unverifiedRepo string) (Secrets, error) {
+	values, err := provider.Secrets(r, unverifiedRepo)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSecretLookup, err)
+	}
+	resolved := append(Secrets(nil), secrets...)
+	for _, v := range values {
+		resolved = resolved.Add(Secret{Value: v})
+	}
+	return resolved, nil
+}
@@ -0,0 +1,186 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// client errors
+var (
+	ErrInvalidTimeout     = errors.New("timeout must be greater than 0")
+	ErrInvalidMaxAttempts = errors.New("max attempts must be greater than 0")
+	ErrInvalidBackoff     = errors.New("invalid backoff")
+	ErrBodyNotRewindable  = errors.New("request body can't be sent again")
+)
+
+// StatusError is returned when the receiver answered every attempt with a non 2xx status
+type StatusError struct {
+	StatusCode int
+	Attempts   int
+}
+
+// Error returns the error message
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("delivery failed with status %d after %d attempts", e.StatusCode, e.Attempts)
+}
+
+// Option is a configuration option for the client
+type Option func(*Client) error
+
+// Options is a namespace var for configuration options
+var Options = ClientOptions{}
+
+// ClientOptions is a namespace for configuration option methods
+type ClientOptions struct{}
+
+// Timeout sets the time a receiver has to answer a single attempt, 10s by default
+// like GitHub
+func (ClientOptions) Timeout(timeout time.Duration) Option {
+	return func(c *Client) error {
+		if timeout <= 0 {
+			return ErrInvalidTimeout
+		}
+		c.timeout = timeout
+		return nil
+	}
+}
+
+// MaxAttempts sets the number of times a delivery is sent before giving up, 3 by default
+func (ClientOptions) MaxAttempts(attempts int) Option {
+	return func(c *Client) error {
+		if attempts <= 0 {
+			return ErrInvalidMaxAttempts
+		}
+		c.maxAttempts = attempts
+		return nil
+	}
+}
+
+// Backoff sets the delay before the first retry, doubled on every further retry
+// up to max, 1s and 30s by default
+func (ClientOptions) Backoff(initial, max time.Duration) Option {
+	return func(c *Client) error {
+		if initial <= 0 || max < initial {
+			return ErrInvalidBackoff
+		}
+		c.initialBackoff = initial
+		c.maxBackoff = max
+		return nil
+	}
+}
+
+// HTTPClient sets the client sending the requests, http.DefaultClient by default
+func (ClientOptions) HTTPClient(client *http.Client) Option {
+	return func(c *Client) error {
+		c.client = client
+		return nil
+	}
+}
+
+// Client delivers webhook requests with retries the way forges do: every attempt
+// has a timeout, network errors, timeouts, 429 Too Many Requests and 5xx answers
+// are retried with exponential backoff while other answers are final. Retries
+// carry the same headers, delivery ID included, so receivers can deduplicate them
+type Client struct {
+	client         *http.Client
+	timeout        time.Duration
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+// New creates and returns a Client
+func New(options ...Option) (*Client, error) {
+	c := &Client{
+		client:         http.DefaultClient,
+		timeout:        10 * time.Second,
+		maxAttempts:    3,
+		initialBackoff: time.Second,
+		maxBackoff:     30 * time.Second,
+	}
+	for _, opt := range options {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Send delivers the request, usually built by the NewRequest function of a provider
+// package, and returns the status code of the last answer. A *StatusError is
+// returned when no attempt was answered with 2xx, the context cancels the retries
+func (c *Client) Send(ctx context.Context, req *http.Request) (int, error) {
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		code, err := c.attempt(ctx, req, attempt)
+		if err == nil && code >= 200 && code <= 299 {
+			return code, nil
+		}
+		lastErr = err
+		if err == nil {
+			lastErr = &StatusError{StatusCode: code, Attempts: attempt}
+		}
+		if attempt >= c.maxAttempts || !retryable(code, err) {
+			return code, lastErr
+		}
+
+		timer := time.NewTimer(c.backoff(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return code, ctx.Err()
+		}
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, req *http.Request, attempt int) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	r := req.Clone(ctx)
+	if attempt > 1 && req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return 0, ErrBodyNotRewindable
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return 0, err
+		}
+		r.Body = body
+	}
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+	return resp.StatusCode, nil
+}
+
+func retryable(code int, err error) bool {
+	if errors.Is(err, ErrBodyNotRewindable) {
+		return false
+	}
+	return err != nil || code == http.StatusTooManyRequests || code >= 500
+}
+
+// backoff returns the delay before the retry following the given attempt
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := c.initialBackoff
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= c.maxBackoff {
+			return c.maxBackoff
+		}
+	}
+	return delay
+}
@@ -0,0 +1,104 @@
+package sender
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/heitormejias/golang-webhooks/github"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSend(t *testing.T) {
+	assert := require.New(t)
+	tests := []struct {
+		name     string
+		answers  []int
+		code     int
+		attempts int
+		err      bool
+	}{
+		{
+			name:     "Delivered",
+			answers:  []int{http.StatusOK},
+			code:     http.StatusOK,
+			attempts: 1,
+		},
+		{
+			name:     "Retried",
+			answers:  []int{http.StatusBadGateway, http.StatusTooManyRequests, http.StatusAccepted},
+			code:     http.StatusAccepted,
+			attempts: 3,
+		},
+		{
+			name:     "NotRetried",
+			answers:  []int{http.StatusBadRequest},
+			code:     http.StatusBadRequest,
+			attempts: 1,
+			err:      true,
+		},
+		{
+			name:     "GaveUp",
+			answers:  []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusOK},
+			code:     http.StatusInternalServerError,
+			attempts: 3,
+			err:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var mu sync.Mutex
+			var bodies []string
+			var deliveries []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				body, _ := ioutil.ReadAll(r.Body)
+				bodies = append(bodies, string(body))
+				deliveries = append(deliveries, r.Header.Get("X-GitHub-Delivery"))
+				w.WriteHeader(tc.answers[len(bodies)-1])
+			}))
+			defer server.Close()
+
+			client, err := New(Options.Backoff(time.Millisecond, 2*time.Millisecond))
+			assert.NoError(err)
+			req, err := github.NewRequest(server.URL, github.PingEvent, map[string]string{"zen": "Keep it logically awesome."}, "secret")
+			assert.NoError(err)
+
+			code, err := client.Send(context.Background(), req)
+			assert.Equal(tc.code, code)
+			if tc.err {
+				assert.Error(err)
+			} else {
+				assert.NoError(err)
+			}
+			assert.Len(bodies, tc.attempts)
+			for i := range bodies {
+				assert.Equal(`{"zen":"Keep it logically awesome."}`, bodies[i])
+				assert.Equal(deliveries[0], deliveries[i])
+			}
+		})
+	}
+}
+
+func TestSendTimeout(t *testing.T) {
+	assert := require.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	client, err := New(Options.Timeout(10*time.Millisecond), Options.MaxAttempts(2), Options.Backoff(time.Millisecond, time.Millisecond))
+	assert.NoError(err)
+	req, err := github.NewRequest(server.URL, github.PingEvent, []byte(`{}`), "")
+	assert.NoError(err)
+	_, err = client.Send(context.Background(), req)
+	assert.Error(err)
+}
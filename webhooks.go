@@ -0,0 +1,169 @@
+package webhooks
+
+import (
+	"errors"
+	"net/http"
+)
+
+// detection errors
+var (
+	ErrUnknownProvider       = errors.New("unable to detect webhook provider from headers")
+	ErrProviderNotRegistered = errors.New("provider not registered")
+)
+
+// ProviderName identifies the forge a delivery originates from
+type ProviderName string
+
+// Supported providers
+const (
+	GitHub          ProviderName = "github"
+	GitLab          ProviderName = "gitlab"
+	Gitea           ProviderName = "gitea"
+	Gogs            ProviderName = "gogs"
+	Bitbucket       ProviderName = "bitbucket"
+	BitbucketServer ProviderName = "bitbucketserver"
+	Docker          ProviderName = "docker"
+)
+
+// Provider is implemented by the Webhook of every provider package, it allows
+// deliveries of different forges to be parsed through a single endpoint
+type Provider interface {
+	// Name returns the forge the Webhook parses deliveries for
+	Name() ProviderName
+
+	// ParseAny verifies and parses any event known by the provider and returns
+	// the payload object or an error
+	ParseAny(r *http.Request) (interface{}, error)
+
+	// Normalize converts a payload returned by ParseAny into the provider
+	// agnostic normalized events
+	Normalize(payload interface{}) ([]NormalizedEvent, error)
+}
+
+// Detect picks the provider that sent the request by inspecting its headers.
+//
+// Gitea also sends the X-Gogs-Event and X-GitHub-Event headers for compatibility
+// so it is checked first, Bitbucket Cloud and Bitbucket Server share X-Event-Key
+// and are told apart by X-Hook-UUID/X-Request-UUID versus X-Request-Id.
+// Docker Hub deliveries carry no identifying header and can't be detected.
+func Detect(r *http.Request) (ProviderName, error) {
+	return detect(r.Header)
+}
+
+func detect(h http.Header) (ProviderName, error) {
+	switch {
+	case h.Get("X-Gitea-Event") != "":
+		return Gitea, nil
+	case h.Get("X-Gogs-Event") != "":
+		return Gogs, nil
+	case h.Get("X-GitHub-Event") != "":
+		return GitHub, nil
+	case h.Get("X-Gitlab-Event") != "":
+		return GitLab, nil
+	case h.Get("X-Event-Key") != "":
+		switch {
+		case h.Get("X-Hook-UUID") != "", h.Get("X-Request-UUID") != "":
+			return Bitbucket, nil
+		case h.Get("X-Request-Id") != "":
+			return BitbucketServer, nil
+		}
+	}
+	return "", ErrUnknownProvider
+}
+
+// Mux dispatches deliveries to the registered Provider or http.Handler detected
+// from the headers, it implements http.Handler
+type Mux struct {
+	providers map[ProviderName]Provider
+	handlers  map[ProviderName]http.Handler
+}
+
+// NewMux creates and returns a Mux for the given providers, registering a
+// provider twice replaces the previous one
+func NewMux(providers ...Provider) *Mux {
+	mux := &Mux{
+		providers: make(map[ProviderName]Provider),
+		handlers:  make(map[ProviderName]http.Handler),
+	}
+	for _, p := range providers {
+		mux.providers[p.Name()] = p
+	}
+	return mux
+}
+
+// Handle registers the handler serving the deliveries of the given provider,
+// usually the Router of the provider package
+func (mux *Mux) Handle(name ProviderName, handler http.Handler) {
+	mux.handlers[name] = handler
+}
+
+// ServeHTTP detects the provider of the request and hands it to the handler
+// registered for it, undetected providers are answered with 400 Bad Request
+// and providers without handler with 404 Not Found
+func (mux *Mux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, err := Detect(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	handler, ok := mux.handlers[name]
+	if !ok {
+		http.Error(w, ErrProviderNotRegistered.Error(), http.StatusNotFound)
+		return
+	}
+	handler.ServeHTTP(w, r)
+}
+
+// Parse detects the provider of the request, verifies and parses it with the
+// matching registered Provider and returns the provider name and payload object or an error
+func (mux *Mux) Parse(r *http.Request) (ProviderName, interface{}, error) {
+	name, err := Detect(r)
+	if err != nil {
+		return "", nil, err
+	}
+	p, ok := mux.providers[name]
+	if !ok {
+		return name, nil, ErrProviderNotRegistered
+	}
+	payload, err := p.ParseAny(r)
+	return name, payload, err
+}
+
+// ParseNormalized works like Parse but returns the payload converted into
+// normalized events, ErrNotNormalizable is returned for payloads without a
+// normalized form
+func (mux *Mux) ParseNormalized(r *http.Request) (ProviderName, []NormalizedEvent, error) {
+	name, payload, err := mux.Parse(r)
+	if err != nil {
+		return name, nil, err
+	}
+	events, err := mux.providers[name].Normalize(payload)
+	return name, events, err
+}
+
+// StatusError can be returned by router callbacks to choose the HTTP status
+// code answered to the provider
+type StatusError struct {
+	Code int
+	Err  error
+}
+
+// Error returns the message of the wrapped error
+func (e *StatusError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns the HTTP status code of a callback error, the code of a
+// StatusError or 500 Internal Server Error for any other error
+func StatusCode(err error) int {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Code
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,1349 @@
+package webhooks_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+	"github.com/heitormejias/golang-webhooks/bitbucket"
+	bitbucketserver "github.com/heitormejias/golang-webhooks/bitbucket-server"
+	"github.com/heitormejias/golang-webhooks/docker"
+	"github.com/heitormejias/golang-webhooks/gitea"
+	"github.com/heitormejias/golang-webhooks/github"
+	"github.com/heitormejias/golang-webhooks/gitlab"
+	"github.com/heitormejias/golang-webhooks/gogs"
+)
+
+const (
+	path = "/webhooks"
+)
+
+func newServer(handler http.HandlerFunc) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, handler)
+	return httptest.NewServer(mux)
+}
+
+func TestDetect(t *testing.T) {
+	assert := require.New(t)
+	tests := []struct {
+		name     string
+		headers  http.Header
+		provider webhooks.ProviderName
+		err      error
+	}{
+		{
+			name:     "GitHub",
+			headers:  http.Header{"X-Github-Event": []string{"push"}},
+			provider: webhooks.GitHub,
+		},
+		{
+			name:     "GitLab",
+			headers:  http.Header{"X-Gitlab-Event": []string{"Push Hook"}},
+			provider: webhooks.GitLab,
+		},
+		{
+			name: "Gitea",
+			headers: http.Header{
+				"X-Gitea-Event":  []string{"push"},
+				"X-Gogs-Event":   []string{"push"},
+				"X-Github-Event": []string{"push"},
+			},
+			provider: webhooks.Gitea,
+		},
+		{
+			name:     "Gogs",
+			headers:  http.Header{"X-Gogs-Event": []string{"push"}},
+			provider: webhooks.Gogs,
+		},
+		{
+			name: "Bitbucket",
+			headers: http.Header{
+				"X-Event-Key": []string{"repo:push"},
+				"X-Hook-Uuid": []string{"MY_UUID"},
+			},
+			provider: webhooks.Bitbucket,
+		},
+		{
+			name: "BitbucketServer",
+			headers: http.Header{
+				"X-Event-Key":  []string{"repo:refs_changed"},
+				"X-Request-Id": []string{"a6ff8c37-1b2a-4c7d-b0a7-95c46e32a5c1"},
+			},
+			provider: webhooks.BitbucketServer,
+		},
+		{
+			name:    "AmbiguousEventKey",
+			headers: http.Header{"X-Event-Key": []string{"repo:push"}},
+			err:     webhooks.ErrUnknownProvider,
+		},
+		{
+			name:    "NoHeaders",
+			headers: http.Header{},
+			err:     webhooks.ErrUnknownProvider,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, path, nil)
+			r.Header = tc.headers
+			provider, err := webhooks.Detect(r)
+			assert.Equal(tc.err, err)
+			assert.Equal(tc.provider, provider)
+		})
+	}
+}
+
+func TestMux(t *testing.T) {
+	assert := require.New(t)
+	githubHook, err := github.New()
+	assert.NoError(err)
+	mux := webhooks.NewMux(githubHook)
+
+	tests := []struct {
+		name     string
+		filename string
+		headers  http.Header
+		provider webhooks.ProviderName
+		typ      interface{}
+		err      error
+	}{
+		{
+			name:     "GitHubPush",
+			filename: "testdata/github/push.json",
+			headers:  http.Header{"X-Github-Event": []string{"push"}},
+			provider: webhooks.GitHub,
+			typ:      github.PushPayload{},
+		},
+		{
+			name:     "GitLabNotRegistered",
+			filename: "testdata/gitlab/push-event.json",
+			headers:  http.Header{"X-Gitlab-Event": []string{string(gitlab.PushEvents)}},
+			provider: webhooks.GitLab,
+			err:      webhooks.ErrProviderNotRegistered,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		client := &http.Client{}
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := os.ReadFile(tc.filename)
+			assert.NoError(err)
+
+			var provider webhooks.ProviderName
+			var results interface{}
+			var parseError error
+			server := newServer(func(w http.ResponseWriter, r *http.Request) {
+				provider, results, parseError = mux.Parse(r)
+			})
+			defer server.Close()
+			req, err := http.NewRequest(http.MethodPost, server.URL+path, bytes.NewReader(payload))
+			assert.NoError(err)
+			req.Header = tc.headers
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := client.Do(req)
+			assert.NoError(err)
+			assert.Equal(http.StatusOK, resp.StatusCode)
+			assert.Equal(tc.provider, provider)
+			assert.Equal(tc.err, parseError)
+			if tc.err == nil {
+				assert.Equal(reflect.TypeOf(tc.typ), reflect.TypeOf(results))
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	assert := require.New(t)
+	githubHook, err := github.New()
+	assert.NoError(err)
+	gitlabHook, err := gitlab.New()
+	assert.NoError(err)
+	giteaHook, err := gitea.New()
+	assert.NoError(err)
+	bitbucketHook, err := bitbucket.New()
+	assert.NoError(err)
+	bitbucketServerHook, err := bitbucketserver.New()
+	assert.NoError(err)
+	mux := webhooks.NewMux(githubHook, gitlabHook, giteaHook, bitbucketHook, bitbucketServerHook)
+
+	tests := []struct {
+		name     string
+		filename string
+		headers  http.Header
+		expected webhooks.NormalizedEvent
+	}{
+		{
+			name:     "GitHubPush",
+			filename: "testdata/github/push.json",
+			headers:  http.Header{"X-Github-Event": []string{"push"}},
+			expected: webhooks.NormalizedPush{Ref: "refs/heads/master", Repository: webhooks.NormalizedRepository{FullName: "binkkatal/sample_app"}},
+		},
+		{
+			name:     "GitHubPullRequest",
+			filename: "testdata/github/pull-request.json",
+			headers:  http.Header{"X-Github-Event": []string{"pull_request"}},
+			expected: webhooks.NormalizedPullRequest{Action: webhooks.ActionOpened, Number: 1, Repository: webhooks.NormalizedRepository{FullName: "baxterthehacker/public-repo"}},
+		},
+		{
+			name:     "GitHubIssue",
+			filename: "testdata/github/issues.json",
+			headers:  http.Header{"X-Github-Event": []string{"issues"}},
+			expected: webhooks.NormalizedIssue{Action: webhooks.ActionOpened, Repository: webhooks.NormalizedRepository{FullName: "baxterthehacker/public-repo"}},
+		},
+		{
+			name:     "GitHubRelease",
+			filename: "testdata/github/release.json",
+			headers:  http.Header{"X-Github-Event": []string{"release"}},
+			expected: webhooks.NormalizedRelease{Action: webhooks.ActionPublished, TagName: "0.0.1", Repository: webhooks.NormalizedRepository{FullName: "baxterthehacker/public-repo"}},
+		},
+		{
+			name:     "GitHubTag",
+			filename: "testdata/github/create.json",
+			headers:  http.Header{"X-Github-Event": []string{"create"}},
+			expected: webhooks.NormalizedTag{Action: webhooks.ActionCreated, Name: "0.0.1", Repository: webhooks.NormalizedRepository{FullName: "baxterthehacker/public-repo"}},
+		},
+		{
+			name:     "GitLabPush",
+			filename: "testdata/gitlab/push-event.json",
+			headers:  http.Header{"X-Gitlab-Event": []string{"Push Hook"}},
+			expected: webhooks.NormalizedPush{Ref: "refs/heads/master", Repository: webhooks.NormalizedRepository{FullName: "mike/diaspora"}},
+		},
+		{
+			name:     "GitLabTag",
+			filename: "testdata/gitlab/tag-event.json",
+			headers:  http.Header{"X-Gitlab-Event": []string{"Tag Push Hook"}},
+			expected: webhooks.NormalizedTag{Action: webhooks.ActionCreated, Name: "v1.0.0", Repository: webhooks.NormalizedRepository{FullName: "jsmith/example"}},
+		},
+		{
+			name:     "GitLabMergeRequest",
+			filename: "testdata/gitlab/merge-request-event.json",
+			headers:  http.Header{"X-Gitlab-Event": []string{"Merge Request Hook"}},
+			expected: webhooks.NormalizedPullRequest{Action: webhooks.ActionOpened, Number: 1, Repository: webhooks.NormalizedRepository{FullName: "gitlabhq/gitlab-test"}},
+		},
+		{
+			name:     "GitLabIssue",
+			filename: "testdata/gitlab/issue-event.json",
+			headers:  http.Header{"X-Gitlab-Event": []string{"Issue Hook"}},
+			expected: webhooks.NormalizedIssue{Action: webhooks.ActionOpened, Number: 23, Repository: webhooks.NormalizedRepository{FullName: "gitlabhq/gitlab-test"}},
+		},
+		{
+			name:     "GiteaPush",
+			filename: "testdata/gitea/push-event.json",
+			headers:  http.Header{"X-Gitea-Event": []string{"push"}},
+			expected: webhooks.NormalizedPush{Ref: "refs/heads/master", Repository: webhooks.NormalizedRepository{FullName: "heitormejias/example"}},
+		},
+		{
+			name:     "BitbucketPush",
+			filename: "testdata/bitbucket/repo-push.json",
+			headers:  http.Header{"X-Event-Key": []string{"repo:push"}, "X-Hook-Uuid": []string{"MY_UUID"}},
+			expected: webhooks.NormalizedPush{Ref: "refs/heads/name-of-branch", Repository: webhooks.NormalizedRepository{FullName: "team_name/repo_name"}},
+		},
+		{
+			name:     "BitbucketPullRequest",
+			filename: "testdata/bitbucket/pull-request-created.json",
+			headers:  http.Header{"X-Event-Key": []string{"pullrequest:created"}, "X-Hook-Uuid": []string{"MY_UUID"}},
+			expected: webhooks.NormalizedPullRequest{Action: webhooks.ActionOpened, Number: 1, Repository: webhooks.NormalizedRepository{FullName: "team_name/repo_name"}},
+		},
+		{
+			name:     "BitbucketServerPush",
+			filename: "testdata/bitbucket-server/repo-refs-changed.json",
+			headers:  http.Header{"X-Event-Key": []string{"repo:refs_changed"}, "X-Request-Id": []string{"a6ff8c37"}},
+			expected: webhooks.NormalizedPush{Ref: "refs/heads/feature/wip", Repository: webhooks.NormalizedRepository{FullName: "~gopher/webhook-test"}},
+		},
+		{
+			name:     "BitbucketServerPullRequest",
+			filename: "testdata/bitbucket-server/pr-opened.json",
+			headers:  http.Header{"X-Event-Key": []string{"pr:opened"}, "X-Request-Id": []string{"a6ff8c37"}},
+			expected: webhooks.NormalizedPullRequest{Action: webhooks.ActionOpened, Number: 5, Repository: webhooks.NormalizedRepository{FullName: "~gopher/webhook-test"}},
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := os.ReadFile(tc.filename)
+			assert.NoError(err)
+			req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload))
+			req.Header = tc.headers
+
+			_, events, err := mux.ParseNormalized(req)
+			assert.NoError(err)
+			assert.Len(events, 1)
+			assert.Equal(tc.expected.Kind(), events[0].Kind())
+
+			switch expected := tc.expected.(type) {
+			case webhooks.NormalizedPush:
+				push := events[0].(webhooks.NormalizedPush)
+				assert.Equal(expected.Ref, push.Ref)
+				assert.Equal(expected.Repository.FullName, push.Repository.FullName)
+			case webhooks.NormalizedPullRequest:
+				pr := events[0].(webhooks.NormalizedPullRequest)
+				assert.Equal(expected.Action, pr.Action)
+				assert.Equal(expected.Number, pr.Number)
+				assert.Equal(expected.Repository.FullName, pr.Repository.FullName)
+			case webhooks.NormalizedIssue:
+				issue := events[0].(webhooks.NormalizedIssue)
+				assert.Equal(expected.Action, issue.Action)
+				assert.Equal(expected.Repository.FullName, issue.Repository.FullName)
+			case webhooks.NormalizedTag:
+				tag := events[0].(webhooks.NormalizedTag)
+				assert.Equal(expected.Action, tag.Action)
+				assert.Equal(expected.Name, tag.Name)
+				assert.Equal(expected.Repository.FullName, tag.Repository.FullName)
+			case webhooks.NormalizedRelease:
+				release := events[0].(webhooks.NormalizedRelease)
+				assert.Equal(expected.Action, release.Action)
+				assert.Equal(expected.TagName, release.TagName)
+				assert.Equal(expected.Repository.FullName, release.Repository.FullName)
+			}
+		})
+	}
+}
+
+func TestMemoryDedupStore(t *testing.T) {
+	assert := require.New(t)
+	store := webhooks.NewMemoryDedupStore(2, 50*time.Millisecond)
+
+	seen, err := store.Seen("a")
+	assert.NoError(err)
+	assert.False(seen)
+	seen, _ = store.Seen("a")
+	assert.True(seen)
+
+	// b and c evict a, the least recently seen
+	_, _ = store.Seen("b")
+	_, _ = store.Seen("c")
+	assert.Equal(2, store.Len())
+	seen, _ = store.Seen("a")
+	assert.False(seen)
+
+	time.Sleep(60 * time.Millisecond)
+	seen, _ = store.Seen("c")
+	assert.False(seen)
+	assert.NoError(store.Forget("c"))
+	seen, _ = store.Seen("c")
+	assert.False(seen)
+
+	// expired IDs are evicted without capacity
+	store = webhooks.NewMemoryDedupStore(0, 50*time.Millisecond)
+	_, _ = store.Seen("a")
+	_, _ = store.Seen("b")
+	time.Sleep(60 * time.Millisecond)
+	_, _ = store.Seen("c")
+	assert.Equal(1, store.Len())
+}
+
+func TestFileDedupStore(t *testing.T) {
+	assert := require.New(t)
+	filename := filepath.Join(t.TempDir(), "deliveries")
+
+	store, err := webhooks.NewFileDedupStore(filename, time.Hour)
+	assert.NoError(err)
+	seen, err := store.Seen("72d3162e-cc78-11e3-81ab-4c9367dc0958")
+	assert.NoError(err)
+	assert.False(seen)
+	_, err = store.Seen("bad\nid")
+	assert.Equal(webhooks.ErrInvalidDeliveryID, err)
+	assert.NoError(store.Close())
+
+	store, err = webhooks.NewFileDedupStore(filename, time.Hour)
+	assert.NoError(err)
+	defer func() {
+		_ = store.Close()
+	}()
+	seen, err = store.Seen("72d3162e-cc78-11e3-81ab-4c9367dc0958")
+	assert.NoError(err)
+	assert.True(seen)
+	assert.NoError(store.Forget("72d3162e-cc78-11e3-81ab-4c9367dc0958"))
+	assert.NoError(store.Close())
+
+	store, err = webhooks.NewFileDedupStore(filename, time.Hour)
+	assert.NoError(err)
+	seen, err = store.Seen("72d3162e-cc78-11e3-81ab-4c9367dc0958")
+	assert.NoError(err)
+	assert.False(seen)
+	assert.NoError(store.Close())
+
+	// the file is compacted as the IDs expire
+	filename = filepath.Join(t.TempDir(), "expiring")
+	store, err = webhooks.NewFileDedupStore(filename, time.Nanosecond)
+	assert.NoError(err)
+	for i := 0; i < 3000; i++ {
+		_, err = store.Seen(strconv.Itoa(i))
+		assert.NoError(err)
+	}
+	assert.NoError(store.Close())
+	data, err := ioutil.ReadFile(filename)
+	assert.NoError(err)
+	assert.Less(bytes.Count(data, []byte("\n")), 1100)
+}
+
+func TestDeduplicate(t *testing.T) {
+	assert := require.New(t)
+	tests := []struct {
+		name     string
+		mode     webhooks.DedupMode
+		failures int
+		handled  []bool
+		expected []int
+	}{
+		{
+			name:     "Reject",
+			mode:     webhooks.DedupReject,
+			handled:  []bool{true, false},
+			expected: []int{http.StatusNoContent, http.StatusOK},
+		},
+		{
+			name:     "Flag",
+			mode:     webhooks.DedupFlag,
+			handled:  []bool{true, true},
+			expected: []int{http.StatusNoContent, http.StatusAccepted},
+		},
+		{
+			name:     "Failed",
+			mode:     webhooks.DedupReject,
+			failures: 2,
+			handled:  []bool{true, true, true, false},
+			expected: []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusNoContent, http.StatusOK},
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var handled bool
+			failures := tc.failures
+			handler := webhooks.Deduplicate(webhooks.NewMemoryDedupStore(10, time.Hour), tc.mode, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handled = true
+				// failed deliveries, e.g. forged ones, are handled again
+				if failures > 0 {
+					failures--
+					http.Error(w, "invalid signature", http.StatusUnauthorized)
+					return
+				}
+				if webhooks.IsDuplicate(r.Context()) {
+					w.WriteHeader(http.StatusAccepted)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}))
+
+			for i := range tc.expected {
+				handled = false
+				req := httptest.NewRequest(http.MethodPost, path, nil)
+				req.Header.Set("X-Github-Event", "push")
+				req.Header.Set("X-Github-Delivery", "72d3162e-cc78-11e3-81ab-4c9367dc0958")
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, req)
+				assert.Equal(tc.expected[i], w.Code)
+				assert.Equal(tc.handled[i], handled)
+			}
+		})
+	}
+}
+
+func TestDeduplicateInFlight(t *testing.T) {
+	assert := require.New(t)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var calls int32
+	handler := webhooks.Deduplicate(webhooks.NewMemoryDedupStore(10, time.Hour), webhooks.DedupReject, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first delivery is slow and fails
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+			<-release
+			http.Error(w, "handler failed", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set("X-Github-Event", "push")
+		req.Header.Set("X-Github-Delivery", "72d3162e-cc78-11e3-81ab-4c9367dc0958")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	first := make(chan int)
+	go func() {
+		first <- send().Code
+	}()
+	<-started
+	// the duplicate arriving meanwhile is retried rather than acknowledged
+	w := send()
+	assert.Equal(http.StatusConflict, w.Code)
+	assert.Equal("1", w.Header().Get("Retry-After"))
+	close(release)
+	assert.Equal(http.StatusInternalServerError, <-first)
+
+	assert.Equal(http.StatusNoContent, send().Code)
+	assert.Equal(http.StatusOK, send().Code)
+	assert.Equal(int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestNewRequest(t *testing.T) {
+	assert := require.New(t)
+	const secret = "IsWishesWereHorsesWedAllBeEatingSteak!"
+	githubHook, err := github.New(github.Options.Secret(secret), github.Options.SignaturePolicy(github.SignatureRequireSHA256))
+	assert.NoError(err)
+	gitlabHook, err := gitlab.New(gitlab.Options.Secret(secret))
+	assert.NoError(err)
+	giteaHook, err := gitea.New(gitea.Options.Secret(secret))
+	assert.NoError(err)
+	gogsHook, err := gogs.New(gogs.Options.Secret(secret))
+	assert.NoError(err)
+	bitbucketHook, err := bitbucket.New(bitbucket.Options.UUID(secret))
+	assert.NoError(err)
+	bitbucketServerHook, err := bitbucketserver.New(bitbucketserver.Options.Secret(secret))
+	assert.NoError(err)
+	dockerHook, err := docker.New()
+	assert.NoError(err)
+
+	tests := []struct {
+		name     string
+		filename string
+		provider webhooks.ProviderName
+		request  func(url string, payload []byte) (*http.Request, error)
+		parse    func(r *http.Request) (interface{}, error)
+		typ      interface{}
+	}{
+		{
+			name:     "GitHub",
+			filename: "testdata/github/push.json",
+			provider: webhooks.GitHub,
+			request: func(url string, payload []byte) (*http.Request, error) {
+				return github.NewRequest(url, github.PushEvent, payload, secret)
+			},
+			parse: func(r *http.Request) (interface{}, error) {
+				return githubHook.Parse(r, github.PushEvent)
+			},
+			typ: github.PushPayload{},
+		},
+		{
+			name:     "GitLab",
+			filename: "testdata/gitlab/push-event.json",
+			provider: webhooks.GitLab,
+			request: func(url string, payload []byte) (*http.Request, error) {
+				return gitlab.NewRequest(url, gitlab.PushEvents, payload, secret)
+			},
+			parse: func(r *http.Request) (interface{}, error) {
+				return gitlabHook.Parse(r, gitlab.PushEvents)
+			},
+			typ: gitlab.PushEventPayload{},
+		},
+		{
+			name:     "Gitea",
+			filename: "testdata/gitea/push-event.json",
+			provider: webhooks.Gitea,
+			request: func(url string, payload []byte) (*http.Request, error) {
+				return gitea.NewRequest(url, gitea.PushEvents, payload, secret)
+			},
+			parse: func(r *http.Request) (interface{}, error) {
+				return giteaHook.Parse(r, gitea.PushEvents)
+			},
+			typ: gitea.PushPayload{},
+		},
+		{
+			name:     "Gogs",
+			filename: "testdata/gitea/push-event.json",
+			provider: webhooks.Gogs,
+			request: func(url string, payload []byte) (*http.Request, error) {
+				return gogs.NewRequest(url, gogs.PushEvent, payload, secret)
+			},
+			parse: func(r *http.Request) (interface{}, error) {
+				return gogsHook.Parse(r, gogs.PushEvent)
+			},
+		},
+		{
+			name:     "Bitbucket",
+			filename: "testdata/bitbucket/repo-push.json",
+			provider: webhooks.Bitbucket,
+			request: func(url string, payload []byte) (*http.Request, error) {
+				return bitbucket.NewRequest(url, bitbucket.RepoPushEvent, payload, secret)
+			},
+			parse: func(r *http.Request) (interface{}, error) {
+				return bitbucketHook.Parse(r, bitbucket.RepoPushEvent)
+			},
+			typ: bitbucket.RepoPushPayload{},
+		},
+		{
+			name:     "BitbucketServer",
+			filename: "testdata/bitbucket-server/repo-refs-changed.json",
+			provider: webhooks.BitbucketServer,
+			request: func(url string, payload []byte) (*http.Request, error) {
+				return bitbucketserver.NewRequest(url, bitbucketserver.RepositoryReferenceChangedEvent, payload, secret)
+			},
+			parse: func(r *http.Request) (interface{}, error) {
+				return bitbucketServerHook.Parse(r, bitbucketserver.RepositoryReferenceChangedEvent)
+			},
+			typ: bitbucketserver.RepositoryReferenceChangedPayload{},
+		},
+		{
+			name:     "Docker",
+			filename: "testdata/docker/docker_hub_build_notice.json",
+			request: func(url string, payload []byte) (*http.Request, error) {
+				return docker.NewRequest(url, payload)
+			},
+			parse: func(r *http.Request) (interface{}, error) {
+				return dockerHook.Parse(r, docker.BuildEvent)
+			},
+			typ: docker.BuildPayload{},
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := os.ReadFile(tc.filename)
+			assert.NoError(err)
+
+			req, err := tc.request("http://localhost"+path, payload)
+			assert.NoError(err)
+			if tc.provider != "" {
+				provider, err := webhooks.Detect(req)
+				assert.NoError(err)
+				assert.Equal(tc.provider, provider)
+			}
+
+			results, err := tc.parse(req)
+			assert.NoError(err)
+			assert.NotNil(results)
+			if tc.typ != nil {
+				assert.Equal(reflect.TypeOf(tc.typ), reflect.TypeOf(results))
+			}
+		})
+	}
+}
+
+func TestCatchAll(t *testing.T) {
+	assert := require.New(t)
+	const secret = "IsWishesWereHorsesWedAllBeEatingSteak!"
+	payload := []byte(`{"action":"checks_requested","merge_group":{"head_sha":"ec26c3e57ca3a959ca5aad62de7213c562f8c821"}}`)
+
+	githubHook, err := github.New(github.Options.Secret(secret), github.Options.CatchAll())
+	assert.NoError(err)
+	gitlabHook, err := gitlab.New(gitlab.Options.Secret(secret), gitlab.Options.CatchAll())
+	assert.NoError(err)
+	giteaHook, err := gitea.New(gitea.Options.Secret(secret), gitea.Options.CatchAll())
+	assert.NoError(err)
+	gogsHook, err := gogs.New(gogs.Options.Secret(secret), gogs.Options.CatchAll())
+	assert.NoError(err)
+	bitbucketHook, err := bitbucket.New(bitbucket.Options.UUID(secret), bitbucket.Options.CatchAll())
+	assert.NoError(err)
+	bitbucketServerHook, err := bitbucketserver.New(bitbucketserver.Options.Secret(secret), bitbucketserver.Options.CatchAll())
+	assert.NoError(err)
+
+	tests := []struct {
+		name string
+		// known is an event the provider package parses, but not specified to Parse
+		known   string
+		request func(event string, payload []byte, secret string) (*http.Request, error)
+		parse   func(r *http.Request) (interface{}, error)
+		forged  error
+	}{
+		{
+			name:  "GitHub",
+			known: string(github.PushEvent),
+			request: func(event string, payload []byte, secret string) (*http.Request, error) {
+				return github.NewRequest("http://localhost"+path, github.Event(event), payload, secret)
+			},
+			parse: func(r *http.Request) (interface{}, error) {
+				return githubHook.Parse(r, github.ReleaseEvent)
+			},
+			forged: github.ErrHMACVerificationFailed,
+		},
+		{
+			name:  "GitLab",
+			known: string(gitlab.PushEvents),
+			request: func(event string, payload []byte, secret string) (*http.Request, error) {
+				return gitlab.NewRequest("http://localhost"+path, gitlab.Event(event), payload, secret)
+			},
+			parse: func(r *http.Request) (interface{}, error) {
+				return gitlabHook.Parse(r, gitlab.TagEvents)
+			},
+			forged: gitlab.ErrGitLabTokenVerificationFailed,
+		},
+		{
+			name:  "Gitea",
+			known: string(gitea.PushEvents),
+			request: func(event string, payload []byte, secret string) (*http.Request, error) {
+				return gitea.NewRequest("http://localhost"+path, gitea.Event(event), payload, secret)
+			},
+			parse: func(r *http.Request) (interface{}, error) {
+				return giteaHook.Parse(r, gitea.ReleaseEvents)
+			},
+			forged: gitea.ErrHMACVerificationFailed,
+		},
+		{
+			name:  "Gogs",
+			known: string(gogs.PushEvent),
+			request: func(event string, payload []byte, secret string) (*http.Request, error) {
+				return gogs.NewRequest("http://localhost"+path, gogs.Event(event), payload, secret)
+			},
+			parse: func(r *http.Request) (interface{}, error) {
+				return gogsHook.Parse(r, gogs.ReleaseEvent)
+			},
+			forged: gogs.ErrHMACVerificationFailed,
+		},
+		{
+			name:  "Bitbucket",
+			known: string(bitbucket.RepoPushEvent),
+			request: func(event string, payload []byte, secret string) (*http.Request, error) {
+				return bitbucket.NewRequest("http://localhost"+path, bitbucket.Event(event), payload, secret)
+			},
+			parse: func(r *http.Request) (interface{}, error) {
+				return bitbucketHook.Parse(r, bitbucket.RepoForkEvent)
+			},
+			forged: bitbucket.ErrUUIDVerificationFailed,
+		},
+		{
+			name:  "BitbucketServer",
+			known: string(bitbucketserver.RepositoryReferenceChangedEvent),
+			request: func(event string, payload []byte, secret string) (*http.Request, error) {
+				return bitbucketserver.NewRequest("http://localhost"+path, bitbucketserver.Event(event), payload, secret)
+			},
+			parse: func(r *http.Request) (interface{}, error) {
+				return bitbucketServerHook.Parse(r, bitbucketserver.RepositoryForkedEvent)
+			},
+			forged: bitbucketserver.ErrHMACVerificationFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			for _, event := range []string{"merge_group", tc.known} {
+				req, err := tc.request(event, payload, secret)
+				assert.NoError(err)
+				pl, err := tc.parse(req)
+				assert.NoError(err, event)
+				raw, ok := pl.(webhooks.RawEvent)
+				assert.True(ok, "expected a webhooks.RawEvent, got %T", pl)
+				assert.Equal(event, raw.Name)
+				assert.Equal(req.Header, raw.Headers)
+				assert.JSONEq(string(payload), string(raw.Body))
+
+				// signatures are verified all the same
+				req, err = tc.request(event, payload, "forged")
+				assert.NoError(err)
+				_, err = tc.parse(req)
+				assert.Equal(tc.forged, err, event)
+
+				req, err = tc.request(event, []byte(`{"action":`), secret)
+				assert.NoError(err)
+				_, err = tc.parse(req)
+				assert.Error(err, event)
+			}
+		})
+	}
+}
+
+type driftCommit struct {
+	ID      string   `json:"id"`
+	Added   []string `json:"added"`
+	Skipped string   `json:"-"`
+}
+
+type driftBase struct {
+	Ref string `json:"ref"`
+}
+
+type driftPayload struct {
+	driftBase
+	After      string                 `json:"after,omitempty"`
+	Commits    []driftCommit          `json:"commits"`
+	HeadCommit *driftCommit           `json:"head_commit"`
+	Labels     map[string]driftCommit `json:"labels"`
+	Extra      json.RawMessage        `json:"extra"`
+	Any        interface{}            `json:"any"`
+	PushedAt   time.Time              `json:"pushed_at"`
+	Forced     bool
+	unexported bool
+}
+
+func TestDetectDrift(t *testing.T) {
+	assert := require.New(t)
+
+	tests := []struct {
+		name    string
+		payload string
+		unknown []string
+		missing []string
+	}{
+		{
+			name:    "Exact",
+			payload: `{"ref": "refs/heads/main", "after": "1", "commits": [], "head_commit": null, "labels": {}, "extra": 1, "any": 1, "pushed_at": "2021-06-01T00:00:00Z", "Forced": true}`,
+		},
+		{
+			name:    "Unknown",
+			payload: `{"ref": "refs/heads/main", "after": "1", "commits": [{"id": "1", "added": [], "author": {"name": "octocat"}}, {"id": "2", "added": [], "url": ""}], "head_commit": {"id": "1", "added": [], "Skipped": ""}, "labels": {"bug": {"id": "1", "added": [], "color": "red"}}, "extra": {"a": 1}, "any": {"a": 1}, "pushed_at": "2021-06-01T00:00:00Z", "forced": true, "unexported": true, "compare": ""}`,
+			unknown: []string{"commits[].author", "commits[].url", "compare", "head_commit.Skipped", "labels.*.color", "unexported"},
+		},
+		{
+			name:    "Missing",
+			payload: `{"commits": [{"id": "1"}, {"added": []}], "labels": {"bug": {}}}`,
+			missing: []string{"Forced", "after", "any", "commits[].added", "commits[].id", "extra", "head_commit", "labels.*.added", "labels.*.id", "pushed_at", "ref"},
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			unknown, missing, err := webhooks.DetectDrift([]byte(tc.payload), driftPayload{})
+			assert.NoError(err)
+			assert.Equal(tc.unknown, unknown)
+			assert.Equal(tc.missing, missing)
+
+			// as decoded by encoding/json
+			var pl driftPayload
+			assert.NoError(json.Unmarshal([]byte(tc.payload), &pl))
+		})
+	}
+
+	_, _, err := webhooks.DetectDrift([]byte(`{"ref":`), &driftPayload{})
+	assert.Error(err)
+}
+
+func TestStrict(t *testing.T) {
+	assert := require.New(t)
+	const secret = "IsWishesWereHorsesWedAllBeEatingSteak!"
+	payload := []byte(`{"ref": "refs/heads/main", "made_up": {"field": true}}`)
+
+	var drifts []webhooks.Drift
+	observer := webhooks.DriftObserverFunc(func(drift webhooks.Drift) {
+		drifts = append(drifts, drift)
+	})
+	githubHook, err := github.New(github.Options.Secret(secret), github.Options.Strict(observer))
+	assert.NoError(err)
+	gitlabHook, err := gitlab.New(gitlab.Options.Secret(secret), gitlab.Options.Strict(observer), gitlab.Options.CatchAll())
+	assert.NoError(err)
+	giteaHook, err := gitea.New(gitea.Options.Secret(secret), gitea.Options.Strict(observer))
+	assert.NoError(err)
+	gogsHook, err := gogs.New(gogs.Options.Secret(secret), gogs.Options.Strict(observer))
+	assert.NoError(err)
+	bitbucketHook, err := bitbucket.New(bitbucket.Options.UUID(secret), bitbucket.Options.Strict(observer))
+	assert.NoError(err)
+	bitbucketServerHook, err := bitbucketserver.New(bitbucketserver.Options.Secret(secret), bitbucketserver.Options.Strict(observer))
+	assert.NoError(err)
+
+	tests := []struct {
+		name     string
+		provider webhooks.ProviderName
+		event    string
+		typ      string
+		request  func() (*http.Request, error)
+		parse    func(r *http.Request) (interface{}, error)
+	}{
+		{
+			name:     "GitHub",
+			provider: webhooks.GitHub,
+			event:    string(github.PushEvent),
+			typ:      "github.PushPayload",
+			request: func() (*http.Request, error) {
+				return github.NewRequest("http://localhost"+path, github.PushEvent, payload, secret)
+			},
+			parse: func(r *http.Request) (interface{}, error) {
+				return githubHook.Parse(r, github.PushEvent)
+			},
+		},
+		{
+			name:     "GitLab",
+			provider: webhooks.GitLab,
+			event:    string(gitlab.PushEvents),
+			typ:      "gitlab.PushEventPayload",
+			request: func() (*http.Request, error) {
+				return gitlab.NewRequest("http://localhost"+path, gitlab.PushEvents, payload, secret)
+			},
+			parse: func(r *http.Request) (interface{}, error) {
+				return gitlabHook.Parse(r, gitlab.PushEvents)
+			},
+		},
+		{
+			name:     "Gitea",
+			provider: webhooks.Gitea,
+			event:    string(gitea.PushEvents),
+			typ:      "gitea.PushPayload",
+			request: func() (*http.Request, error) {
+				return gitea.NewRequest("http://localhost"+path, gitea.PushEvents, payload, secret)
+			},
+			parse: func(r *http.Request) (interface{}, error) {
+				return giteaHook.Parse(r, gitea.PushEvents)
+			},
+		},
+		{
+			name:     "Gogs",
+			provider: webhooks.Gogs,
+			event:    string(gogs.PushEvent),
+			typ:      "gogs.PushPayload",
+			request: func() (*http.Request, error) {
+				return gogs.NewRequest("http://localhost"+path, gogs.PushEvent, payload, secret)
+			},
+			parse: func(r *http.Request) (interface{}, error) {
+				return gogsHook.Parse(r, gogs.PushEvent)
+			},
+		},
+		{
+			name:     "Bitbucket",
+			provider: webhooks.Bitbucket,
+			event:    string(bitbucket.RepoPushEvent),
+			typ:      "bitbucket.RepoPushPayload",
+			request: func() (*http.Request, error) {
+				return bitbucket.NewRequest("http://localhost"+path, bitbucket.RepoPushEvent, payload, secret)
+			},
+			parse: func(r *http.Request) (interface{}, error) {
+				return bitbucketHook.Parse(r, bitbucket.RepoPushEvent)
+			},
+		},
+		{
+			name:     "BitbucketServer",
+			provider: webhooks.BitbucketServer,
+			event:    string(bitbucketserver.RepositoryReferenceChangedEvent),
+			typ:      "bitbucketserver.RepositoryReferenceChangedPayload",
+			request: func() (*http.Request, error) {
+				return bitbucketserver.NewRequest("http://localhost"+path, bitbucketserver.RepositoryReferenceChangedEvent, payload, secret)
+			},
+			parse: func(r *http.Request) (interface{}, error) {
+				return bitbucketServerHook.Parse(r, bitbucketserver.RepositoryReferenceChangedEvent)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			drifts = nil
+			req, err := tc.request()
+			assert.NoError(err)
+			_, err = tc.parse(req)
+			assert.NoError(err)
+			assert.Len(drifts, 1)
+			drift := drifts[0]
+			assert.Equal(tc.provider, drift.Provider)
+			assert.Equal(tc.event, drift.Event)
+			assert.Equal(webhooks.DeliveryID(req.Header), drift.Delivery)
+			assert.Equal(tc.typ, drift.Type)
+			assert.Contains(drift.Unknown, "made_up")
+			assert.NotContains(drift.Unknown, "made_up.field")
+			assert.NotEmpty(drift.Missing)
+
+			// deliveries failing verification aren't inspected
+			drifts = nil
+			req, err = tc.request()
+			assert.NoError(err)
+			req.Header = req.Header.Clone()
+			for _, key := range []string{"X-Hub-Signature-256", "X-Hub-Signature", "X-Gitlab-Token", "X-Gitea-Signature", "X-Gogs-Signature", "X-Hook-UUID"} {
+				if req.Header.Get(key) != "" {
+					req.Header.Set(key, "forged")
+				}
+			}
+			_, err = tc.parse(req)
+			assert.Error(err)
+			assert.Empty(drifts)
+		})
+	}
+
+	// nor are the raw events of catch-all mode
+	drifts = nil
+	req, err := gitlab.NewRequest("http://localhost"+path, "Merge Group Hook", payload, secret)
+	assert.NoError(err)
+	_, err = gitlabHook.Parse(req, gitlab.PushEvents)
+	assert.NoError(err)
+	assert.Empty(drifts)
+}
+
+func TestMatchGlob(t *testing.T) {
+	assert := require.New(t)
+	tests := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{pattern: "refs/heads/main", name: "refs/heads/main", match: true},
+		{pattern: "refs/heads/*", name: "refs/heads/main", match: true},
+		{pattern: "refs/heads/*", name: "refs/heads/release/1.0", match: false},
+		{pattern: "refs/heads/**", name: "refs/heads/release/1.0", match: true},
+		{pattern: "services/api/**", name: "services/api", match: true},
+		{pattern: "services/api/**", name: "services/apis/main.go", match: false},
+		{pattern: "**/*.go", name: "main.go", match: true},
+		{pattern: "**/*.go", name: "services/api/main.go", match: true},
+		{pattern: "services/**/testdata/*.json", name: "services/api/v1/testdata/push.json", match: true},
+		{pattern: "services/**/testdata/*.json", name: "services/api/v1/push.json", match: false},
+		{pattern: `*\[bot\]`, name: "dependabot[bot]", match: true},
+		{pattern: `*\[bot\]`, name: "robot", match: false},
+	}
+
+	for _, tc := range tests {
+		match, err := webhooks.MatchGlob(tc.pattern, tc.name)
+		assert.NoError(err)
+		assert.Equal(tc.match, match, "%s %s", tc.pattern, tc.name)
+	}
+
+	_, err := webhooks.MatchGlob("refs/heads/[", "refs/heads/main")
+	assert.EqualError(err, "syntax error in pattern")
+}
+
+func TestFilter(t *testing.T) {
+	assert := require.New(t)
+
+	var push github.PushPayload
+	payload, err := os.ReadFile("testdata/github/push.json")
+	assert.NoError(err)
+	assert.NoError(json.Unmarshal(payload, &push))
+	var pr github.PullRequestPayload
+	payload, err = os.ReadFile("testdata/github/pull-request.json")
+	assert.NoError(err)
+	assert.NoError(json.Unmarshal(payload, &pr))
+	var gitlabPush gitlab.PushEventPayload
+	payload, err = os.ReadFile("testdata/gitlab/push-event.json")
+	assert.NoError(err)
+	assert.NoError(json.Unmarshal(payload, &gitlabPush))
+
+	events, err := github.Normalize(push)
+	assert.NoError(err)
+	pushEvent := events[0]
+	events, err = github.Normalize(pr)
+	assert.NoError(err)
+	prEvent := events[0]
+	events, err = gitlab.Normalize(gitlabPush)
+	assert.NoError(err)
+	gitlabPushEvent := events[0]
+
+	tests := []struct {
+		name   string
+		filter webhooks.Filter
+		event  webhooks.NormalizedEvent
+		match  bool
+	}{
+		{
+			name:  "Empty",
+			event: pushEvent,
+			match: true,
+		},
+		{
+			name:   "Kind",
+			filter: webhooks.Filter{Kinds: []webhooks.EventKind{webhooks.PullRequestKind}},
+			event:  pushEvent,
+		},
+		{
+			name:   "Ref",
+			filter: webhooks.Filter{Refs: []string{"refs/heads/main", "refs/heads/master"}},
+			event:  pushEvent,
+			match:  true,
+		},
+		{
+			name:   "OtherRef",
+			filter: webhooks.Filter{Refs: []string{"refs/heads/release/**"}},
+			event:  pushEvent,
+		},
+		{
+			name:   "PullRequestTargetBranch",
+			filter: webhooks.Filter{Refs: []string{"refs/heads/master"}, Actions: []string{webhooks.ActionOpened}},
+			event:  prEvent,
+			match:  true,
+		},
+		{
+			name:   "Action",
+			filter: webhooks.Filter{Actions: []string{webhooks.ActionClosed}},
+			event:  prEvent,
+		},
+		{
+			name:   "PushAction",
+			filter: webhooks.Filter{Actions: []string{webhooks.ActionUpdated}},
+			event:  pushEvent,
+			match:  true,
+		},
+		{
+			name:   "AddedPath",
+			filter: webhooks.Filter{Paths: []string{"*.yaml", ".*.yaml"}},
+			event:  pushEvent,
+			match:  true,
+		},
+		{
+			name:   "ModifiedPath",
+			filter: webhooks.Filter{Paths: []string{"app/**"}},
+			event:  gitlabPushEvent,
+			match:  true,
+		},
+		{
+			name:   "UnchangedPath",
+			filter: webhooks.Filter{Paths: []string{"services/api/**"}},
+			event:  pushEvent,
+		},
+		{
+			name:   "PathsIgnoredForPullRequests",
+			filter: webhooks.Filter{Paths: []string{"services/api/**"}},
+			event:  prEvent,
+			match:  true,
+		},
+		{
+			name:   "Sender",
+			filter: webhooks.Filter{Senders: []string{"baxter*"}},
+			event:  prEvent,
+			match:  true,
+		},
+		{
+			name:   "OtherSender",
+			filter: webhooks.Filter{Senders: []string{"baxter*"}},
+			event:  pushEvent,
+		},
+		{
+			name:   "ExcludedSender",
+			filter: webhooks.Filter{ExcludeSenders: []string{`*\[bot\]`, "binkkatal"}},
+			event:  pushEvent,
+		},
+		{
+			name:   "GitLabSender",
+			filter: webhooks.Filter{ExcludeSenders: []string{`*\[bot\]`}, Refs: []string{"refs/heads/master"}},
+			event:  gitlabPushEvent,
+			match:  true,
+		},
+		{
+			name:   "IssueWithoutRef",
+			filter: webhooks.Filter{Refs: []string{"**"}},
+			event:  webhooks.NormalizedIssue{Action: webhooks.ActionOpened},
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(tc.filter.Validate())
+			assert.Equal(tc.match, tc.filter.Match(tc.event))
+		})
+	}
+
+	filter := webhooks.Filter{Kinds: []webhooks.EventKind{webhooks.PushKind}}
+	assert.Equal([]webhooks.NormalizedEvent{pushEvent, gitlabPushEvent}, filter.Select([]webhooks.NormalizedEvent{pushEvent, prEvent, gitlabPushEvent}))
+
+	err = webhooks.Filter{Paths: []string{"services/[api"}}.Validate()
+	assert.EqualError(err, `syntax error in pattern: "services/[api"`)
+}
+
+func TestReadBody(t *testing.T) {
+	assert := require.New(t)
+	tests := []struct {
+		name string
+		body string
+		max  int64
+		err  error
+	}{
+		{name: "UnderLimit", body: "{}", max: 3},
+		{name: "AtLimit", body: "{ }", max: 3},
+		{name: "OverLimit", body: "{  }", max: 3, err: webhooks.ErrPayloadTooLarge},
+		{name: "NoLimit", body: strings.Repeat(" ", 1<<16), max: 0},
+		{name: "Empty", body: "", max: 3},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := webhooks.ReadBody(strings.NewReader(tc.body), tc.max)
+			assert.Equal(tc.err, err)
+			if tc.err == nil {
+				assert.Equal(tc.body, string(body))
+			}
+
+			// a byte at a time, as slow clients deliver it
+			body, err = ioutil.ReadAll(webhooks.LimitReader(iotest.OneByteReader(strings.NewReader(tc.body)), tc.max))
+			assert.Equal(tc.err, err)
+			if tc.err == nil {
+				assert.Equal(tc.body, string(body))
+			} else {
+				assert.Len(body, int(tc.max))
+			}
+		})
+	}
+}
+
+func TestOutcome(t *testing.T) {
+	assert := require.New(t)
+	outcomes := map[error]string{github.ErrHMACVerificationFailed: "hmac_verification_failed"}
+	var syntaxErr error = &json.SyntaxError{}
+
+	assert.Equal(webhooks.OutcomeOK, webhooks.Outcome(nil, outcomes))
+	assert.Equal("hmac_verification_failed", webhooks.Outcome(github.ErrHMACVerificationFailed, outcomes))
+	assert.Equal(webhooks.OutcomeSecretLookup, webhooks.Outcome(fmt.Errorf("%w: vault down", webhooks.ErrSecretLookup), outcomes))
+	assert.Equal(webhooks.OutcomePayloadTooLarge, webhooks.Outcome(webhooks.ErrPayloadTooLarge, outcomes))
+	assert.Equal(webhooks.OutcomeInvalidJSON, webhooks.Outcome(syntaxErr, outcomes))
+	assert.Equal(webhooks.OutcomeInvalidJSON, webhooks.Outcome(io.ErrUnexpectedEOF, outcomes))
+	assert.Equal(webhooks.OutcomeError, webhooks.Outcome(errors.New("boom"), outcomes))
+}
+
+func TestLogParse(t *testing.T) {
+	assert := require.New(t)
+	tests := []struct {
+		name         string
+		outcome      string
+		event        string
+		verification bool
+		err          error
+		record       string
+	}{
+		{
+			name:    "Parsed",
+			outcome: webhooks.OutcomeOK,
+			event:   "push",
+			record:  `DEBUG delivery parsed provider="github" event="push" delivery="id" outcome="ok" size="2" duration="1ms"`,
+		},
+		{
+			name:    "Unknown",
+			outcome: webhooks.OutcomeEventNotFound,
+			event:   webhooks.UnknownEvent,
+			err:     github.ErrEventNotFound,
+			record:  `INFO event not parsed provider="github" event="unknown" delivery="id" outcome="event_not_found" size="2" duration="1ms" error="event not defined to be parsed"`,
+		},
+		{
+			name:         "Verification",
+			outcome:      "hmac_verification_failed",
+			event:        "push",
+			verification: true,
+			err:          github.ErrHMACVerificationFailed,
+			record:       `WARN delivery verification failed`,
+		},
+		{
+			name:         "MissingSignature",
+			outcome:      "missing_hub_signature_header",
+			event:        "push",
+			verification: true,
+			err:          github.ErrMissingHubSignatureHeader,
+			record:       `WARN delivery verification failed`,
+		},
+		{
+			name:         "UnknownEventVerification",
+			outcome:      "hmac_verification_failed",
+			event:        webhooks.UnknownEvent,
+			verification: true,
+			err:          github.ErrHMACVerificationFailed,
+			record:       `WARN delivery verification failed`,
+		},
+		{
+			name:    "SignatureOutcome",
+			outcome: "malformed_signature_label",
+			event:   "push",
+			err:     errors.New("signature"),
+			record:  `WARN delivery parse failed`,
+		},
+		{
+			name:    "Decode",
+			outcome: webhooks.OutcomeInvalidJSON,
+			event:   "push",
+			err:     errors.New("unexpected end of JSON input"),
+			record:  `WARN delivery parse failed`,
+		},
+		{
+			name:    "SecretLookup",
+			outcome: webhooks.OutcomeSecretLookup,
+			event:   "push",
+			err:     webhooks.ErrSecretLookup,
+			record:  `ERROR secret lookup failed`,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			logger := webhooks.StdLogger(log.New(&b, "", 0))
+			o := webhooks.ParseObservation{
+				Provider:           webhooks.GitHub,
+				Event:              tc.event,
+				Outcome:            tc.outcome,
+				VerificationFailed: tc.verification,
+				Size:               2,
+				Duration:           time.Millisecond,
+			}
+			webhooks.LogParse(logger, o, "id", tc.err, nil)
+			assert.True(strings.HasPrefix(b.String(), tc.record), b.String())
+			assert.NotContains(b.String(), "body=")
+
+			b.Reset()
+			webhooks.LogParse(logger, o, "id", tc.err, []byte("{}"))
+			assert.Contains(b.String(), `body="{}"`)
+		})
+	}
+}
+
+func TestLogParseVerification(t *testing.T) {
+	assert := require.New(t)
+
+	var b strings.Builder
+	logger := webhooks.StdLogger(log.New(&b, "", 0))
+	bitbucketHook, err := bitbucket.New(bitbucket.Options.UUID("MY_UUID"), bitbucket.Options.Logger(logger))
+	assert.NoError(err)
+	gitlabHook, err := gitlab.New(gitlab.Options.Secret("sampleToken!"), gitlab.Options.Logger(logger))
+	assert.NoError(err)
+
+	tests := []struct {
+		name    string
+		parse   func(r *http.Request) error
+		headers http.Header
+		outcome string
+	}{
+		{
+			name: "BitbucketMissingUUID",
+			parse: func(r *http.Request) error {
+				_, err := bitbucketHook.Parse(r, bitbucket.RepoPushEvent)
+				return err
+			},
+			headers: http.Header{"X-Event-Key": []string{"repo:unknown"}},
+			outcome: `event="unknown" delivery="" outcome="missing_hook_uuid_header"`,
+		},
+		{
+			name: "GitLabMissingToken",
+			parse: func(r *http.Request) error {
+				_, err := gitlabHook.Parse(r, gitlab.PushEvents)
+				return err
+			},
+			headers: http.Header{"X-Gitlab-Event": []string{"Push Hook"}},
+			outcome: `outcome="gitlab_token_verification_failed"`,
+		},
+		{
+			name: "GitLabTokenMismatch",
+			parse: func(r *http.Request) error {
+				_, err := gitlabHook.Parse(r, gitlab.PushEvents)
+				return err
+			},
+			headers: http.Header{"X-Gitlab-Event": []string{"Push Hook"}, "X-Gitlab-Token": []string{"badsampleToken!!"}},
+			outcome: `outcome="gitlab_token_verification_failed"`,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			b.Reset()
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader("{}"))
+			for name, values := range tc.headers {
+				req.Header[name] = values
+			}
+			assert.Error(tc.parse(req))
+			assert.True(strings.HasPrefix(b.String(), "WARN delivery verification failed"), b.String())
+			assert.Contains(b.String(), tc.outcome)
+		})
+	}
+}
@@ -0,0 +1,349 @@
+// Package webhookstest builds realistic signed deliveries from the fixtures in
+// the testdata directory of the module, so handlers can be tested against the
+// payloads the forges actually send
+package webhookstest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+	"github.com/heitormejias/golang-webhooks/bitbucket"
+	bitbucketserver "github.com/heitormejias/golang-webhooks/bitbucket-server"
+	"github.com/heitormejias/golang-webhooks/docker"
+	"github.com/heitormejias/golang-webhooks/gitea"
+	"github.com/heitormejias/golang-webhooks/github"
+	"github.com/heitormejias/golang-webhooks/gitlab"
+	"github.com/heitormejias/golang-webhooks/gogs"
+)
+
+// webhookstest errors
+var (
+	// ErrUnknownProvider is returned for providers without fixtures
+	ErrUnknownProvider = errors.New("unknown provider")
+	// ErrNoFixtureName is returned for the deliveries whose fixture can't be named
+	ErrNoFixtureName = errors.New("no fixture name for the delivery")
+)
+
+// Target is the URL of the built requests
+const Target = "http://localhost/webhooks"
+
+// Testdata is the directory holding the fixtures, one sub directory per provider.
+// It is found from the location of this package source and may be overridden
+// when the source is not available, e.g. in binaries built with -trimpath
+var Testdata = testdata()
+
+func testdata() string {
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		return "testdata"
+	}
+	return filepath.Join(filepath.Dir(file), "..", "testdata")
+}
+
+// dirs are the fixture directories of the providers
+var dirs = map[webhooks.ProviderName]string{
+	webhooks.GitHub:          "github",
+	webhooks.GitLab:          "gitlab",
+	webhooks.Gitea:           "gitea",
+	webhooks.Gogs:            "gogs",
+	webhooks.Bitbucket:       "bitbucket",
+	webhooks.BitbucketServer: "bitbucket-server",
+	webhooks.Docker:          "docker",
+}
+
+func dir(provider webhooks.ProviderName) (string, error) {
+	name, ok := dirs[provider]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownProvider, provider)
+	}
+	return filepath.Join(Testdata, name), nil
+}
+
+// fixtureNames are the fixtures of the events whose name doesn't follow the
+// naming of their provider
+var fixtureNames = map[webhooks.ProviderName]map[string]string{
+	webhooks.GitHub: {
+		"deploy_key":        "deploy_key.json",
+		"workflow_dispatch": "workflow_dispatch.json",
+		"workflow_job":      "workflow_job.json",
+		"workflow_run":      "workflow_run.json",
+	},
+	webhooks.GitLab: {
+		"Tag Push Hook":  "tag-event.json",
+		"Wiki Page Hook": "wikipage-event.json",
+	},
+	webhooks.Bitbucket: {
+		"repo:commit_comment_created": "commit-comment-created.json",
+		"pullrequest:unapproved":      "pull-request-approval-removed.json",
+		"pullrequest:fulfilled":       "pull-request-merged.json",
+		"pullrequest:rejected":        "pull-request-declined.json",
+	},
+}
+
+// FixturePath returns the path relative to Testdata of the fixture of an event
+// following the naming of the testdata directory, e.g. github/pull-request.json
+// for the GitHub pull_request event or gitlab/merge-request-event.json for the
+// GitLab Merge Request Hook. Events whose fixture depends on the payload, the
+// GitLab Note Hook and System Hook, return ErrNoFixtureName: use
+// DeliveryFixturePath for them
+func FixturePath(provider webhooks.ProviderName, event string) (string, error) {
+	return DeliveryFixturePath(provider, event, nil)
+}
+
+// DeliveryFixturePath returns the path relative to Testdata of the fixture of a
+// delivery like FixturePath, the GitLab Note Hook and System Hook fixtures are
+// named from the body: gitlab/comment-issue-event.json for the notes on issues
+// or gitlab/system-push-event.json for the push system hooks, for instance.
+// ErrNoFixtureName is returned when the body doesn't tell
+func DeliveryFixturePath(provider webhooks.ProviderName, event string, body []byte) (string, error) {
+	dir, ok := dirs[provider]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownProvider, provider)
+	}
+	if name, ok := fixtureNames[provider][event]; ok {
+		return filepath.Join(dir, name), nil
+	}
+
+	var name string
+	switch provider {
+	case webhooks.GitHub:
+		name = strings.ReplaceAll(event, "_", "-")
+	case webhooks.GitLab:
+		switch gitlab.Event(event) {
+		case gitlab.CommentEvents, gitlab.SystemHookEvents:
+			var err error
+			if name, err = gitlabFixtureName(gitlab.Event(event), body); err != nil {
+				return "", err
+			}
+		default:
+			name = strings.ToLower(strings.TrimSuffix(event, " Hook"))
+			name = strings.ReplaceAll(name, " ", "-") + "-event"
+		}
+	case webhooks.Gitea, webhooks.Gogs:
+		name = strings.ReplaceAll(event, "_", "-") + "-event"
+	case webhooks.Bitbucket, webhooks.BitbucketServer:
+		name = strings.NewReplacer("pullrequest", "pull-request", ":", "-", "_", "-").Replace(event)
+	case webhooks.Docker:
+		name = "docker_hub_build_notice"
+	}
+	return filepath.Join(dir, name+".json"), nil
+}
+
+// gitlabNoteables and gitlabSystemEvents name the fixtures of the GitLab notes
+// by noteable type and of the system hooks by event name
+var (
+	gitlabNoteables = map[string]string{
+		"Commit":       "comment-commit-event",
+		"Issue":        "comment-issue-event",
+		"MergeRequest": "comment-merge-request-event",
+		"Snippet":      "comment-snippet-event",
+	}
+	gitlabSystemEvents = map[string]string{
+		"push":          "system-push-event",
+		"tag_push":      "system-tag-event",
+		"merge_request": "system-merge-request-event",
+	}
+)
+
+// gitlabFixtureName names the fixture of a GitLab Note Hook or System Hook from
+// its body, merge request system hooks carry their object_kind only
+func gitlabFixtureName(event gitlab.Event, body []byte) (string, error) {
+	var pl struct {
+		ObjectKind       string `json:"object_kind"`
+		EventName        string `json:"event_name"`
+		ObjectAttributes struct {
+			NoteableType string `json:"noteable_type"`
+		} `json:"object_attributes"`
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &pl); err != nil {
+			return "", fmt.Errorf("%w: %s: %v", ErrNoFixtureName, event, err)
+		}
+	}
+
+	var name string
+	var ok bool
+	if event == gitlab.CommentEvents {
+		name, ok = gitlabNoteables[pl.ObjectAttributes.NoteableType]
+	} else if pl.EventName != "" {
+		name, ok = gitlabSystemEvents[pl.EventName]
+	} else {
+		name, ok = gitlabSystemEvents[pl.ObjectKind]
+	}
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNoFixtureName, event)
+	}
+	return name, nil
+}
+
+// Fixture returns the content of the named fixture of the provider, e.g. push.json
+func Fixture(provider webhooks.ProviderName, name string) ([]byte, error) {
+	dir, err := dir(provider)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(filepath.Join(dir, name))
+}
+
+// Fixtures returns the sorted names of the fixtures of the provider
+func Fixtures(provider webhooks.ProviderName) ([]string, error) {
+	dir, err := dir(provider)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(paths))
+	for _, path := range paths {
+		names = append(names, filepath.Base(path))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Delivery describes a fixture delivery
+type Delivery struct {
+	Provider webhooks.ProviderName
+	// Event is the value of the event header, e.g. "push" or "Push Hook"
+	Event string
+	// Fixture is the file name of the payload in the provider directory
+	Fixture string
+	// Secret signs the delivery, it is the webhook UUID for Bitbucket. Deliveries
+	// without secret are not signed
+	Secret string
+}
+
+// String identifies the delivery in failure messages
+func (d Delivery) String() string {
+	return fmt.Sprintf("%s %s %s", d.Provider, d.Event, d.Fixture)
+}
+
+// NewRequest returns the signed request of the delivery to Target, built with
+// the NewRequest function of the provider package
+func NewRequest(d Delivery) (*http.Request, error) {
+	payload, err := Fixture(d.Provider, d.Fixture)
+	if err != nil {
+		return nil, err
+	}
+
+	switch d.Provider {
+	case webhooks.GitHub:
+		return github.NewRequest(Target, github.Event(d.Event), payload, d.Secret)
+	case webhooks.GitLab:
+		return gitlab.NewRequest(Target, gitlab.Event(d.Event), payload, d.Secret)
+	case webhooks.Gitea:
+		return gitea.NewRequest(Target, gitea.Event(d.Event), payload, d.Secret)
+	case webhooks.Gogs:
+		return gogs.NewRequest(Target, gogs.Event(d.Event), payload, d.Secret)
+	case webhooks.Bitbucket:
+		return bitbucket.NewRequest(Target, bitbucket.Event(d.Event), payload, d.Secret)
+	case webhooks.BitbucketServer:
+		return bitbucketserver.NewRequest(Target, bitbucketserver.Event(d.Event), payload, d.Secret)
+	case webhooks.Docker:
+		return docker.NewRequest(Target, payload)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, d.Provider)
+	}
+}
+
+// Parse builds the request of the delivery and parses it with the Parse method
+// of a provider Webhook configured with the delivery secret, the event of the
+// delivery being the only one accepted
+func Parse(d Delivery) (interface{}, error) {
+	req, err := NewRequest(d)
+	if err != nil {
+		return nil, err
+	}
+
+	switch d.Provider {
+	case webhooks.GitHub:
+		hook, err := github.New(github.Options.Secret(d.Secret))
+		if err != nil {
+			return nil, err
+		}
+		return hook.Parse(req, github.Event(d.Event))
+	case webhooks.GitLab:
+		hook, err := gitlab.New(gitlab.Options.Secret(d.Secret))
+		if err != nil {
+			return nil, err
+		}
+		return hook.Parse(req, gitlab.Event(d.Event))
+	case webhooks.Gitea:
+		hook, err := gitea.New(gitea.Options.Secret(d.Secret))
+		if err != nil {
+			return nil, err
+		}
+		return hook.Parse(req, gitea.Event(d.Event))
+	case webhooks.Gogs:
+		hook, err := gogs.New(gogs.Options.Secret(d.Secret))
+		if err != nil {
+			return nil, err
+		}
+		return hook.Parse(req, gogs.Event(d.Event))
+	case webhooks.Bitbucket:
+		hook, err := bitbucket.New(bitbucket.Options.UUID(d.Secret))
+		if err != nil {
+			return nil, err
+		}
+		return hook.Parse(req, bitbucket.Event(d.Event))
+	case webhooks.BitbucketServer:
+		hook, err := bitbucketserver.New(bitbucketserver.Options.Secret(d.Secret))
+		if err != nil {
+			return nil, err
+		}
+		return hook.Parse(req, bitbucketserver.Event(d.Event))
+	case webhooks.Docker:
+		hook, err := docker.New()
+		if err != nil {
+			return nil, err
+		}
+		return hook.Parse(req, docker.BuildEvent)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, d.Provider)
+	}
+}
+
+// TB is the part of testing.TB used to report failures
+type TB interface {
+	Helper()
+	Fatalf(format string, args ...interface{})
+}
+
+// AssertPayload parses the delivery and fails the test unless parsing succeeds
+// and the payload has the type of expected, the payload is returned
+func AssertPayload(t TB, d Delivery, expected interface{}) interface{} {
+	t.Helper()
+	payload, err := Parse(d)
+	if err != nil {
+		t.Fatalf("%s: parse failed: %v", d, err)
+		return nil
+	}
+	if want, got := reflect.TypeOf(expected), reflect.TypeOf(payload); want != got {
+		t.Fatalf("%s: expected payload %v, got %v", d, want, got)
+	}
+	return payload
+}
+
+// Serve hands the request of the delivery to the handler, usually the Router of
+// the provider package, and returns the recorded response
+func Serve(handler http.Handler, d Delivery) (*httptest.ResponseRecorder, error) {
+	req, err := NewRequest(d)
+	if err != nil {
+		return nil, err
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w, nil
+}
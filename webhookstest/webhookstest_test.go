@@ -0,0 +1,323 @@
+package webhookstest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	webhooks "github.com/heitormejias/golang-webhooks"
+	"github.com/heitormejias/golang-webhooks/bitbucket"
+	bitbucketserver "github.com/heitormejias/golang-webhooks/bitbucket-server"
+	"github.com/heitormejias/golang-webhooks/docker"
+	"github.com/heitormejias/golang-webhooks/gitea"
+	"github.com/heitormejias/golang-webhooks/github"
+	"github.com/heitormejias/golang-webhooks/gitlab"
+	"github.com/heitormejias/golang-webhooks/gogs"
+)
+
+var providers = []webhooks.ProviderName{
+	webhooks.GitHub,
+	webhooks.GitLab,
+	webhooks.Gitea,
+	webhooks.Gogs,
+	webhooks.Bitbucket,
+	webhooks.BitbucketServer,
+	webhooks.Docker,
+}
+
+func TestFixtures(t *testing.T) {
+	assert := require.New(t)
+	for _, provider := range providers {
+		names, err := Fixtures(provider)
+		assert.NoError(err)
+		assert.NotEmpty(names, provider)
+		for _, name := range names {
+			req, err := NewRequest(Delivery{Provider: provider, Event: "test", Fixture: name, Secret: "secret"})
+			assert.NoError(err, name)
+			assert.Equal(http.MethodPost, req.Method)
+			if provider != webhooks.Docker {
+				detected, err := webhooks.Detect(req)
+				assert.NoError(err, name)
+				assert.Equal(provider, detected, name)
+			}
+		}
+	}
+
+	_, err := NewRequest(Delivery{Provider: "sourcehut", Fixture: "push.json"})
+	assert.True(errors.Is(err, ErrUnknownProvider))
+}
+
+func TestFixturePath(t *testing.T) {
+	assert := require.New(t)
+
+	tests := []struct {
+		provider webhooks.ProviderName
+		event    string
+		path     string
+	}{
+		{provider: webhooks.GitHub, event: string(github.PullRequestReviewCommentEvent), path: "github/pull-request-review-comment.json"},
+		{provider: webhooks.GitHub, event: string(github.PushEvent), path: "github/push.json"},
+		{provider: webhooks.GitLab, event: string(gitlab.MergeRequestEvents), path: "gitlab/merge-request-event.json"},
+		{provider: webhooks.GitLab, event: string(gitlab.TagEvents), path: "gitlab/tag-event.json"},
+		{provider: webhooks.GitLab, event: string(gitlab.PipelineEvents), path: "gitlab/pipeline-event.json"},
+		{provider: webhooks.Gitea, event: string(gitea.PushEvents), path: "gitea/push-event.json"},
+		{provider: webhooks.Gogs, event: "create", path: "gogs/create-event.json"},
+		{provider: webhooks.Bitbucket, event: string(bitbucket.RepoCommitStatusUpdatedEvent), path: "bitbucket/repo-commit-status-updated.json"},
+		{provider: webhooks.Bitbucket, event: string(bitbucket.PullRequestCommentCreatedEvent), path: "bitbucket/pull-request-comment-created.json"},
+		{provider: webhooks.Bitbucket, event: string(bitbucket.PullRequestMergedEvent), path: "bitbucket/pull-request-merged.json"},
+		{provider: webhooks.Bitbucket, event: string(bitbucket.RepoCommitCommentCreatedEvent), path: "bitbucket/commit-comment-created.json"},
+		{provider: webhooks.BitbucketServer, event: string(bitbucketserver.PullRequestReviewerNeedsWorkEvent), path: "bitbucket-server/pr-reviewer-needs-work.json"},
+		{provider: webhooks.BitbucketServer, event: string(bitbucketserver.RepositoryReferenceChangedEvent), path: "bitbucket-server/repo-refs-changed.json"},
+		{provider: webhooks.Docker, event: string(docker.BuildEvent), path: "docker/docker_hub_build_notice.json"},
+	}
+
+	for _, tc := range tests {
+		path, err := FixturePath(tc.provider, tc.event)
+		assert.NoError(err)
+		assert.Equal(filepath.FromSlash(tc.path), path)
+		assert.FileExists(filepath.Join(Testdata, path))
+	}
+
+	_, err := FixturePath("sourcehut", "push")
+	assert.True(errors.Is(err, ErrUnknownProvider))
+	_, err = FixturePath(webhooks.GitLab, string(gitlab.CommentEvents))
+	assert.True(errors.Is(err, ErrNoFixtureName))
+	_, err = FixturePath(webhooks.GitLab, string(gitlab.SystemHookEvents))
+	assert.True(errors.Is(err, ErrNoFixtureName))
+}
+
+func TestDeliveryFixturePath(t *testing.T) {
+	assert := require.New(t)
+
+	tests := []struct {
+		event gitlab.Event
+		body  string
+		path  string
+	}{
+		{event: gitlab.CommentEvents, body: `{"object_kind": "note", "object_attributes": {"noteable_type": "Commit"}}`, path: "gitlab/comment-commit-event.json"},
+		{event: gitlab.CommentEvents, body: `{"object_kind": "note", "object_attributes": {"noteable_type": "MergeRequest"}}`, path: "gitlab/comment-merge-request-event.json"},
+		{event: gitlab.SystemHookEvents, body: `{"event_name": "push"}`, path: "gitlab/system-push-event.json"},
+		{event: gitlab.SystemHookEvents, body: `{"event_name": "tag_push"}`, path: "gitlab/system-tag-event.json"},
+		{event: gitlab.SystemHookEvents, body: `{"object_kind": "merge_request"}`, path: "gitlab/system-merge-request-event.json"},
+		{event: gitlab.PushEvents, body: `{"object_kind": "push"}`, path: "gitlab/push-event.json"},
+	}
+
+	for _, tc := range tests {
+		path, err := DeliveryFixturePath(webhooks.GitLab, string(tc.event), []byte(tc.body))
+		assert.NoError(err)
+		assert.Equal(filepath.FromSlash(tc.path), path)
+	}
+
+	for _, body := range []string{`{"object_kind": "note", "object_attributes": {"noteable_type": "Epic"}}`, `{}`, `{`} {
+		_, err := DeliveryFixturePath(webhooks.GitLab, string(gitlab.CommentEvents), []byte(body))
+		assert.True(errors.Is(err, ErrNoFixtureName), body)
+	}
+	_, err := DeliveryFixturePath(webhooks.GitLab, string(gitlab.SystemHookEvents), []byte(`{"event_name": "project_create"}`))
+	assert.True(errors.Is(err, ErrNoFixtureName))
+}
+
+// events are the event constants of the providers
+var events = map[webhooks.ProviderName][]string{
+	webhooks.GitHub: {
+		string(github.CheckRunEvent), string(github.CheckSuiteEvent), string(github.CommitCommentEvent),
+		string(github.CreateEvent), string(github.DeleteEvent), string(github.DeployKeyEvent),
+		string(github.DeploymentEvent), string(github.DeploymentStatusEvent), string(github.ForkEvent),
+		string(github.GollumEvent), string(github.InstallationEvent), string(github.InstallationRepositoriesEvent),
+		string(github.IntegrationInstallationEvent), string(github.IntegrationInstallationRepositoriesEvent),
+		string(github.IssueCommentEvent), string(github.IssuesEvent), string(github.LabelEvent),
+		string(github.MemberEvent), string(github.MembershipEvent), string(github.MilestoneEvent),
+		string(github.MetaEvent), string(github.OrganizationEvent), string(github.OrgBlockEvent),
+		string(github.PageBuildEvent), string(github.PingEvent), string(github.ProjectCardEvent),
+		string(github.ProjectColumnEvent), string(github.ProjectEvent), string(github.PublicEvent),
+		string(github.PullRequestEvent), string(github.PullRequestReviewEvent), string(github.PullRequestReviewCommentEvent),
+		string(github.PushEvent), string(github.ReleaseEvent), string(github.RepositoryEvent),
+		string(github.RepositoryVulnerabilityAlertEvent), string(github.SecurityAdvisoryEvent), string(github.StatusEvent),
+		string(github.TeamEvent), string(github.TeamAddEvent), string(github.WatchEvent),
+		string(github.WorkflowDispatchEvent), string(github.WorkflowJobEvent), string(github.WorkflowRunEvent),
+	},
+	webhooks.GitLab: {
+		string(gitlab.PushEvents), string(gitlab.TagEvents), string(gitlab.IssuesEvents),
+		string(gitlab.ConfidentialIssuesEvents), string(gitlab.CommentEvents), string(gitlab.MergeRequestEvents),
+		string(gitlab.WikiPageEvents), string(gitlab.PipelineEvents), string(gitlab.BuildEvents),
+		string(gitlab.JobEvents), string(gitlab.SystemHookEvents),
+	},
+	webhooks.Gitea: {
+		string(gitea.CreateEvents), string(gitea.DeleteEvents), string(gitea.ForkEvents), string(gitea.PushEvents),
+		string(gitea.IssuesEvents), string(gitea.IssueCommentEvents), string(gitea.PullRequestEvents),
+		string(gitea.RepositoryEvents), string(gitea.ReleaseEvents),
+	},
+	webhooks.Gogs: {
+		string(gogs.CreateEvent), string(gogs.DeleteEvent), string(gogs.ForkEvent), string(gogs.PushEvent),
+		string(gogs.IssuesEvent), string(gogs.IssueCommentEvent), string(gogs.PullRequestEvent), string(gogs.ReleaseEvent),
+	},
+	webhooks.Bitbucket: {
+		string(bitbucket.RepoPushEvent), string(bitbucket.RepoForkEvent), string(bitbucket.RepoUpdatedEvent),
+		string(bitbucket.RepoCommitCommentCreatedEvent), string(bitbucket.RepoCommitStatusCreatedEvent),
+		string(bitbucket.RepoCommitStatusUpdatedEvent), string(bitbucket.IssueCreatedEvent), string(bitbucket.IssueUpdatedEvent),
+		string(bitbucket.IssueCommentCreatedEvent), string(bitbucket.PullRequestCreatedEvent), string(bitbucket.PullRequestUpdatedEvent),
+		string(bitbucket.PullRequestApprovedEvent), string(bitbucket.PullRequestUnapprovedEvent), string(bitbucket.PullRequestMergedEvent),
+		string(bitbucket.PullRequestDeclinedEvent), string(bitbucket.PullRequestCommentCreatedEvent),
+		string(bitbucket.PullRequestCommentUpdatedEvent), string(bitbucket.PullRequestCommentDeletedEvent),
+	},
+	webhooks.BitbucketServer: {
+		string(bitbucketserver.RepositoryReferenceChangedEvent), string(bitbucketserver.RepositoryModifiedEvent),
+		string(bitbucketserver.RepositoryForkedEvent), string(bitbucketserver.RepositoryCommentAddedEvent),
+		string(bitbucketserver.RepositoryCommentEditedEvent), string(bitbucketserver.RepositoryCommentDeletedEvent),
+		string(bitbucketserver.PullRequestOpenedEvent), string(bitbucketserver.PullRequestFromReferenceUpdatedEvent),
+		string(bitbucketserver.PullRequestModifiedEvent), string(bitbucketserver.PullRequestMergedEvent),
+		string(bitbucketserver.PullRequestDeclinedEvent), string(bitbucketserver.PullRequestDeletedEvent),
+		string(bitbucketserver.PullRequestReviewerUpdatedEvent), string(bitbucketserver.PullRequestReviewerApprovedEvent),
+		string(bitbucketserver.PullRequestReviewerUnapprovedEvent), string(bitbucketserver.PullRequestReviewerNeedsWorkEvent),
+		string(bitbucketserver.PullRequestCommentAddedEvent), string(bitbucketserver.PullRequestCommentEditedEvent),
+		string(bitbucketserver.PullRequestCommentDeletedEvent), string(bitbucketserver.DiagnosticsPingEvent),
+	},
+	webhooks.Docker: {string(docker.BuildEvent)},
+}
+
+// variants are the additional fixtures of the events with several fixtures
+var variants = map[string]string{
+	"github/pull-request-issue-comment.json": string(github.IssueCommentEvent),
+}
+
+func TestFixturePathCoverage(t *testing.T) {
+	assert := require.New(t)
+
+	for _, provider := range providers {
+		paths := make(map[string]bool)
+		for _, event := range events[provider] {
+			path, err := FixturePath(provider, event)
+			if errors.Is(err, ErrNoFixtureName) {
+				continue
+			}
+			assert.NoError(err)
+			paths[filepath.ToSlash(path)] = true
+		}
+
+		names, err := Fixtures(provider)
+		assert.NoError(err)
+		dir, err := dir(provider)
+		assert.NoError(err)
+		for _, name := range names {
+			path := filepath.Base(dir) + "/" + name
+			if event, ok := variants[path]; ok {
+				assert.Contains(events[provider], event, path)
+				continue
+			}
+			if paths[path] {
+				continue
+			}
+			// the fixtures named from the payload are those of a delivery of
+			// one of the events
+			body, err := Fixture(provider, name)
+			assert.NoError(err)
+			found := false
+			for _, event := range events[provider] {
+				if p, err := DeliveryFixturePath(provider, event, body); err == nil && filepath.ToSlash(p) == path {
+					found = true
+				}
+			}
+			assert.True(found, "%s isn't the fixture of any %s event", path, provider)
+		}
+	}
+}
+
+func TestAssertPayload(t *testing.T) {
+	tests := []struct {
+		name     string
+		delivery Delivery
+		typ      interface{}
+	}{
+		{
+			name:     "GitHub",
+			delivery: Delivery{Provider: webhooks.GitHub, Event: string(github.PushEvent), Fixture: "push.json", Secret: "secret"},
+			typ:      github.PushPayload{},
+		},
+		{
+			name:     "GitHubUnsigned",
+			delivery: Delivery{Provider: webhooks.GitHub, Event: string(github.PingEvent), Fixture: "ping.json"},
+			typ:      github.PingPayload{},
+		},
+		{
+			name:     "GitLab",
+			delivery: Delivery{Provider: webhooks.GitLab, Event: string(gitlab.MergeRequestEvents), Fixture: "merge-request-event.json", Secret: "secret"},
+			typ:      gitlab.MergeRequestEventPayload{},
+		},
+		{
+			name:     "Gitea",
+			delivery: Delivery{Provider: webhooks.Gitea, Event: string(gitea.PushEvents), Fixture: "push-event.json", Secret: "secret"},
+			typ:      gitea.PushPayload{},
+		},
+		{
+			name:     "Bitbucket",
+			delivery: Delivery{Provider: webhooks.Bitbucket, Event: string(bitbucket.PullRequestMergedEvent), Fixture: "pull-request-merged.json", Secret: "MY_UUID"},
+			typ:      bitbucket.PullRequestMergedPayload{},
+		},
+		{
+			name:     "BitbucketServer",
+			delivery: Delivery{Provider: webhooks.BitbucketServer, Event: string(bitbucketserver.PullRequestOpenedEvent), Fixture: "pr-opened.json", Secret: "secret"},
+			typ:      bitbucketserver.PullRequestOpenedPayload{},
+		},
+		{
+			name:     "Docker",
+			delivery: Delivery{Provider: webhooks.Docker, Event: string(docker.BuildEvent), Fixture: "docker_hub_build_notice.json"},
+			typ:      docker.BuildPayload{},
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			AssertPayload(t, tc.delivery, tc.typ)
+		})
+	}
+}
+
+type recorder struct {
+	failure string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.failure = fmt.Sprintf(format, args...)
+}
+
+func TestAssertPayloadFailure(t *testing.T) {
+	assert := require.New(t)
+
+	r := &recorder{}
+	AssertPayload(r, Delivery{Provider: webhooks.GitHub, Event: string(github.PushEvent), Fixture: "push.json"}, github.PingPayload{})
+	assert.Contains(r.failure, "expected payload github.PingPayload, got github.PushPayload")
+
+	r = &recorder{}
+	AssertPayload(r, Delivery{Provider: webhooks.GitHub, Event: string(github.PushEvent), Fixture: "missing.json"}, github.PushPayload{})
+	assert.Contains(r.failure, "parse failed")
+}
+
+func TestServe(t *testing.T) {
+	assert := require.New(t)
+	hook, err := github.New(github.Options.Secret("secret"))
+	assert.NoError(err)
+
+	var ref string
+	router := github.NewRouter(hook)
+	router.OnPush(func(ctx context.Context, pl github.PushPayload) error {
+		ref = pl.Ref
+		return nil
+	})
+
+	w, err := Serve(router, Delivery{Provider: webhooks.GitHub, Event: string(github.PushEvent), Fixture: "push.json", Secret: "secret"})
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("refs/heads/master", ref)
+
+	w, err = Serve(router, Delivery{Provider: webhooks.GitHub, Event: string(github.PushEvent), Fixture: "push.json", Secret: "forged"})
+	assert.NoError(err)
+	assert.Equal(http.StatusUnauthorized, w.Code)
+}